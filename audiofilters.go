@@ -0,0 +1,453 @@
+package astiffmpeg
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Sample formats, the ones suffixed with "P" being planar
+const (
+	SampleFormatDBL  = "dbl"
+	SampleFormatDBLP = "dblp"
+	SampleFormatFLT  = "flt"
+	SampleFormatFLTP = "fltp"
+	SampleFormatS16  = "s16"
+	SampleFormatS16P = "s16p"
+	SampleFormatS32  = "s32"
+	SampleFormatS32P = "s32p"
+	SampleFormatS64  = "s64"
+	SampleFormatS64P = "s64p"
+	SampleFormatU8   = "u8"
+	SampleFormatU8P  = "u8p"
+)
+
+// sampleFormats lists the SampleFormat* constants
+var sampleFormats = []string{SampleFormatDBL, SampleFormatDBLP, SampleFormatFLT, SampleFormatFLTP, SampleFormatS16,
+	SampleFormatS16P, SampleFormatS32, SampleFormatS32P, SampleFormatS64, SampleFormatS64P, SampleFormatU8,
+	SampleFormatU8P}
+
+// Channel layouts
+const (
+	ChannelLayout21     = "2.1"
+	ChannelLayout51     = "5.1"
+	ChannelLayout71     = "7.1"
+	ChannelLayoutMono   = "mono"
+	ChannelLayoutQuad   = "quad"
+	ChannelLayoutStereo = "stereo"
+)
+
+// Aresample resamplers
+const (
+	AresampleResamplerSoxr = "soxr"
+	AresampleResamplerSwr  = "swr"
+)
+
+// AresampleFilter represents the aresample filter
+// https://ffmpeg.org/ffmpeg-filters.html#aresample-1
+type AresampleFilter struct {
+	// Stretches, squeezes, fills or trims the audio to match the timestamps, in samples per second. 1 fills or trims
+	// only.
+	Async *float64
+	// Timestamp of the first sample in samples, usually 0 to pad the beginning of the output with silence
+	FirstPTS *int
+	// One of the AresampleResampler* constants
+	Resampler string
+	// One of the SampleFormat* constants
+	SampleFormat string
+	SampleRate   *int
+}
+
+// String implements the fmt.Stringer interface
+func (f AresampleFilter) String() string {
+	var os filterOptions
+	os.addInt("osr", f.SampleRate)
+	os.add("osf", f.SampleFormat)
+	os.addFloat("async", f.Async)
+	os.addInt("first_pts", f.FirstPTS)
+	os.add("resampler", f.Resampler)
+	return filterString("aresample", os)
+}
+
+// Validate implements the TypedFilter interface
+func (f AresampleFilter) Validate() error {
+	v := filterValidator{filter: "aresample"}
+	v.intMin("osr", f.SampleRate, 1)
+	v.oneOf("osf", f.SampleFormat, sampleFormats...)
+	v.floatMin("async", f.Async, 0)
+	v.oneOf("resampler", f.Resampler, AresampleResamplerSoxr, AresampleResamplerSwr)
+	return v.err
+}
+
+// Volume evaluation modes
+const (
+	VolumeEvalFrame = "frame"
+	VolumeEvalOnce  = "once"
+)
+
+// Volume precisions
+const (
+	VolumePrecisionDouble = "double"
+	VolumePrecisionFixed  = "fixed"
+	VolumePrecisionFloat  = "float"
+)
+
+// VolumeFilter represents the volume filter
+// https://ffmpeg.org/ffmpeg-filters.html#volume
+type VolumeFilter struct {
+	// One of the VolumeEval* constants, VolumeEvalFrame being required when Volume depends on the timestamp
+	Eval string
+	// One of the VolumePrecision* constants
+	Precision string
+	// Expression such as "0.5", "-3dB" or "if(lt(t,10),1,0)"
+	Volume string
+}
+
+// NewVolumeFilter creates a new volume filter
+func NewVolumeFilter(volume string) VolumeFilter {
+	return VolumeFilter{Volume: volume}
+}
+
+// String implements the fmt.Stringer interface
+func (f VolumeFilter) String() string {
+	var os filterOptions
+	os.add("volume", f.Volume)
+	os.add("precision", f.Precision)
+	os.add("eval", f.Eval)
+	return filterString("volume", os)
+}
+
+// Validate implements the TypedFilter interface
+func (f VolumeFilter) Validate() error {
+	v := filterValidator{filter: "volume"}
+	v.required("volume", f.Volume)
+	v.oneOf("precision", f.Precision, VolumePrecisionDouble, VolumePrecisionFixed, VolumePrecisionFloat)
+	v.oneOf("eval", f.Eval, VolumeEvalFrame, VolumeEvalOnce)
+	return v.err
+}
+
+// ATempoFilter represents the atempo filter, changing the speed of the audio without changing its pitch
+// https://ffmpeg.org/ffmpeg-filters.html#atempo
+type ATempoFilter struct {
+	// Between 0.5 and 100, chain several filters to slow down more
+	Tempo float64
+}
+
+// NewATempoFilter creates a new atempo filter
+func NewATempoFilter(tempo float64) ATempoFilter {
+	return ATempoFilter{Tempo: tempo}
+}
+
+// String implements the fmt.Stringer interface
+func (f ATempoFilter) String() string {
+	var os filterOptions
+	os.addFloat("tempo", &f.Tempo)
+	return filterString("atempo", os)
+}
+
+// Validate implements the TypedFilter interface
+func (f ATempoFilter) Validate() error {
+	v := filterValidator{filter: "atempo"}
+	v.floatRange("tempo", &f.Tempo, 0.5, 100)
+	return v.err
+}
+
+// PanFilter represents the pan filter, remixing channels
+// https://ffmpeg.org/ffmpeg-filters.html#pan-1
+type PanFilter struct {
+	// Output channels definitions such as "c0=c1", "FL=0.5*FL+0.5*FC" or "FR<FR+BR", "<" renormalizing the gains
+	Channels []string
+	// Output channel layout such as "stereo" or number of output channels such as "2c"
+	Layout string
+}
+
+// NewPanFilter creates a new pan filter
+func NewPanFilter(layout string, channels ...string) PanFilter {
+	return PanFilter{Channels: channels, Layout: layout}
+}
+
+// String implements the fmt.Stringer interface
+func (f PanFilter) String() string {
+	var os filterOptions
+	os.add("", strings.Join(append([]string{f.Layout}, f.Channels...), "|"))
+	return filterString("pan", os)
+}
+
+// Validate implements the TypedFilter interface
+func (f PanFilter) Validate() error {
+	v := filterValidator{filter: "pan"}
+	v.required("layout", f.Layout)
+	if len(f.Channels) == 0 {
+		v.invalid("channels", "", "at least one output channel is required")
+	}
+	for _, c := range f.Channels {
+		if !strings.ContainsAny(c, "=<") {
+			v.invalid("channels", c, "must be such as c0=c1 or FL<FL+FC")
+		}
+	}
+	return v.err
+}
+
+// AMix durations
+const (
+	AMixDurationFirst    = "first"
+	AMixDurationLongest  = "longest"
+	AMixDurationShortest = "shortest"
+)
+
+// AMixFilter represents the amix filter, mixing several audio inputs into one
+// It can only be used in a filter graph.
+// https://ffmpeg.org/ffmpeg-filters.html#amix
+type AMixFilter struct {
+	// Time it takes to renormalize the volume when an input ends
+	DropoutTransition *float64
+	// Which input determines the duration of the output, one of the AMixDuration* constants
+	Duration string
+	// Number of inputs. Defaults to 2.
+	Inputs *int
+	// Scales the inputs so that the output doesn't clip. Requires ffmpeg >= 4.4 when set. Defaults to true.
+	Normalize *bool
+	// Weight of each input. Defaults to 1.
+	Weights []float64
+}
+
+// String implements the fmt.Stringer interface
+func (f AMixFilter) String() string {
+	var os filterOptions
+	os.addInt("inputs", f.Inputs)
+	os.add("duration", f.Duration)
+	os.addFloat("dropout_transition", f.DropoutTransition)
+	var ws []string
+	for _, w := range f.Weights {
+		ws = append(ws, strconv.FormatFloat(w, 'f', -1, 64))
+	}
+	os.add("weights", strings.Join(ws, " "))
+	os.addBool("normalize", f.Normalize)
+	return filterString("amix", os)
+}
+
+// Validate implements the TypedFilter interface
+func (f AMixFilter) Validate() error {
+	v := filterValidator{filter: "amix"}
+	v.intRange("inputs", f.Inputs, 1, 32767)
+	v.oneOf("duration", f.Duration, AMixDurationFirst, AMixDurationLongest, AMixDurationShortest)
+	v.floatMin("dropout_transition", f.DropoutTransition, 0)
+	inputs := 2
+	if f.Inputs != nil {
+		inputs = *f.Inputs
+	}
+	if len(f.Weights) > inputs {
+		v.invalid("weights", strconv.Itoa(len(f.Weights)), "must not exceed the number of inputs")
+	}
+	return v.err
+}
+
+// AMergeFilter represents the amerge filter, merging the channels of several audio inputs into one multichannel
+// stream
+// It can only be used in a filter graph.
+// https://ffmpeg.org/ffmpeg-filters.html#amerge-1
+type AMergeFilter struct {
+	// Number of inputs. Defaults to 2.
+	Inputs *int
+}
+
+// String implements the fmt.Stringer interface
+func (f AMergeFilter) String() string {
+	var os filterOptions
+	os.addInt("inputs", f.Inputs)
+	return filterString("amerge", os)
+}
+
+// Validate implements the TypedFilter interface
+func (f AMergeFilter) Validate() error {
+	v := filterValidator{filter: "amerge"}
+	v.intRange("inputs", f.Inputs, 1, 64)
+	return v.err
+}
+
+// AFormatFilter represents the aformat filter, constraining the sample formats, sample rates and channel layouts of
+// its output
+// https://ffmpeg.org/ffmpeg-filters.html#aformat-1
+type AFormatFilter struct {
+	// Such as ChannelLayoutStereo
+	ChannelLayouts []string
+	// SampleFormat* constants
+	SampleFormats []string
+	SampleRates   []int
+}
+
+// String implements the fmt.Stringer interface
+func (f AFormatFilter) String() string {
+	var os filterOptions
+	os.add("sample_fmts", strings.Join(f.SampleFormats, "|"))
+	var rs []string
+	for _, r := range f.SampleRates {
+		rs = append(rs, strconv.Itoa(r))
+	}
+	os.add("sample_rates", strings.Join(rs, "|"))
+	os.add("channel_layouts", strings.Join(f.ChannelLayouts, "|"))
+	return filterString("aformat", os)
+}
+
+// Validate implements the TypedFilter interface
+func (f AFormatFilter) Validate() error {
+	v := filterValidator{filter: "aformat"}
+	if len(f.ChannelLayouts) == 0 && len(f.SampleFormats) == 0 && len(f.SampleRates) == 0 {
+		v.invalid("sample_fmts", "", "at least one of sample_fmts, sample_rates or channel_layouts is required")
+	}
+	v.flags("sample_fmts", f.SampleFormats, sampleFormats...)
+	for _, r := range f.SampleRates {
+		r := r
+		v.intMin("sample_rates", &r, 1)
+	}
+	return v.err
+}
+
+// Pass filters width types
+const (
+	PassWidthTypeHz      = "h"
+	PassWidthTypeKHz     = "k"
+	PassWidthTypeOctave  = "o"
+	PassWidthTypeQFactor = "q"
+	PassWidthTypeSlope   = "s"
+)
+
+// HighpassFilter represents the highpass filter
+// https://ffmpeg.org/ffmpeg-filters.html#highpass
+type HighpassFilter struct {
+	// In Hz. Defaults to 3000.
+	Frequency *float64
+	// Between 0 and 1. Defaults to 1.
+	Mix *float64
+	// 1 or 2. Defaults to 2.
+	Poles *int
+	// Band width in WidthType units, only used with 2 poles
+	Width *float64
+	// One of the PassWidthType* constants
+	WidthType string
+}
+
+// String implements the fmt.Stringer interface
+func (f HighpassFilter) String() string {
+	return filterString("highpass", passOptions(f.Frequency, f.Poles, f.WidthType, f.Width, f.Mix))
+}
+
+// Validate implements the TypedFilter interface
+func (f HighpassFilter) Validate() error {
+	return validatePass("highpass", f.Frequency, f.Poles, f.WidthType, f.Width, f.Mix)
+}
+
+// LowpassFilter represents the lowpass filter
+// https://ffmpeg.org/ffmpeg-filters.html#lowpass
+type LowpassFilter struct {
+	// In Hz. Defaults to 500.
+	Frequency *float64
+	// Between 0 and 1. Defaults to 1.
+	Mix *float64
+	// 1 or 2. Defaults to 2.
+	Poles *int
+	// Band width in WidthType units, only used with 2 poles
+	Width *float64
+	// One of the PassWidthType* constants
+	WidthType string
+}
+
+// String implements the fmt.Stringer interface
+func (f LowpassFilter) String() string {
+	return filterString("lowpass", passOptions(f.Frequency, f.Poles, f.WidthType, f.Width, f.Mix))
+}
+
+// Validate implements the TypedFilter interface
+func (f LowpassFilter) Validate() error {
+	return validatePass("lowpass", f.Frequency, f.Poles, f.WidthType, f.Width, f.Mix)
+}
+
+func passOptions(frequency *float64, poles *int, widthType string, width, mix *float64) (os filterOptions) {
+	os.addFloat("f", frequency)
+	os.addInt("p", poles)
+	os.add("t", widthType)
+	os.addFloat("w", width)
+	os.addFloat("m", mix)
+	return
+}
+
+func validatePass(filter string, frequency *float64, poles *int, widthType string, width, mix *float64) error {
+	v := filterValidator{filter: filter}
+	v.floatMin("f", frequency, 0)
+	v.intRange("p", poles, 1, 2)
+	v.oneOf("t", widthType, PassWidthTypeHz, PassWidthTypeKHz, PassWidthTypeOctave, PassWidthTypeQFactor,
+		PassWidthTypeSlope)
+	v.floatMin("w", width, 0)
+	v.floatRange("m", mix, 0, 1)
+	return v.err
+}
+
+// Loudnorm print formats
+const (
+	LoudnormPrintFormatJSON    = "json"
+	LoudnormPrintFormatNone    = "none"
+	LoudnormPrintFormatSummary = "summary"
+)
+
+// LoudnormFilter represents the loudnorm filter, normalizing the loudness according to EBU R128
+// The audio is upsampled to 192kHz, use SampleRate or AudioSamplerate to encode it at a lower rate. See
+// FFMpeg.LoudnessNormalize for the two-pass normalization.
+// https://ffmpeg.org/ffmpeg-filters.html#loudnorm
+type LoudnormFilter struct {
+	// Treats mono input files as dual mono
+	DualMono *bool
+	// Target integrated loudness in LUFS, between -70 and -5. Defaults to -24.
+	IntegratedLoudness *float64
+	// Uses a fixed gain when the measured values allow it, falling back to dynamic normalization otherwise
+	Linear *bool
+	// Target loudness range in LU, between 1 and 50. Defaults to 7.
+	LoudnessRange *float64
+	// Values measured by a previous pass
+	MeasuredI      *float64
+	MeasuredLRA    *float64
+	MeasuredThresh *float64
+	MeasuredTP     *float64
+	// Offset gain in LU, usually the target_offset measured by a previous pass
+	Offset *float64
+	// One of the LoudnormPrintFormat* constants
+	PrintFormat string
+	// Max true peak in dBTP, between -9 and 0. Defaults to -2.
+	TruePeak *float64
+}
+
+// NewEBUR128LoudnormFilter creates a new loudnorm filter with the EBU R128 targets: -23 LUFS and -1 dBTP
+func NewEBUR128LoudnormFilter() LoudnormFilter {
+	i, tp := -23.0, -1.0
+	return LoudnormFilter{IntegratedLoudness: &i, TruePeak: &tp}
+}
+
+// String implements the fmt.Stringer interface
+func (f LoudnormFilter) String() string {
+	var os filterOptions
+	os.addFloat("I", f.IntegratedLoudness)
+	os.addFloat("LRA", f.LoudnessRange)
+	os.addFloat("TP", f.TruePeak)
+	os.addFloat("measured_I", f.MeasuredI)
+	os.addFloat("measured_LRA", f.MeasuredLRA)
+	os.addFloat("measured_TP", f.MeasuredTP)
+	os.addFloat("measured_thresh", f.MeasuredThresh)
+	os.addFloat("offset", f.Offset)
+	os.addBool("linear", f.Linear)
+	os.addBool("dual_mono", f.DualMono)
+	os.add("print_format", f.PrintFormat)
+	return filterString("loudnorm", os)
+}
+
+// Validate implements the TypedFilter interface
+func (f LoudnormFilter) Validate() error {
+	v := filterValidator{filter: "loudnorm"}
+	v.floatRange("I", f.IntegratedLoudness, -70, -5)
+	v.floatRange("LRA", f.LoudnessRange, 1, 50)
+	v.floatRange("TP", f.TruePeak, -9, 0)
+	v.floatRange("measured_I", f.MeasuredI, -99, 0)
+	v.floatRange("measured_LRA", f.MeasuredLRA, 0, 99)
+	v.floatRange("measured_TP", f.MeasuredTP, -99, 99)
+	v.floatRange("measured_thresh", f.MeasuredThresh, -99, 0)
+	v.floatRange("offset", f.Offset, -99, 99)
+	v.oneOf("print_format", f.PrintFormat, LoudnormPrintFormatJSON, LoudnormPrintFormatNone, LoudnormPrintFormatSummary)
+	return v.err
+}
@@ -0,0 +1,84 @@
+package astiffmpeg
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"testing"
+
+	"github.com/asticode/go-astitools/ptr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAudioFilters(t *testing.T) {
+	for _, v := range []struct {
+		f TypedFilter
+		s string
+	}{
+		{f: AresampleFilter{Async: astiptr.Float(1), FirstPTS: astiptr.Int(0), SampleRate: astiptr.Int(48000)}, s: "aresample=osr=48000:async=1:first_pts=0"},
+		{f: AresampleFilter{Resampler: AresampleResamplerSoxr, SampleFormat: SampleFormatFLTP}, s: "aresample=osf=fltp:resampler=soxr"},
+		{f: NewVolumeFilter("-3dB"), s: "volume=volume=-3dB"},
+		{f: VolumeFilter{Eval: VolumeEvalFrame, Volume: "if(lt(t,10),1,0)"}, s: `volume=volume=if(lt(t\,10)\,1\,0):eval=frame`},
+		{f: NewATempoFilter(1.25), s: "atempo=tempo=1.25"},
+		{f: NewPanFilter(ChannelLayoutMono, "c0=0.5*c0+0.5*c1"), s: "pan=mono|c0=0.5*c0+0.5*c1"},
+		{f: NewPanFilter(ChannelLayoutStereo, "FL<FL+FC", "FR<FR+FC"), s: "pan=stereo|FL<FL+FC|FR<FR+FC"},
+		{f: AMixFilter{Duration: AMixDurationShortest, Inputs: astiptr.Int(3), Normalize: astiptr.Bool(false), Weights: []float64{1, 0.5, 0.5}}, s: "amix=inputs=3:duration=shortest:weights=1 0.5 0.5:normalize=false"},
+		{f: AMergeFilter{Inputs: astiptr.Int(2)}, s: "amerge=inputs=2"},
+		{f: AFormatFilter{ChannelLayouts: []string{ChannelLayoutStereo}, SampleFormats: []string{SampleFormatS16, SampleFormatFLTP}, SampleRates: []int{44100, 48000}}, s: "aformat=sample_fmts=s16|fltp:sample_rates=44100|48000:channel_layouts=stereo"},
+		{f: HighpassFilter{Frequency: astiptr.Float(200), Poles: astiptr.Int(1)}, s: "highpass=f=200:p=1"},
+		{f: LowpassFilter{Frequency: astiptr.Float(3000), Width: astiptr.Float(0.707), WidthType: PassWidthTypeQFactor}, s: "lowpass=f=3000:t=q:w=0.707"},
+	} {
+		assert.NoError(t, v.f.Validate(), v.s)
+		assert.Equal(t, v.s, v.f.String())
+	}
+
+	// Invalid
+	for _, v := range []struct {
+		err string
+		f   TypedFilter
+	}{
+		{err: "astiffmpeg: aresample osr 0: astiffmpeg: invalid option value: must be at least 1", f: AresampleFilter{SampleRate: astiptr.Int(0)}},
+		{err: "astiffmpeg: volume volume: astiffmpeg: invalid option value: option is required", f: VolumeFilter{}},
+		{err: "astiffmpeg: atempo tempo 0.25: astiffmpeg: invalid option value: must be between 0.5 and 100", f: NewATempoFilter(0.25)},
+		{err: "astiffmpeg: pan channels FL: astiffmpeg: invalid option value: must be such as c0=c1 or FL<FL+FC", f: NewPanFilter(ChannelLayoutStereo, "FL")},
+		{err: "astiffmpeg: amix weights 3: astiffmpeg: invalid option value: must not exceed the number of inputs", f: AMixFilter{Weights: []float64{1, 1, 1}}},
+		{err: "astiffmpeg: aformat sample_fmts: astiffmpeg: invalid option value: at least one of sample_fmts, sample_rates or channel_layouts is required", f: AFormatFilter{}},
+		{err: "astiffmpeg: highpass p 3: astiffmpeg: invalid option value: must be between 1 and 2", f: HighpassFilter{Poles: astiptr.Int(3)}},
+		{err: "astiffmpeg: lowpass m 2: astiffmpeg: invalid option value: must be between 0 and 1", f: LowpassFilter{Mix: astiptr.Float(2)}},
+	} {
+		err := v.f.Validate()
+		assert.True(t, errors.Is(err, ErrInvalidOptionValue), v.err)
+		assert.EqualError(t, err, v.err)
+	}
+}
+
+func TestAudioEncodingOptions(t *testing.T) {
+	cmd := exec.Command("ffmpeg")
+	err := EncodingOptions{
+		Bitrate:         []StreamOption{{Stream: &StreamSpecifier{Type: StreamSpecifierTypeAudio}, Value: Number{Prefix: "k", Value: 128.0}}},
+		ChannelLayout:   []StreamOption{{Stream: &StreamSpecifier{Index: astiptr.Int(0), Type: StreamSpecifierTypeAudio}, Value: ChannelLayoutStereo}},
+		Channels:        []StreamOption{{Stream: &StreamSpecifier{Index: astiptr.Int(0), Type: StreamSpecifierTypeAudio}, Value: 2}},
+		DisableData:     true,
+		DisableSubtitle: true,
+		DisableVideo:    true,
+		Filters: []StreamOption{{
+			Stream: &StreamSpecifier{Type: StreamSpecifierTypeAudio},
+			Value:  FilterOptions{Filters: []fmt.Stringer{AresampleFilter{Async: astiptr.Float(1)}, NewVolumeFilter("0.8")}},
+		}},
+		SampleFormat: []StreamOption{{Stream: &StreamSpecifier{Type: StreamSpecifierTypeAudio}, Value: SampleFormatFLTP}},
+		SampleRate:   []StreamOption{{Stream: &StreamSpecifier{Index: astiptr.Int(0), Type: StreamSpecifierTypeAudio}, Value: 48000}},
+	}.adaptCmd(cmd, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ffmpeg", "-ar:a:0", "48000", "-ac:a:0", "2", "-channel_layout:a:0", "stereo", "-sample_fmt:a", "fltp", "-b:a", "128k", "-filter:a", "aresample=async=1,volume=volume=0.8", "-dn", "-sn", "-vn"}, cmd.Args)
+
+	// Invalid values
+	assert.Error(t, EncodingOptions{SampleRate: []StreamOption{{Value: "48000"}}}.adaptCmd(exec.Command("ffmpeg"), nil))
+	assert.Error(t, EncodingOptions{SampleFormat: []StreamOption{{Value: 1}}}.adaptCmd(exec.Command("ffmpeg"), nil))
+
+	// Filter graph
+	g := FilterGraph{Chains: []FilterChain{
+		{{Filter: AMixFilter{Duration: AMixDurationFirst, Inputs: astiptr.Int(2)}, Inputs: []FilterPad{{Input: 0, Stream: &StreamSpecifier{Type: StreamSpecifierTypeAudio}}, {Input: 1, Stream: &StreamSpecifier{Type: StreamSpecifierTypeAudio}}}}, {Filter: NewPanFilter(ChannelLayoutMono, "c0=c0+c1"), Outputs: []FilterPad{{Label: "mix"}}}},
+	}}
+	assert.NoError(t, g.validate([]string{"mix"}))
+	assert.Equal(t, "[0:a][1:a]amix=inputs=2:duration=first,pan=mono|c0=c0+c1[mix]", g.string())
+}
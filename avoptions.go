@@ -0,0 +1,467 @@
+package astiffmpeg
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+//go:generate go run ./cmd/astiffmpeg-gen -i testdata/ffmpeg-help-full.txt -o options_gen.go -encoders aac,libx264 -muxers hls,mp4 -filters eq
+
+// AVOption validation error causes
+// Use them with errors.Is on an error returned by FFMpeg.Validate
+var (
+	ErrInvalidOptionValue = errors.New("astiffmpeg: invalid option value")
+	ErrUnknownOption      = errors.New("astiffmpeg: unknown option")
+)
+
+// AVOption types
+const (
+	AVOptionTypeBoolean    = "boolean"
+	AVOptionTypeDictionary = "dictionary"
+	AVOptionTypeDouble     = "double"
+	AVOptionTypeDuration   = "duration"
+	AVOptionTypeFlags      = "flags"
+	AVOptionTypeFloat      = "float"
+	AVOptionTypeInt        = "int"
+	AVOptionTypeInt64      = "int64"
+	AVOptionTypeString     = "string"
+	AVOptionTypeUint64     = "uint64"
+)
+
+// AVOption sections of "ffmpeg -h full" shared by every encoder and muxer
+const (
+	avOptionSectionCodec  = "AVCodecContext"
+	avOptionSectionFormat = "AVFormatContext"
+)
+
+// AVOption regexps
+var (
+	avOptionConstantRegexp = regexp.MustCompile(`^\s{3,}(\S+)(?:\s+(\S+))?\s+([A-Z.]{8,})(?:\s+(.*))?$`)
+	avOptionDefaultRegexp  = regexp.MustCompile(`\s*\(default (.*)\)$`)
+	avOptionRangeRegexp    = regexp.MustCompile(`\s*\(from (\S+) to (\S+)\)$`)
+	avOptionRegexp         = regexp.MustCompile(`^\s+-?(\S+)\s+<(\w+)>\s+([A-Z.]{8,})(?:\s+(.*))?$`)
+	avOptionSectionRegexp  = regexp.MustCompile(`^(\S.*) AVOptions:$`)
+	cliOptionRegexp        = regexp.MustCompile(`^-(\S+)`)
+)
+
+// avOptionLimits are the symbolic limits used in option ranges
+var avOptionLimits = map[string]float64{
+	"DBL_MAX":    math.MaxFloat64,
+	"DBL_MIN":    -math.MaxFloat64,
+	"FLT_MAX":    math.MaxFloat32,
+	"FLT_MIN":    -math.MaxFloat32,
+	"I64_MAX":    math.MaxInt64,
+	"I64_MIN":    math.MinInt64,
+	"INT_MAX":    math.MaxInt32,
+	"INT_MIN":    math.MinInt32,
+	"UINT32_MAX": math.MaxUint32,
+	"UINT64_MAX": math.MaxUint64,
+}
+
+// AVOption represents an option of an encoder, a filter or a muxer, as listed by "ffmpeg -h"
+type AVOption struct {
+	Constants   []AVOptionConstant
+	Default     string // Empty if there's no default
+	Description string
+	Max         *float64
+	Min         *float64
+	Name        string
+	Type        string // One of the AVOptionType* constants
+}
+
+// AVOptionConstant represents a named value of an option
+type AVOptionConstant struct {
+	Description string
+	Name        string
+	Value       string // Empty for flags
+}
+
+// EncoderAVOptions returns the private options of the encoder. Results are cached.
+func (f *FFMpeg) EncoderAVOptions(ctx context.Context, name string) ([]AVOption, error) {
+	return f.avOptions(ctx, "encoder", name)
+}
+
+// FilterAVOptions returns the options of the filter. Results are cached.
+func (f *FFMpeg) FilterAVOptions(ctx context.Context, name string) ([]AVOption, error) {
+	return f.avOptions(ctx, "filter", name)
+}
+
+// MuxerAVOptions returns the private options of the muxer. Results are cached.
+func (f *FFMpeg) MuxerAVOptions(ctx context.Context, name string) ([]AVOption, error) {
+	return f.avOptions(ctx, "muxer", name)
+}
+
+func (f *FFMpeg) avOptions(ctx context.Context, kind, name string) (os []AVOption, err error) {
+	// Lock
+	f.capabilities.m.Lock()
+	defer f.capabilities.m.Unlock()
+
+	// Cached
+	var k = kind + "=" + name
+	if v, ok := f.capabilities.avOptions[k]; ok {
+		return v, nil
+	}
+
+	// Run
+	var b []byte
+	if b, err = f.capabilityOutput(ctx, "-h", k); err != nil {
+		return
+	}
+
+	// ffmpeg exits successfully when the component doesn't exist
+	if s := string(b); !strings.HasPrefix(s, strings.ToUpper(kind[:1])+kind[1:]+" ") {
+		err = errors.Errorf("astiffmpeg: unknown %s %s", kind, name)
+		return
+	}
+
+	// Parse
+	os = []AVOption{}
+	for _, v := range ParseAVOptions(b) {
+		os = append(os, v...)
+	}
+	f.capabilities.avOptions[k] = os
+	return
+}
+
+// genericOptions returns the options shared by every encoder and muxer as well as the command line options
+func (f *FFMpeg) genericOptions(ctx context.Context) (os []AVOption, err error) {
+	// Lock
+	f.capabilities.m.Lock()
+	defer f.capabilities.m.Unlock()
+
+	// Cached
+	if f.capabilities.genericOptions != nil {
+		return f.capabilities.genericOptions, nil
+	}
+
+	// Run
+	var b []byte
+	if b, err = f.capabilityOutput(ctx, "-h", "full"); err != nil {
+		return
+	}
+
+	// Parse
+	ss := ParseAVOptions(b)
+	os = append(append([]AVOption{}, ss[avOptionSectionCodec]...), ss[avOptionSectionFormat]...)
+	for _, n := range parseCLIOptions(b) {
+		os = append(os, AVOption{Name: n})
+	}
+	f.capabilities.genericOptions = os
+	return
+}
+
+// ParseAVOptions parses the AVOptions sections of "ffmpeg -h" indexed by section name, e.g. "libx264" or
+// "AVCodecContext". It is used by astiffmpeg-gen to generate typed option structs.
+func ParseAVOptions(b []byte) (ss map[string][]AVOption) {
+	ss = make(map[string][]AVOption)
+	var s string
+	var os []AVOption
+	var inSection bool
+	for _, l := range strings.Split(string(b), "\n") {
+		l = strings.TrimRight(l, " \r")
+
+		// Section
+		if ms := avOptionSectionRegexp.FindStringSubmatch(l); ms != nil {
+			if inSection {
+				ss[s] = append(ss[s], os...)
+			}
+			s, os, inSection = ms[1], nil, true
+			continue
+		}
+		if !inSection {
+			continue
+		}
+
+		// Option
+		if ms := avOptionRegexp.FindStringSubmatch(l); ms != nil {
+			o := AVOption{Name: ms[1], Type: ms[2]}
+			d := ms[4]
+			if dms := avOptionDefaultRegexp.FindStringSubmatch(d); dms != nil {
+				o.Default = strings.Trim(dms[1], `"`)
+				d = d[:len(d)-len(dms[0])]
+			}
+			if rms := avOptionRangeRegexp.FindStringSubmatch(d); rms != nil {
+				o.Min, o.Max = parseAVOptionNumber(rms[1]), parseAVOptionNumber(rms[2])
+				d = d[:len(d)-len(rms[0])]
+			}
+			o.Description = strings.TrimSpace(d)
+			os = append(os, o)
+			continue
+		}
+
+		// Constant
+		if ms := avOptionConstantRegexp.FindStringSubmatch(l); ms != nil && len(os) > 0 {
+			os[len(os)-1].Constants = append(os[len(os)-1].Constants, AVOptionConstant{
+				Description: strings.TrimSpace(ms[4]),
+				Name:        ms[1],
+				Value:       ms[2],
+			})
+			continue
+		}
+
+		// End of section
+		if len(strings.TrimSpace(l)) == 0 || l[0] != ' ' {
+			ss[s] = append(ss[s], os...)
+			s, os, inSection = "", nil, false
+		}
+	}
+	if inSection {
+		ss[s] = append(ss[s], os...)
+	}
+	return
+}
+
+// PrivateOptions represents the private options of an encoder or a muxer such as the generated Libx264EncoderOptions
+// or HlsMuxerOptions
+type PrivateOptions interface {
+	adaptCmd(cmd *exec.Cmd)
+}
+
+// avOptionFlag returns the command line flag of an encoder option restricted to a stream
+func avOptionFlag(name string, s *StreamSpecifier) string {
+	if s != nil {
+		return "-" + name + ":" + s.string()
+	}
+	return "-" + name
+}
+
+// avOptionFlags renders a flags option, flags without a "+" or "-" prefix are added to the defaults
+func avOptionFlags(fs []string) string {
+	var s string
+	for _, f := range fs {
+		if !strings.HasPrefix(f, "+") && !strings.HasPrefix(f, "-") {
+			f = "+" + f
+		}
+		s += f
+	}
+	return s
+}
+
+// avOptionDictionary renders a dictionary option as sorted key=value pairs separated by ":"
+func avOptionDictionary(m map[string]string) string {
+	var ks []string
+	for k := range m {
+		ks = append(ks, k)
+	}
+	sort.Strings(ks)
+	var ss []string
+	for _, k := range ks {
+		ss = append(ss, k+"="+m[k])
+	}
+	return strings.Join(ss, ":")
+}
+
+// parseCLIOptions parses the names of the command line options listed by "ffmpeg -h"
+func parseCLIOptions(b []byte) (ns []string) {
+	for _, l := range strings.Split(string(b), "\n") {
+		if ms := cliOptionRegexp.FindStringSubmatch(l); ms != nil {
+			ns = append(ns, ms[1])
+		}
+	}
+	return
+}
+
+func parseAVOptionNumber(i string) *float64 {
+	if v, ok := avOptionLimits[i]; ok {
+		return &v
+	}
+	v, err := strconv.ParseFloat(i, 64)
+	if err != nil {
+		return nil
+	}
+	return &v
+}
+
+// validate returns an error if the value is not valid for the option
+func (o AVOption) validate(i interface{}) error {
+	// Get value
+	var s string
+	switch v := i.(type) {
+	case int:
+		s = strconv.Itoa(v)
+	case float64:
+		// Customize renders floats as ints
+		s = strconv.Itoa(int(v))
+	case string:
+		s = v
+	default:
+		return fmt.Errorf("astiffmpeg: unsupported value type %T", i)
+	}
+
+	// Constants
+	for _, c := range o.Constants {
+		if c.Name == s {
+			return nil
+		}
+	}
+
+	// Check value
+	switch o.Type {
+	case AVOptionTypeBoolean:
+		switch s {
+		case "0", "1", "false", "true":
+			return nil
+		}
+		return fmt.Errorf("astiffmpeg: %s is not a boolean", s)
+	case AVOptionTypeDouble, AVOptionTypeFloat, AVOptionTypeInt, AVOptionTypeInt64, AVOptionTypeUint64:
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			var cs []string
+			for _, c := range o.Constants {
+				cs = append(cs, c.Name)
+			}
+			if len(cs) > 0 {
+				return fmt.Errorf("astiffmpeg: %s is neither a number nor one of %s", s, strings.Join(cs, ", "))
+			}
+			return fmt.Errorf("astiffmpeg: %s is not a number", s)
+		}
+		if (o.Min != nil && v < *o.Min) || (o.Max != nil && v > *o.Max) {
+			return fmt.Errorf("astiffmpeg: %s is out of range", s)
+		}
+	case AVOptionTypeFlags:
+		for _, f := range strings.FieldsFunc(s, func(r rune) bool { return r == '+' || r == '-' }) {
+			var found bool
+			for _, c := range o.Constants {
+				if c.Name == f {
+					found = true
+					break
+				}
+			}
+			if _, err := strconv.Atoi(f); !found && err != nil {
+				return fmt.Errorf("astiffmpeg: unknown flag %s", f)
+			}
+		}
+	}
+	return nil
+}
+
+// validateCustomize checks the output's Customize keys and values against the options of its encoders and muxer
+func (f *FFMpeg) validateCustomize(ctx context.Context, prefix string, o OutputOptions) (err error) {
+	// Get options
+	var os []AVOption
+	if os, err = f.genericOptions(ctx); err != nil {
+		err = errors.Wrap(err, "astiffmpeg: getting generic options failed")
+		return
+	}
+	for _, so := range o.Encoding.Codec {
+		if v, ok := so.Value.(string); ok && v != "copy" {
+			var eos []AVOption
+			if eos, err = f.EncoderAVOptions(ctx, v); err != nil {
+				err = errors.Wrapf(err, "astiffmpeg: getting options of encoder %s failed", v)
+				return
+			}
+			os = append(os, eos...)
+		}
+	}
+	if len(o.Format) > 0 {
+		var mos []AVOption
+		if mos, err = f.MuxerAVOptions(ctx, o.Format); err != nil {
+			err = errors.Wrapf(err, "astiffmpeg: getting options of muxer %s failed", o.Format)
+			return
+		}
+		os = append(os, mos...)
+	}
+
+	// Index options
+	var m = make(map[string][]AVOption)
+	for _, v := range os {
+		m[v.Name] = append(m[v.Name], v)
+	}
+
+	// Loop through keys
+	var keys []string
+	for k := range o.Encoding.Customize {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		// Strip stream specifier
+		n := k
+		if i := strings.Index(n, ":"); i > 0 {
+			n = n[:i]
+		}
+
+		// Unknown option
+		vs, ok := m[n]
+		if !ok {
+			e := &ValidationError{Cause: ErrUnknownOption, Option: prefix + " -" + k}
+			if s := suggestOption(n, m); len(s) > 0 {
+				e.Suggestion = "-" + s
+			}
+			return e
+		}
+
+		// Several options may share the same name, the value must be valid for one of them
+		var errValue error
+		for _, v := range vs {
+			if errValue = v.validate(o.Encoding.Customize[k]); errValue == nil {
+				break
+			}
+		}
+		if errValue != nil {
+			return &ValidationError{
+				Cause:  ErrInvalidOptionValue,
+				Option: prefix + " -" + k,
+				Reason: errValue.Error(),
+				Value:  fmt.Sprintf("%v", o.Encoding.Customize[k]),
+			}
+		}
+	}
+	return
+}
+
+// suggestOption returns the closest option name, or an empty string if none is close enough
+func suggestOption(n string, m map[string][]AVOption) (s string) {
+	var min = len(n)/3 + 1
+	var names []string
+	for k := range m {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		if d := levenshtein(n, k); d <= min && (len(s) == 0 || d < levenshtein(n, s)) {
+			s = k
+		}
+	}
+	return
+}
+
+// levenshtein returns the edit distance between a and b
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	ps := make([]int, len(rb)+1)
+	for j := range ps {
+		ps[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cs := make([]int, len(rb)+1)
+		cs[0] = i
+		for j := 1; j <= len(rb); j++ {
+			c := 1
+			if ra[i-1] == rb[j-1] {
+				c = 0
+			}
+			cs[j] = minInt(ps[j]+1, cs[j-1]+1, ps[j-1]+c)
+		}
+		ps = cs
+	}
+	return ps[len(rb)]
+}
+
+func minInt(is ...int) (m int) {
+	m = is[0]
+	for _, i := range is[1:] {
+		if i < m {
+			m = i
+		}
+	}
+	return
+}
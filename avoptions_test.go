@@ -0,0 +1,170 @@
+package astiffmpeg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/asticode/go-astitools/ptr"
+	"github.com/stretchr/testify/assert"
+)
+
+const testEncoderHelp = `Encoder libx264 [libx264 H.264 / AVC / MPEG-4 AVC / MPEG-4 part 10]:
+    General capabilities: dr1 delay threads
+    Threading capabilities: other
+    Supported pixel formats: yuv420p yuvj420p yuv422p
+libx264 AVOptions:
+  -preset            <string>     E..V....... Set the encoding preset (cf. x264 --fullhelp) (default "medium")
+  -crf               <float>      E..V....... Select the quality for constant quality mode (from -1 to FLT_MAX) (default -1)
+  -aq-mode           <int>        E..V....... AQ method (from -1 to INT_MAX) (default -1)
+     none            0            E..V.......
+     variance        1            E..V....... Variance AQ (complexity mask)
+  -fastfirstpass     <boolean>    E..V....... Use fast settings when encoding first pass (default true)
+  -x264-params       <dictionary> E..V....... Override the x264 configuration using a :-separated list of key=value parameters
+
+`
+
+const testFullHelp = `Main options:
+-f fmt              force format
+-y                  overwrite output files
+
+AVCodecContext AVOptions:
+  -b                 <int64>      E..VA...... set bitrate (in bits/s) (from 0 to I64_MAX) (default 200000)
+  -flags             <flags>      ED.VAS..... (default 0)
+     unaligned                    .D.V....... allow decoders to produce unaligned output
+     global_header                E..VA...... place global headers in extradata instead of every keyframe
+
+AVFormatContext AVOptions:
+  -fflags            <flags>      ED......... (default autobsf)
+     genpts                       .D......... generate pts
+`
+
+func TestParseAVOptions(t *testing.T) {
+	ss := ParseAVOptions([]byte(testEncoderHelp))
+	assert.Equal(t, map[string][]AVOption{"libx264": {
+		{Default: "medium", Description: "Set the encoding preset (cf. x264 --fullhelp)", Name: "preset", Type: AVOptionTypeString},
+		{Default: "-1", Description: "Select the quality for constant quality mode", Max: astiptr.Float(3.4028234663852886e+38), Min: astiptr.Float(-1), Name: "crf", Type: AVOptionTypeFloat},
+		{
+			Constants: []AVOptionConstant{
+				{Name: "none", Value: "0"},
+				{Description: "Variance AQ (complexity mask)", Name: "variance", Value: "1"},
+			},
+			Default:     "-1",
+			Description: "AQ method",
+			Max:         astiptr.Float(2147483647),
+			Min:         astiptr.Float(-1),
+			Name:        "aq-mode",
+			Type:        AVOptionTypeInt,
+		},
+		{Default: "true", Description: "Use fast settings when encoding first pass", Name: "fastfirstpass", Type: AVOptionTypeBoolean},
+		{Description: "Override the x264 configuration using a :-separated list of key=value parameters", Name: "x264-params", Type: AVOptionTypeDictionary},
+	}}, ss)
+
+	ss = ParseAVOptions([]byte(testFullHelp))
+	assert.Len(t, ss, 2)
+	assert.Equal(t, []AVOptionConstant{
+		{Description: "allow decoders to produce unaligned output", Name: "unaligned"},
+		{Description: "place global headers in extradata instead of every keyframe", Name: "global_header"},
+	}, ss[avOptionSectionCodec][1].Constants)
+	assert.Equal(t, []string{"f", "y"}, parseCLIOptions([]byte(testFullHelp)))
+}
+
+func TestAVOptionValidate(t *testing.T) {
+	os := ParseAVOptions([]byte(testEncoderHelp + testFullHelp))
+	crf, aqMode, fastFirstPass, flags := os["libx264"][1], os["libx264"][2], os["libx264"][3], os[avOptionSectionCodec][1]
+	for _, v := range []struct {
+		hasError bool
+		i        interface{}
+		o        AVOption
+	}{
+		{i: 23, o: crf},
+		{i: "23.5", o: crf},
+		{hasError: true, i: -2, o: crf},
+		{hasError: true, i: "high", o: crf},
+		{i: "variance", o: aqMode},
+		{i: 2, o: aqMode},
+		{hasError: true, i: "varience", o: aqMode},
+		{i: "true", o: fastFirstPass},
+		{hasError: true, i: "yes", o: fastFirstPass},
+		{i: "+global_header", o: flags},
+		{i: "unaligned+global_header", o: flags},
+		{hasError: true, i: "+globalheader", o: flags},
+		{hasError: true, i: true, o: flags},
+	} {
+		err := v.o.validate(v.i)
+		if v.hasError {
+			assert.Error(t, err, "%s %v", v.o.Name, v.i)
+		} else {
+			assert.NoError(t, err, "%s %v", v.o.Name, v.i)
+		}
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	assert.Equal(t, 0, levenshtein("preset", "preset"))
+	assert.Equal(t, 2, levenshtein("preest", "preset"))
+	assert.Equal(t, 3, levenshtein("kitten", "sitting"))
+	assert.Equal(t, "preset", suggestOption("prest", map[string][]AVOption{"preset": nil, "profile": nil}))
+	assert.Equal(t, "", suggestOption("tune", map[string][]AVOption{"preset": nil}))
+}
+
+func TestFFMpegValidateCustomize(t *testing.T) {
+	p, cleanup := newTestBinary(t, `case "$2$3" in
+-encoders) printf ' ------\n V....D libx264 libx264\n' ;;
+-hfull) cat <<'EOF'
+`+testFullHelp+`EOF
+;;
+-hencoder=libx264) cat <<'EOF'
+`+testEncoderHelp+`EOF
+;;
+-hencoder=libx265) echo "Codec 'libx265' is not recognized by FFmpeg." ;;
+*) exit 1 ;;
+esac
+`)
+	defer cleanup()
+	f := newTestFFMpeg(t, Configuration{BinaryPath: p})
+	c := Command{Outputs: []Output{{Options: &OutputOptions{Encoding: &EncodingOptions{
+		Codec:     []StreamOption{{Value: "libx264"}},
+		Customize: map[string]interface{}{"aq-mode": "variance", "crf": 23, "flags": "+global_header", "y": ""},
+	}}}}}
+	assert.NoError(t, f.Validate(context.Background(), c))
+	os, err := f.EncoderAVOptions(context.Background(), "libx264")
+	assert.NoError(t, err)
+	assert.Len(t, os, 5)
+
+	// Misspelled
+	c.Outputs[0].Options.Encoding.Customize = map[string]interface{}{"preest": "fast"}
+	err = f.Validate(context.Background(), c)
+	assert.True(t, errors.Is(err, ErrUnknownOption))
+	assert.EqualError(t, err, "astiffmpeg: output #0 -preest: astiffmpeg: unknown option, did you mean -preset?")
+
+	// Invalid value
+	c.Outputs[0].Options.Encoding.Customize = map[string]interface{}{"aq-mode": "varience"}
+	err = f.Validate(context.Background(), c)
+	assert.True(t, errors.Is(err, ErrInvalidOptionValue))
+
+	// Unknown encoder
+	_, err = f.EncoderAVOptions(context.Background(), "libx265")
+	assert.EqualError(t, err, "astiffmpeg: unknown encoder libx265")
+}
+
+func TestPrivateOptions(t *testing.T) {
+	cmd := exec.Command("ffmpeg")
+	err := OutputOptions{
+		Encoding: &EncodingOptions{Filters: []StreamOption{{Value: FilterOptions{Filters: []fmt.Stringer{EqFilterOptions{Contrast: "1.2", Eval: EqFilterEvalFrame}}}}}},
+		Format:   "hls",
+		Private: []PrivateOptions{
+			Libx264EncoderOptions{Stream: &StreamSpecifier{Index: astiptr.Int(0)}, X264Params: map[string]string{"scenecut": "0", "keyint": "60"}},
+			HlsMuxerOptions{HlsFlags: []string{HlsMuxerHlsFlagsDeleteSegments, "-independent_segments"}, HlsTime: durationPtr(1500 * time.Millisecond)},
+		},
+	}.adaptCmd(cmd, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ffmpeg", "-filter", "eq=contrast=1.2:eval=frame", "-f", "hls", "-x264-params:0", "keyint=60:scenecut=0", "-hls_flags", "+delete_segments-independent_segments", "-hls_time", "1.5"}, cmd.Args)
+}
+
+func durationPtr(d time.Duration) *time.Duration {
+	return &d
+}
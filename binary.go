@@ -0,0 +1,100 @@
+package astiffmpeg
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrBinaryNotFound is returned by New when the ffmpeg binary is neither configured nor in $PATH
+var ErrBinaryNotFound = errors.New("astiffmpeg: ffmpeg binary not found in the configuration, $" + EnvBinaryPath + " or $PATH")
+
+// Environment variables used to locate the binaries when they're not configured
+const (
+	EnvBinaryPath      = "FFMPEG_PATH"
+	EnvProbeBinaryPath = "FFPROBE_PATH"
+)
+
+// binaryCheckTimeout is the time given to a binary to print its version
+const binaryCheckTimeout = 10 * time.Second
+
+// lookBinary returns the path of the binary configured either explicitly or through the environment variable, or
+// found in $PATH if name is not empty
+// An empty path is returned if the binary is nowhere to be found.
+func lookBinary(configured, env, name string) (p string, err error) {
+	// Get candidate
+	var source string
+	switch {
+	case len(configured) > 0:
+		p, source = configured, "configuration"
+	case len(os.Getenv(env)) > 0:
+		p, source = os.Getenv(env), "$"+env
+	case len(name) > 0:
+		if p, err = exec.LookPath(name); err != nil {
+			p, err = "", nil
+		}
+		return
+	default:
+		return
+	}
+
+	// Make sure it's executable
+	var lp string
+	if lp, err = exec.LookPath(p); err != nil {
+		err = errors.Wrapf(err, "astiffmpeg: %s from %s is not an executable", p, source)
+		return
+	}
+
+	// Relative paths would be resolved against the working dir
+	if p, err = filepath.Abs(lp); err != nil {
+		err = errors.Wrapf(err, "astiffmpeg: getting absolute path of %s failed", lp)
+		return
+	}
+	return
+}
+
+// checkBinary makes sure the binary is the expected one by running "-version" and returns its output
+func (f *FFMpeg) checkBinary(p, name string) (b []byte, err error) {
+	// Create cmd
+	ctx, cancel := context.WithTimeout(context.Background(), binaryCheckTimeout)
+	defer cancel()
+	var cmd = exec.CommandContext(ctx, p, "-version")
+	cmd.Env = os.Environ()
+	f.adaptCmd(cmd)
+
+	// Run cmd
+	if b, err = cmd.Output(); err != nil {
+		err = errors.Wrapf(err, "astiffmpeg: running %s failed", shellJoin(cmd.Args))
+		return
+	}
+
+	// Check output
+	if !strings.HasPrefix(string(b), name+" version ") {
+		err = errors.Errorf("astiffmpeg: %s is not %s", p, name)
+		return
+	}
+	return
+}
+
+// lookProbeBinary returns the path of the ffprobe binary configured either explicitly or through the environment
+// variable, or shipped next to the ffmpeg binary
+// $PATH is not searched so that both binaries come from the same build. An empty path is returned if there's no
+// matching ffprobe.
+func lookProbeBinary(configured, ffmpegPath string) (p string, err error) {
+	// Configured
+	if p, err = lookBinary(configured, EnvProbeBinaryPath, ""); err != nil || len(p) > 0 {
+		return
+	}
+
+	// Next to ffmpeg, with the same extension such as ".exe"
+	s := filepath.Join(filepath.Dir(ffmpegPath), "ffprobe"+filepath.Ext(ffmpegPath))
+	if _, errStat := os.Stat(s); errStat != nil {
+		return
+	}
+	return lookBinary(s, "", "")
+}
@@ -0,0 +1,513 @@
+package astiffmpeg
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Validation error causes
+// Use them with errors.Is on an error returned by FFMpeg.Validate
+var (
+	ErrUnknownDecoder              = errors.New("astiffmpeg: unknown decoder")
+	ErrUnknownFormat               = errors.New("astiffmpeg: unknown format")
+	ErrUnknownHardwareAcceleration = errors.New("astiffmpeg: unknown hardware acceleration")
+)
+
+// Codec represents an encoder or a decoder listed by "ffmpeg -encoders" or "ffmpeg -decoders"
+type Codec struct {
+	Description  string
+	Experimental bool
+	FrameThreads bool
+	Name         string
+	SliceThreads bool
+	Type         string // One of the ProbeCodecType* constants
+}
+
+// Format represents a format listed by "ffmpeg -formats"
+type Format struct {
+	Demuxing    bool
+	Description string
+	Muxing      bool
+	Names       []string // Formats sharing a demuxer are listed together, e.g. "matroska" and "webm"
+}
+
+// Filter represents a filter listed by "ffmpeg -filters"
+type Filter struct {
+	Commands     bool
+	Description  string
+	Inputs       string // E.g. "V", "AA", "N" for a dynamic number of inputs or "|" for sources
+	Name         string
+	Outputs      string
+	SliceThreads bool
+	Timeline     bool
+}
+
+// PixelFormat represents a pixel format listed by "ffmpeg -pix_fmts"
+type PixelFormat struct {
+	Bitstream    bool
+	BitsPerPixel int
+	Components   int
+	Hardware     bool
+	Input        bool
+	Name         string
+	Output       bool
+	Paletted     bool
+}
+
+// Protocols represents the protocols listed by "ffmpeg -protocols"
+type Protocols struct {
+	Input  []string
+	Output []string
+}
+
+// capabilities caches the capabilities of the binary
+type capabilities struct {
+	avOptions      map[string][]AVOption // Indexed by help topic, e.g. "encoder=libx264"
+	decoders       []Codec
+	encoders       []Codec
+	filters        []Filter
+	formats        []Format
+	genericOptions []AVOption
+	hwaccels       []string
+	m              *sync.Mutex
+	pixFmts        []PixelFormat
+	protocols      *Protocols
+}
+
+func newCapabilities() *capabilities {
+	return &capabilities{
+		avOptions: make(map[string][]AVOption),
+		m:         &sync.Mutex{},
+	}
+}
+
+// capabilityOutput runs ffmpeg with the args and returns its stdout
+func (f *FFMpeg) capabilityOutput(ctx context.Context, args ...string) (b []byte, err error) {
+	var cmd = exec.CommandContext(ctx, f.binaryPath, append([]string{"-hide_banner"}, args...)...)
+	cmd.Env = os.Environ()
+	f.adaptCmd(cmd)
+	if b, err = cmd.Output(); err != nil {
+		err = errors.Wrapf(err, "astiffmpeg: running %s failed", shellJoin(cmd.Args))
+		return
+	}
+	return
+}
+
+// Decoders returns the decoders supported by the binary. Results are cached.
+func (f *FFMpeg) Decoders(ctx context.Context) (cs []Codec, err error) {
+	f.capabilities.m.Lock()
+	defer f.capabilities.m.Unlock()
+	if f.capabilities.decoders == nil {
+		var b []byte
+		if b, err = f.capabilityOutput(ctx, "-decoders"); err != nil {
+			return
+		}
+		f.capabilities.decoders = parseCodecs(b)
+	}
+	return f.capabilities.decoders, nil
+}
+
+// Encoders returns the encoders supported by the binary. Results are cached.
+func (f *FFMpeg) Encoders(ctx context.Context) (cs []Codec, err error) {
+	f.capabilities.m.Lock()
+	defer f.capabilities.m.Unlock()
+	if f.capabilities.encoders == nil {
+		var b []byte
+		if b, err = f.capabilityOutput(ctx, "-encoders"); err != nil {
+			return
+		}
+		f.capabilities.encoders = parseCodecs(b)
+	}
+	return f.capabilities.encoders, nil
+}
+
+// Filters returns the filters supported by the binary. Results are cached.
+func (f *FFMpeg) Filters(ctx context.Context) (fs []Filter, err error) {
+	f.capabilities.m.Lock()
+	defer f.capabilities.m.Unlock()
+	if f.capabilities.filters == nil {
+		var b []byte
+		if b, err = f.capabilityOutput(ctx, "-filters"); err != nil {
+			return
+		}
+		f.capabilities.filters = parseFilters(b)
+	}
+	return f.capabilities.filters, nil
+}
+
+// Formats returns the formats supported by the binary. Results are cached.
+func (f *FFMpeg) Formats(ctx context.Context) (fs []Format, err error) {
+	f.capabilities.m.Lock()
+	defer f.capabilities.m.Unlock()
+	if f.capabilities.formats == nil {
+		var b []byte
+		if b, err = f.capabilityOutput(ctx, "-formats"); err != nil {
+			return
+		}
+		f.capabilities.formats = parseFormats(b)
+	}
+	return f.capabilities.formats, nil
+}
+
+// HardwareAccelerations returns the hardware acceleration methods supported by the binary. Results are cached.
+func (f *FFMpeg) HardwareAccelerations(ctx context.Context) (hs []string, err error) {
+	f.capabilities.m.Lock()
+	defer f.capabilities.m.Unlock()
+	if f.capabilities.hwaccels == nil {
+		var b []byte
+		if b, err = f.capabilityOutput(ctx, "-hwaccels"); err != nil {
+			return
+		}
+		f.capabilities.hwaccels = parseHardwareAccelerations(b)
+	}
+	return f.capabilities.hwaccels, nil
+}
+
+// PixelFormats returns the pixel formats supported by the binary. Results are cached.
+func (f *FFMpeg) PixelFormats(ctx context.Context) (ps []PixelFormat, err error) {
+	f.capabilities.m.Lock()
+	defer f.capabilities.m.Unlock()
+	if f.capabilities.pixFmts == nil {
+		var b []byte
+		if b, err = f.capabilityOutput(ctx, "-pix_fmts"); err != nil {
+			return
+		}
+		f.capabilities.pixFmts = parsePixelFormats(b)
+	}
+	return f.capabilities.pixFmts, nil
+}
+
+// Protocols returns the protocols supported by the binary. Results are cached.
+func (f *FFMpeg) Protocols(ctx context.Context) (p Protocols, err error) {
+	f.capabilities.m.Lock()
+	defer f.capabilities.m.Unlock()
+	if f.capabilities.protocols == nil {
+		var b []byte
+		if b, err = f.capabilityOutput(ctx, "-protocols"); err != nil {
+			return
+		}
+		ps := parseProtocols(b)
+		f.capabilities.protocols = &ps
+	}
+	return *f.capabilities.protocols, nil
+}
+
+// capabilityRows returns the rows following the dashes line, split between their flags and their other fields
+func capabilityRows(b []byte) (rows [][]string) {
+	var width int
+	for _, l := range strings.Split(string(b), "\n") {
+		// Dashes line
+		t := strings.TrimSpace(l)
+		if width == 0 {
+			if len(t) > 0 && strings.Trim(t, "-") == "" {
+				width = len(t)
+			}
+			continue
+		}
+
+		// Row
+		l = strings.TrimPrefix(l, " ")
+		if len(t) == 0 || len(l) <= width {
+			continue
+		}
+		rows = append(rows, append([]string{l[:width]}, strings.Fields(l[width:])...))
+	}
+	return
+}
+
+// capabilityFlag returns whether the flag at position idx is c
+func capabilityFlag(flags string, idx int, c byte) bool {
+	return len(flags) > idx && flags[idx] == c
+}
+
+func parseCodecs(b []byte) (cs []Codec) {
+	cs = []Codec{}
+	for _, r := range capabilityRows(b) {
+		if len(r) < 2 {
+			continue
+		}
+		c := Codec{
+			Description:  strings.Join(r[2:], " "),
+			Experimental: capabilityFlag(r[0], 3, 'X'),
+			FrameThreads: capabilityFlag(r[0], 1, 'F'),
+			Name:         r[1],
+			SliceThreads: capabilityFlag(r[0], 2, 'S'),
+		}
+		switch r[0][0] {
+		case 'A':
+			c.Type = ProbeCodecTypeAudio
+		case 'D':
+			c.Type = ProbeCodecTypeData
+		case 'S':
+			c.Type = ProbeCodecTypeSubtitle
+		case 'T':
+			c.Type = ProbeCodecTypeAttachment
+		case 'V':
+			c.Type = ProbeCodecTypeVideo
+		}
+		cs = append(cs, c)
+	}
+	return
+}
+
+func parseFormats(b []byte) (fs []Format) {
+	fs = []Format{}
+	for _, r := range capabilityRows(b) {
+		if len(r) < 2 {
+			continue
+		}
+		fs = append(fs, Format{
+			Demuxing:    capabilityFlag(r[0], 0, 'D'),
+			Description: strings.Join(r[2:], " "),
+			Muxing:      capabilityFlag(r[0], 1, 'E'),
+			Names:       strings.Split(r[1], ","),
+		})
+	}
+	return
+}
+
+func parseFilters(b []byte) (fs []Filter) {
+	fs = []Filter{}
+	for _, l := range strings.Split(string(b), "\n") {
+		// Filters are the only lines with an io column
+		ps := strings.Fields(l)
+		if len(ps) < 3 || !strings.Contains(ps[2], "->") {
+			continue
+		}
+		io := strings.SplitN(ps[2], "->", 2)
+		fs = append(fs, Filter{
+			Commands:     capabilityFlag(ps[0], 2, 'C'),
+			Description:  strings.Join(ps[3:], " "),
+			Inputs:       io[0],
+			Name:         ps[1],
+			Outputs:      io[1],
+			SliceThreads: capabilityFlag(ps[0], 1, 'S'),
+			Timeline:     capabilityFlag(ps[0], 0, 'T'),
+		})
+	}
+	return
+}
+
+func parseHardwareAccelerations(b []byte) (hs []string) {
+	hs = []string{}
+	for _, l := range strings.Split(string(b), "\n") {
+		if l = strings.TrimSpace(l); len(l) > 0 && !strings.HasSuffix(l, ":") {
+			hs = append(hs, l)
+		}
+	}
+	return
+}
+
+func parsePixelFormats(b []byte) (ps []PixelFormat) {
+	ps = []PixelFormat{}
+	for _, r := range capabilityRows(b) {
+		if len(r) < 4 {
+			continue
+		}
+		p := PixelFormat{
+			Bitstream: capabilityFlag(r[0], 4, 'B'),
+			Hardware:  capabilityFlag(r[0], 2, 'H'),
+			Input:     capabilityFlag(r[0], 0, 'I'),
+			Name:      r[1],
+			Output:    capabilityFlag(r[0], 1, 'O'),
+			Paletted:  capabilityFlag(r[0], 3, 'P'),
+		}
+		p.Components, _ = strconv.Atoi(r[2])
+		p.BitsPerPixel, _ = strconv.Atoi(r[3])
+		ps = append(ps, p)
+	}
+	return
+}
+
+func parseProtocols(b []byte) (p Protocols) {
+	var ps *[]string
+	for _, l := range strings.Split(string(b), "\n") {
+		switch l = strings.TrimSpace(l); l {
+		case "":
+		case "Input:":
+			ps = &p.Input
+		case "Output:":
+			ps = &p.Output
+		default:
+			if ps != nil {
+				*ps = append(*ps, l)
+			}
+		}
+	}
+	return
+}
+
+// ValidationError represents an option that is not supported by the binary
+type ValidationError struct {
+	Cause      error  // One of the ErrUnknown* or ErrInvalidOptionValue causes
+	Option     string // E.g. "output #0 -codec:v"
+	Reason     string // Why the value is invalid
+	Suggestion string // Closest known option when the option is unknown
+	Value      string
+}
+
+// Error implements the error interface
+func (e *ValidationError) Error() string {
+	s := "astiffmpeg: " + e.Option
+	if len(e.Value) > 0 {
+		s += " " + e.Value
+	}
+	s += ": " + e.Cause.Error()
+	if len(e.Reason) > 0 {
+		s += ": " + e.Reason
+	}
+	if len(e.Suggestion) > 0 {
+		s += fmt.Sprintf(", did you mean %s?", e.Suggestion)
+	}
+	return s
+}
+
+// Is allows using errors.Is with the ErrUnknown* and ErrInvalidOptionValue causes
+func (e *ValidationError) Is(target error) bool {
+	return e.Cause == target
+}
+
+// Validate checks the command's codecs, formats, filters, hardware accelerations and customized options against the
+// capabilities of the binary. Options that can't be checked are ignored.
+func (f *FFMpeg) Validate(ctx context.Context, c Command) (err error) {
+	// Inputs
+	for idx, i := range c.Inputs {
+		if i.Options == nil || i.Options.Decoding == nil {
+			continue
+		}
+		d := i.Options.Decoding
+
+		// Hardware acceleration
+		if len(d.HardwareAcceleration) > 0 && d.HardwareAcceleration != "auto" && d.HardwareAcceleration != "none" {
+			var hs []string
+			if hs, err = f.HardwareAccelerations(ctx); err != nil {
+				err = errors.Wrap(err, "astiffmpeg: getting hardware accelerations failed")
+				return
+			}
+			if !containsString(hs, d.HardwareAcceleration) {
+				return &ValidationError{Cause: ErrUnknownHardwareAcceleration, Option: fmt.Sprintf("input #%d -hwaccel", idx), Value: d.HardwareAcceleration}
+			}
+		}
+
+		// Codec
+		if d.Codec != nil {
+			if err = f.validateCodec(ctx, *d.Codec, "-c", fmt.Sprintf("input #%d", idx), f.Decoders, ErrUnknownDecoder); err != nil {
+				return
+			}
+		}
+	}
+
+	// Outputs
+	for idx, o := range c.Outputs {
+		if o.Options == nil {
+			continue
+		}
+		n := fmt.Sprintf("output #%d", idx)
+
+		// Format
+		if len(o.Options.Format) > 0 {
+			var fs []Format
+			if fs, err = f.Formats(ctx); err != nil {
+				err = errors.Wrap(err, "astiffmpeg: getting formats failed")
+				return
+			}
+			var found bool
+			for _, v := range fs {
+				if v.Muxing && containsString(v.Names, o.Options.Format) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return &ValidationError{Cause: ErrUnknownFormat, Option: n + " -f", Value: o.Options.Format}
+			}
+		}
+
+		// Encoding
+		if o.Options.Encoding == nil {
+			continue
+		}
+		for _, so := range o.Options.Encoding.Codec {
+			if err = f.validateCodec(ctx, so, "-codec", n, f.Encoders, ErrUnknownEncoder); err != nil {
+				return
+			}
+		}
+		for _, so := range o.Options.Encoding.Filters {
+			fo, ok := so.Value.(FilterOptions)
+			if !ok {
+				continue
+			}
+			for _, v := range fo.names() {
+				var fs []Filter
+				if fs, err = f.Filters(ctx); err != nil {
+					err = errors.Wrap(err, "astiffmpeg: getting filters failed")
+					return
+				}
+				var found bool
+				for _, fl := range fs {
+					if fl.Name == v {
+						found = true
+						break
+					}
+				}
+				if !found {
+					return &ValidationError{Cause: ErrUnknownFilter, Option: n + " " + streamOptionFlag("-filter", so), Value: v}
+				}
+			}
+		}
+
+		// Customize
+		if len(o.Options.Encoding.Customize) > 0 {
+			if err = f.validateCustomize(ctx, n, *o.Options); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+func (f *FFMpeg) validateCodec(ctx context.Context, so StreamOption, flag, prefix string, fn func(ctx context.Context) ([]Codec, error), cause error) (err error) {
+	// Copy is not a codec
+	v, ok := so.Value.(string)
+	if !ok || v == "copy" {
+		return
+	}
+
+	// Get codecs
+	var cs []Codec
+	if cs, err = fn(ctx); err != nil {
+		err = errors.Wrap(err, "astiffmpeg: getting codecs failed")
+		return
+	}
+
+	// Look for codec
+	for _, c := range cs {
+		if c.Name == v {
+			return
+		}
+	}
+	return &ValidationError{Cause: cause, Option: prefix + " " + streamOptionFlag(flag, so), Value: v}
+}
+
+func streamOptionFlag(name string, so StreamOption) string {
+	if so.Stream != nil {
+		return name + ":" + so.Stream.string()
+	}
+	return name
+}
+
+func containsString(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,149 @@
+package astiffmpeg
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCodecs(t *testing.T) {
+	cs := parseCodecs([]byte(`Encoders:
+ V..... = Video
+ A..... = Audio
+ S..... = Subtitle
+ .F.... = Frame-level multithreading
+ ..S... = Slice-level multithreading
+ ...X.. = Codec is experimental
+ ....B. = Supports draw_horiz_band
+ .....D = Supports direct rendering method 1
+ ------
+ V....D libx264              libx264 H.264 / AVC / MPEG-4 AVC / MPEG-4 part 10 (codec h264)
+ VFS... ffv1                 FFmpeg video codec #1
+ A....D aac                  AAC (Advanced Audio Coding)
+ S..... srt                  SubRip subtitle
+`))
+	assert.Equal(t, []Codec{
+		{Description: "libx264 H.264 / AVC / MPEG-4 AVC / MPEG-4 part 10 (codec h264)", Name: "libx264", Type: ProbeCodecTypeVideo},
+		{Description: "FFmpeg video codec #1", FrameThreads: true, Name: "ffv1", SliceThreads: true, Type: ProbeCodecTypeVideo},
+		{Description: "AAC (Advanced Audio Coding)", Name: "aac", Type: ProbeCodecTypeAudio},
+		{Description: "SubRip subtitle", Name: "srt", Type: ProbeCodecTypeSubtitle},
+	}, cs)
+}
+
+func TestParseFormats(t *testing.T) {
+	fs := parseFormats([]byte(`File formats:
+ D. = Demuxing supported
+ .E = Muxing supported
+ --
+ D  aac             raw ADTS AAC (Advanced Audio Coding)
+  E matroska        Matroska
+ D  matroska,webm   Matroska / WebM
+ DE mpegts          MPEG-TS (MPEG-2 Transport Stream)
+`))
+	assert.Equal(t, []Format{
+		{Demuxing: true, Description: "raw ADTS AAC (Advanced Audio Coding)", Names: []string{"aac"}},
+		{Description: "Matroska", Muxing: true, Names: []string{"matroska"}},
+		{Demuxing: true, Description: "Matroska / WebM", Names: []string{"matroska", "webm"}},
+		{Demuxing: true, Description: "MPEG-TS (MPEG-2 Transport Stream)", Muxing: true, Names: []string{"mpegts"}},
+	}, fs)
+}
+
+func TestParseFilters(t *testing.T) {
+	fs := parseFilters([]byte(`Filters:
+  T.. = Timeline support
+  .S. = Slice threading
+  ..C = Command support
+  A = Audio input/output
+  V = Video input/output
+  N = Dynamic number and/or type of input/output
+  | = Source or sink filter
+ ..C amix              N->A       Audio mixing.
+ .SC scale             V->V       Scale the input video size and/or convert the image format.
+ ... testsrc           |->V       Generate test pattern.
+`))
+	assert.Equal(t, []Filter{
+		{Commands: true, Description: "Audio mixing.", Inputs: "N", Name: "amix", Outputs: "A"},
+		{Commands: true, Description: "Scale the input video size and/or convert the image format.", Inputs: "V", Name: "scale", Outputs: "V", SliceThreads: true},
+		{Description: "Generate test pattern.", Inputs: "|", Name: "testsrc", Outputs: "V"},
+	}, fs)
+}
+
+func TestParseHardwareAccelerations(t *testing.T) {
+	assert.Equal(t, []string{"vdpau", "cuda"}, parseHardwareAccelerations([]byte("Hardware acceleration methods:\nvdpau\ncuda\n\n")))
+}
+
+func TestParsePixelFormats(t *testing.T) {
+	ps := parsePixelFormats([]byte(`Pixel formats:
+I.... = Supported Input  format for conversion
+.O... = Supported Output format for conversion
+..H.. = Hardware accelerated format
+...P. = Paletted format
+....B = Bitstream format
+FLAGS NAME            NB_COMPONENTS BITS_PER_PIXEL
+-----
+IO... yuv420p                3            12
+..H.. cuda                   0             0
+`))
+	assert.Equal(t, []PixelFormat{
+		{BitsPerPixel: 12, Components: 3, Input: true, Name: "yuv420p", Output: true},
+		{Hardware: true, Name: "cuda"},
+	}, ps)
+}
+
+func TestParseProtocols(t *testing.T) {
+	assert.Equal(t, Protocols{
+		Input:  []string{"file", "http"},
+		Output: []string{"file", "rtmp"},
+	}, parseProtocols([]byte("Supported file protocols:\nInput:\n  file\n  http\nOutput:\n  file\n  rtmp\n")))
+}
+
+func TestFFMpegValidate(t *testing.T) {
+	p, cleanup := newTestBinary(t, `case "$2" in
+-encoders) printf ' ------\n V....D libx264 libx264\n' ;;
+-decoders) printf ' ------\n V....D h264 H.264\n' ;;
+-formats) printf ' --\n DE mp4 MP4\n' ;;
+-filters) printf ' ... setsar V->V Set the pixel sample aspect ratio.\n' ;;
+-hwaccels) printf 'Hardware acceleration methods:\ncuda\n' ;;
+*) exit 1 ;;
+esac
+`)
+	defer cleanup()
+	f := newTestFFMpeg(t, Configuration{BinaryPath: p})
+	c := Command{
+		Inputs: []Input{{Options: &InputOptions{Decoding: &DecodingOptions{
+			Codec:                &StreamOption{Value: "h264"},
+			HardwareAcceleration: "cuda",
+		}}}},
+		Outputs: []Output{{Options: &OutputOptions{
+			Encoding: &EncodingOptions{
+				Codec:   []StreamOption{{Stream: &StreamSpecifier{Type: StreamSpecifierTypeVideo}, Value: "libx264"}, {Value: "copy"}},
+				Filters: []StreamOption{{Value: FilterOptions{SAR: &Ratio{Antecedent: 1, Consequent: 1}}}},
+			},
+			Format: "mp4",
+		}}},
+	}
+	assert.NoError(t, f.Validate(context.Background(), c))
+
+	// Unknown
+	c.Inputs[0].Options.Decoding.HardwareAcceleration = "vaapi"
+	err := f.Validate(context.Background(), c)
+	assert.True(t, errors.Is(err, ErrUnknownHardwareAcceleration))
+	c.Inputs[0].Options.Decoding.HardwareAcceleration = ""
+	c.Outputs[0].Options.Encoding.Codec[0].Value = "libx265"
+	err = f.Validate(context.Background(), c)
+	assert.True(t, errors.Is(err, ErrUnknownEncoder))
+	assert.EqualError(t, err, "astiffmpeg: output #0 -codec:v libx265: astiffmpeg: unknown encoder")
+	c.Outputs[0].Options.Encoding.Codec[0].Value = "libx264"
+	c.Outputs[0].Options.Encoding.Filters[0].Value = FilterOptions{ScaleNPP: &Scale{Width: 1280, Height: 720}}
+	assert.True(t, errors.Is(f.Validate(context.Background(), c), ErrUnknownFilter))
+	c.Outputs[0].Options.Encoding.Filters = nil
+	c.Outputs[0].Options.Format = "webm"
+	assert.True(t, errors.Is(f.Validate(context.Background(), c), ErrUnknownFormat))
+
+	// Start
+	f.SetValidation(true)
+	_, err = f.Start(context.Background(), c)
+	assert.True(t, errors.Is(err, ErrUnknownFormat))
+}
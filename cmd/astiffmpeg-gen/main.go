@@ -0,0 +1,409 @@
+// Command astiffmpeg-gen generates typed option structs out of the output of "ffmpeg -h full"
+//
+// Encoder and muxer structs implement astiffmpeg.PrivateOptions and can be added to OutputOptions.Private, filter
+// structs implement fmt.Stringer and can be added to FilterOptions.Filters or used as a FilterNode.Filter.
+//
+// Usage:
+//
+//	ffmpeg -hide_banner -h full > testdata/ffmpeg-help-full.txt
+//
+// Full captures being large, they can be checked in gzip compressed and provided with a .gz extension.
+//	astiffmpeg-gen -i testdata/ffmpeg-help-full.txt -o options_gen.go -encoders libx264,aac -muxers hls,mp4 -filters eq
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	astiffmpeg "github.com/ctaccel/go-astiffmpeg"
+	"github.com/pkg/errors"
+)
+
+// Flags
+var (
+	encoders = flag.String("encoders", "", "comma separated list of encoders")
+	filters  = flag.String("filters", "", "comma separated list of filters")
+	input    = flag.String("i", "", "path to the captured output of \"ffmpeg -h full\", gzip compressed if it ends with .gz")
+	muxers   = flag.String("muxers", "", "comma separated list of muxers")
+	output   = flag.String("o", "", "path to the generated file, stdout if empty")
+	pkg      = flag.String("p", "astiffmpeg", "package of the generated file")
+)
+
+// Component kinds
+const (
+	kindEncoder = "encoder"
+	kindFilter  = "filter"
+	kindMuxer   = "muxer"
+)
+
+// config represents what should be generated
+type config struct {
+	encoders []string
+	filters  []string
+	muxers   []string
+	pkg      string
+	source   string // Base name of the help file mentioned in the header
+}
+
+func main() {
+	// Parse flags
+	flag.Parse()
+	if len(*input) == 0 {
+		log.Fatal("astiffmpeg-gen: -i is mandatory")
+	}
+
+	// Read help
+	b, err := readHelp(*input)
+	if err != nil {
+		log.Fatal(errors.Wrapf(err, "astiffmpeg-gen: reading %s failed", *input))
+	}
+
+	// Generate
+	var g []byte
+	if g, err = generate(b, config{
+		encoders: splitList(*encoders),
+		filters:  splitList(*filters),
+		muxers:   splitList(*muxers),
+		pkg:      *pkg,
+		source:   *input,
+	}); err != nil {
+		log.Fatal(errors.Wrap(err, "astiffmpeg-gen: generating failed"))
+	}
+
+	// Write
+	if len(*output) == 0 {
+		fmt.Print(string(g))
+		return
+	}
+	if err = ioutil.WriteFile(*output, g, 0644); err != nil {
+		log.Fatal(errors.Wrapf(err, "astiffmpeg-gen: writing %s failed", *output))
+	}
+}
+
+// readHelp reads the captured help, decompressing it if needed
+func readHelp(path string) (b []byte, err error) {
+	// Open
+	var f *os.File
+	if f, err = os.Open(path); err != nil {
+		return
+	}
+	defer f.Close()
+
+	// Not compressed
+	if filepath.Ext(path) != ".gz" {
+		return ioutil.ReadAll(f)
+	}
+
+	// Decompress
+	var r *gzip.Reader
+	if r, err = gzip.NewReader(f); err != nil {
+		return
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+func splitList(i string) (o []string) {
+	for _, v := range strings.Split(i, ",") {
+		if v = strings.TrimSpace(v); len(v) > 0 {
+			o = append(o, v)
+		}
+	}
+	return
+}
+
+// generate returns the formatted Go source of the option structs
+func generate(b []byte, c config) (o []byte, err error) {
+	// Parse help
+	ss := astiffmpeg.ParseAVOptions(b)
+
+	// Generate components
+	g := &generator{imports: map[string]bool{}}
+	for _, v := range []struct {
+		kind  string
+		names []string
+	}{
+		{kind: kindEncoder, names: c.encoders},
+		{kind: kindMuxer, names: c.muxers},
+		{kind: kindFilter, names: c.filters},
+	} {
+		for _, n := range v.names {
+			var os []astiffmpeg.AVOption
+			var ok bool
+			if os, ok = lookupSection(ss, v.kind, n); !ok {
+				err = errors.Errorf("astiffmpeg-gen: no AVOptions section found for %s %s", v.kind, n)
+				return
+			}
+			g.component(v.kind, n, os)
+		}
+	}
+
+	// Header
+	var h = &bytes.Buffer{}
+	fmt.Fprintf(h, "// Code generated by astiffmpeg-gen from %s. DO NOT EDIT.\n\n", c.source)
+	fmt.Fprintf(h, "package %s\n\n", c.pkg)
+	if len(g.imports) > 0 {
+		var is []string
+		for k := range g.imports {
+			is = append(is, k)
+		}
+		sort.Strings(is)
+		fmt.Fprintf(h, "import (\n")
+		for _, i := range is {
+			fmt.Fprintf(h, "%q\n", i)
+		}
+		fmt.Fprintf(h, ")\n\n")
+	}
+	h.Write(g.buf.Bytes())
+
+	// Format
+	if o, err = format.Source(h.Bytes()); err != nil {
+		err = errors.Wrap(err, "astiffmpeg-gen: formatting source failed")
+		return
+	}
+	return
+}
+
+// lookupSection returns the options of the component
+// Sections are named either after the component ("libx264", "scale"), after its long name followed by its kind
+// ("AAC encoder") or after all its aliases followed by its kind ("mov/mp4/ipod muxer").
+func lookupSection(ss map[string][]astiffmpeg.AVOption, kind, name string) ([]astiffmpeg.AVOption, bool) {
+	if os, ok := ss[name]; ok {
+		return os, true
+	}
+	var ks []string
+	for k := range ss {
+		ks = append(ks, k)
+	}
+	sort.Strings(ks)
+	for _, k := range ks {
+		if !strings.HasSuffix(k, " "+kind) {
+			continue
+		}
+		for _, a := range strings.Split(strings.ToLower(strings.TrimSuffix(k, " "+kind)), "/") {
+			if a == name {
+				return ss[k], true
+			}
+		}
+	}
+	return nil, false
+}
+
+// field represents a generated struct field
+type field struct {
+	goName string
+	goType string
+	o      astiffmpeg.AVOption
+}
+
+type generator struct {
+	buf     bytes.Buffer
+	imports map[string]bool
+}
+
+func (g *generator) p(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format+"\n", args...)
+}
+
+func (g *generator) component(kind, name string, os []astiffmpeg.AVOption) {
+	// Get fields
+	var fs []field
+	var names = map[string]bool{}
+	for _, o := range os {
+		n := goName(o.Name)
+		if kind == kindEncoder && n == "Stream" {
+			n = "StreamOption"
+		}
+		if names[n] {
+			continue
+		}
+		names[n] = true
+		fs = append(fs, field{goName: n, goType: g.goType(o), o: o})
+	}
+	sort.Slice(fs, func(i, j int) bool { return fs[i].goName < fs[j].goName })
+
+	// Struct
+	t := goName(name) + goName(kind) + "Options"
+	g.p("// %s represents the options of the %s %s", t, name, kind)
+	g.p("type %s struct {", t)
+	for _, f := range fs {
+		if d := fieldDoc(f.o); len(d) > 0 {
+			g.p("// %s", d)
+		}
+		g.p("%s %s", f.goName, f.goType)
+	}
+	if kind == kindEncoder {
+		g.p("// Restricts the options to the matching output streams")
+		g.p("Stream *StreamSpecifier")
+	}
+	g.p("}\n")
+
+	// Render
+	switch kind {
+	case kindFilter:
+		g.p("// String implements the fmt.Stringer interface")
+		g.p("func (o %s) String() string {", t)
+		g.p("var os filterOptions")
+		for _, f := range fs {
+			g.p("if %s {", f.isSet())
+			g.p("os.add(%q, %s)", f.o.Name, f.value())
+			g.p("}")
+		}
+		g.p("return filterString(%q, os)", name)
+		g.p("}\n")
+	default:
+		g.imports["os/exec"] = true
+		g.p("func (o %s) adaptCmd(cmd *exec.Cmd) {", t)
+		for _, f := range fs {
+			g.p("if %s {", f.isSet())
+			if kind == kindEncoder {
+				g.p("cmd.Args = append(cmd.Args, avOptionFlag(%q, o.Stream), %s)", f.o.Name, f.value())
+			} else {
+				g.p("cmd.Args = append(cmd.Args, %q, %s)", "-"+f.o.Name, f.value())
+			}
+			g.p("}")
+		}
+		g.p("}\n")
+	}
+
+	// Constants
+	for _, f := range fs {
+		if len(f.o.Constants) == 0 {
+			continue
+		}
+		g.p("// %s %s %s values", goName(name), kind, f.o.Name)
+		g.p("const (")
+		var cs = map[string]bool{}
+		for _, c := range f.o.Constants {
+			n := t[:len(t)-len("Options")] + f.goName + goName(c.Name)
+			if cs[n] {
+				continue
+			}
+			cs[n] = true
+			if len(c.Description) > 0 {
+				g.p("// %s", sentence(c.Description))
+			}
+			g.p("%s = %q", n, c.Name)
+		}
+		g.p(")\n")
+	}
+}
+
+// goType returns the Go type of the option's field
+// Numeric options with named values are strings so that both names and numbers can be used.
+func (g *generator) goType(o astiffmpeg.AVOption) string {
+	if len(o.Constants) > 0 && o.Type != astiffmpeg.AVOptionTypeFlags {
+		return "string"
+	}
+	switch o.Type {
+	case astiffmpeg.AVOptionTypeBoolean:
+		g.imports["strconv"] = true
+		return "*bool"
+	case astiffmpeg.AVOptionTypeDictionary:
+		return "map[string]string"
+	case astiffmpeg.AVOptionTypeDouble, astiffmpeg.AVOptionTypeFloat:
+		g.imports["strconv"] = true
+		return "*float64"
+	case astiffmpeg.AVOptionTypeDuration:
+		g.imports["strconv"] = true
+		g.imports["time"] = true
+		return "*time.Duration"
+	case astiffmpeg.AVOptionTypeFlags:
+		return "[]string"
+	case astiffmpeg.AVOptionTypeInt:
+		g.imports["strconv"] = true
+		return "*int"
+	case astiffmpeg.AVOptionTypeInt64:
+		g.imports["strconv"] = true
+		return "*int64"
+	case astiffmpeg.AVOptionTypeUint64:
+		g.imports["strconv"] = true
+		return "*uint64"
+	default:
+		return "string"
+	}
+}
+
+func (f field) isSet() string {
+	switch f.goType {
+	case "string", "[]string", "map[string]string":
+		return "len(o." + f.goName + ") > 0"
+	default:
+		return "o." + f.goName + " != nil"
+	}
+}
+
+func (f field) value() string {
+	v := "o." + f.goName
+	switch f.goType {
+	case "*bool":
+		return "strconv.FormatBool(*" + v + ")"
+	case "*float64":
+		return "strconv.FormatFloat(*" + v + ", 'f', -1, 64)"
+	case "*int":
+		return "strconv.Itoa(*" + v + ")"
+	case "*int64":
+		return "strconv.FormatInt(*" + v + ", 10)"
+	case "*time.Duration":
+		return "strconv.FormatFloat(" + v + ".Seconds(), 'f', -1, 64)"
+	case "*uint64":
+		return "strconv.FormatUint(*" + v + ", 10)"
+	case "[]string":
+		return "avOptionFlags(" + v + ")"
+	case "map[string]string":
+		return "avOptionDictionary(" + v + ")"
+	default:
+		return v
+	}
+}
+
+// fieldDoc returns the doc comment of the option's field
+func fieldDoc(o astiffmpeg.AVOption) string {
+	var ss []string
+	if len(o.Description) > 0 {
+		ss = append(ss, sentence(o.Description))
+	}
+	if len(o.Default) > 0 {
+		ss = append(ss, fmt.Sprintf("Defaults to %s.", o.Default))
+	}
+	return strings.Join(ss, " ")
+}
+
+// sentence capitalizes the description and ends it with a period
+func sentence(i string) string {
+	rs := []rune(strings.TrimSpace(i))
+	if len(rs) == 0 {
+		return ""
+	}
+	rs[0] = unicode.ToUpper(rs[0])
+	if s := string(rs); !strings.HasSuffix(s, ".") {
+		return s + "."
+	}
+	return string(rs)
+}
+
+// goName converts an ffmpeg name such as "aq-mode" or "hls_time" into an exported Go name such as "AqMode" or
+// "HlsTime"
+func goName(i string) string {
+	var b strings.Builder
+	for _, w := range strings.FieldsFunc(i, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }) {
+		rs := []rune(strings.ToLower(w))
+		rs[0] = unicode.ToUpper(rs[0])
+		b.WriteString(string(rs))
+	}
+	s := b.String()
+	if len(s) > 0 && unicode.IsDigit([]rune(s)[0]) {
+		s = "N" + s
+	}
+	return s
+}
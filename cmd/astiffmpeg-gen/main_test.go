@@ -0,0 +1,63 @@
+package main
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerate(t *testing.T) {
+	// Generated file must be up to date with the captured help
+	b, err := ioutil.ReadFile("../../testdata/ffmpeg-help-full.txt")
+	assert.NoError(t, err)
+	g, err := generate(b, config{
+		encoders: []string{"aac", "libx264"},
+		filters:  []string{"eq"},
+		muxers:   []string{"hls", "mp4"},
+		pkg:      "astiffmpeg",
+		source:   "testdata/ffmpeg-help-full.txt",
+	})
+	assert.NoError(t, err)
+	e, err := ioutil.ReadFile("../../options_gen.go")
+	assert.NoError(t, err)
+	assert.Equal(t, string(e), string(g), "options_gen.go is out of date, run go generate")
+
+	// Unknown component
+	_, err = generate(b, config{encoders: []string{"libx265"}, pkg: "astiffmpeg"})
+	assert.EqualError(t, err, "astiffmpeg-gen: no AVOptions section found for encoder libx265")
+}
+
+func TestReadHelp(t *testing.T) {
+	e, err := ioutil.ReadFile("../../testdata/ffmpeg-help-full.txt")
+	assert.NoError(t, err)
+	b, err := readHelp("../../testdata/ffmpeg-help-full.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, e, b)
+
+	// Compressed
+	d, err := ioutil.TempDir("", "astiffmpeg-gen")
+	assert.NoError(t, err)
+	defer os.RemoveAll(d)
+	p := filepath.Join(d, "ffmpeg-help-full.txt.gz")
+	f, err := os.Create(p)
+	assert.NoError(t, err)
+	w := gzip.NewWriter(f)
+	_, err = w.Write(e)
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+	assert.NoError(t, f.Close())
+	b, err = readHelp(p)
+	assert.NoError(t, err)
+	assert.Equal(t, e, b)
+}
+
+func TestGoName(t *testing.T) {
+	assert.Equal(t, "AqMode", goName("aq-mode"))
+	assert.Equal(t, "HlsSegmentFilename", goName("hls_segment_filename"))
+	assert.Equal(t, "X264Params", goName("x264-params"))
+	assert.Equal(t, "N2pass", goName("2pass"))
+}
@@ -0,0 +1,190 @@
+package astiffmpeg
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/asticode/go-astilog"
+	"github.com/pkg/errors"
+)
+
+// Command represents an ffmpeg command
+// ffmpeg [global_options] {[input_file_options] -i input_url} ... [-filter_complex filtergraph] {[output_file_options] output_url} ...
+type Command struct {
+	// Can't be used with FilterGraph
+	ComplexFilter *ComplexFilterOptions
+	// Expected duration of the outputs, used to compute progress percent and ETA. It is not rendered. When zero, the
+	// inputs are probed if a Probe has been set on FFMpeg.
+	Duration time.Duration
+	// Rendered as -filter_complex. Labels must be consumed exactly once, either by a filter or by an output mapping
+	// them with "-map [label]".
+	FilterGraph *FilterGraph
+	Global      GlobalOptions
+	Inputs      []Input
+	Outputs     []Output
+	// Executed for each block of -progress output of this command, in addition to the handler set on FFMpeg. It is not
+	// rendered.
+	ProgressHandler func(p Progress)
+	// Overrides the retry policy set on FFMpeg. It is not rendered.
+	RetryPolicy *RetryPolicy
+	// Max duration of the job after which it is stopped gracefully. Overrides Configuration.Timeout. It is not rendered.
+	Timeout time.Duration
+	// Processes the stderr lines of this command only, in addition to the parser set on FFMpeg
+	stdErrParser StdErrParser
+}
+
+// adaptCmd renders the command. Options depending on the ffmpeg version are rendered for the latest version when v is
+// nil.
+func (c Command) adaptCmd(cmd *exec.Cmd, v *Version) (err error) {
+	// Global options
+	if err = c.Global.adaptCmd(cmd, v); err != nil {
+		err = errors.Wrap(err, "astiffmpeg: adapting cmd for global options failed")
+		return
+	}
+
+	// Get pipes
+	inputPipes, outputPipes := c.pipes()
+
+	// Inputs
+	for idx, i := range c.Inputs {
+		if p, ok := inputPipes[idx]; ok {
+			i.Path = p.url()
+		}
+		if err = i.adaptCmd(cmd); err != nil {
+			err = errors.Wrapf(err, "astiffmpeg: adapting cmd for input #%d failed", idx)
+			return
+		}
+	}
+
+	// Filter graph
+	var g *FilterGraph
+	if g, err = c.filterGraph(); err != nil {
+		return
+	} else if g != nil {
+		if err = g.validate(c.mappedLabels()); err != nil {
+			err = errors.Wrap(err, "astiffmpeg: validating filter graph failed")
+			return
+		}
+		cmd.Args = append(cmd.Args, "-filter_complex", g.string())
+	}
+
+	// Outputs
+	// Overwriting is handled by the global options when set, since ffmpeg would otherwise get both -n and -y
+	for idx, o := range c.Outputs {
+		if p, ok := outputPipes[idx]; ok {
+			o.Path = p.url()
+		}
+		if err = o.adaptCmd(cmd, v, c.Global.Overwrite == nil); err != nil {
+			err = errors.Wrapf(err, "astiffmpeg: adapting cmd for output #%d failed", idx)
+			return
+		}
+	}
+	return
+}
+
+// filterGraph returns the filter graph built either with FilterGraph or with ComplexFilter
+func (c Command) filterGraph() (g *FilterGraph, err error) {
+	switch {
+	case c.ComplexFilter != nil && c.FilterGraph != nil:
+		err = errors.New("astiffmpeg: ComplexFilter and FilterGraph can't be used together")
+	case c.ComplexFilter != nil:
+		var cg FilterGraph
+		if cg, err = c.ComplexFilter.graph(); err != nil {
+			err = errors.Wrap(err, "astiffmpeg: converting complex filter failed")
+			return
+		}
+		if len(cg.Chains) > 0 {
+			g = &cg
+		}
+	case c.FilterGraph != nil:
+		g = c.FilterGraph
+	}
+	return
+}
+
+// mappedLabels returns the filter graph labels mapped by outputs
+func (c Command) mappedLabels() (ls []string) {
+	for _, o := range c.Outputs {
+		if o.Options == nil {
+			continue
+		}
+		var ms []string
+		if o.Options.Map != nil {
+			for _, m := range *o.Options.Map {
+				ms = append(ms, m.Name)
+			}
+		}
+		for idx := 0; idx < len(o.Options.Extra)-1; idx++ {
+			if o.Options.Extra[idx] == "-map" {
+				ms = append(ms, o.Options.Extra[idx+1])
+			}
+		}
+		for _, m := range ms {
+			if strings.HasPrefix(m, "[") && strings.HasSuffix(m, "]") {
+				ls = append(ls, m[1:len(m)-1])
+			}
+		}
+	}
+	return
+}
+
+// versionGated returns whether rendering the command depends on the ffmpeg version
+func (c Command) versionGated() bool {
+	if c.Global.StatsPeriod.Duration > 0 {
+		return true
+	}
+	for _, o := range c.Outputs {
+		if o.Options != nil && o.Options.Encoding != nil && (len(o.Options.Encoding.FPSMode) > 0 || len(o.Options.Encoding.HlsSegmentType) > 0) {
+			return true
+		}
+	}
+	return false
+}
+
+// expectedDuration returns the expected duration of the outputs, or 0 if it is unknown
+// Inputs durations are trimmed by their decoding options and the longest one wins. adapt is applied to the probe cmd
+// so that relative paths and environment variables are the same as ffmpeg's.
+func (c Command) expectedDuration(ctx context.Context, p *Probe, adapt func(cmd *exec.Cmd)) (d time.Duration) {
+	// Duration is known
+	if c.Duration > 0 {
+		return c.Duration
+	}
+
+	// Loop through inputs
+	for idx, i := range c.Inputs {
+		// Probe
+		var id time.Duration
+		var known bool
+		if p != nil && i.Reader == nil {
+			if r, err := p.exec(ctx, i.Path, adapt); err != nil {
+				astilog.Error(errors.Wrapf(err, "astiffmpeg: probing input #%d failed", idx))
+			} else if r.Format.Duration != nil {
+				id, known = *r.Format.Duration, true
+			}
+		}
+
+		// Trim
+		if i.Options != nil && i.Options.Decoding != nil {
+			if len(i.Options.Decoding.Position) > 0 && known {
+				if ss, err := parseDuration(i.Options.Decoding.Position); err == nil {
+					if id -= ss; id < 0 {
+						id = 0
+					}
+				}
+			}
+			if len(i.Options.Decoding.Duration) > 0 {
+				if t, err := parseDuration(i.Options.Decoding.Duration); err == nil && (!known || t < id) {
+					id, known = t, true
+				}
+			}
+		}
+
+		// Longest input wins
+		if known && id > d {
+			d = id
+		}
+	}
+	return
+}
@@ -0,0 +1,78 @@
+package astiffmpeg
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/asticode/go-astitools/ptr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommand(t *testing.T) {
+	cmd := exec.Command("ffmpeg")
+	err := Command{
+		ComplexFilter: &ComplexFilterOptions{ComplexFilters: []ComplexFilter{{
+			Filters:       []string{"scale=1280:720"},
+			InputStreams:  []StreamSpecifier{{Index: astiptr.Int(0), Type: "0:v"}},
+			OutputStreams: []StreamSpecifier{{Name: "out"}},
+		}}},
+		Global:  GlobalOptions{NoStats: true},
+		Inputs:  []Input{{Path: "input.mp4"}},
+		Outputs: []Output{{Options: &OutputOptions{Map: &MapOptions{{Name: "[out]"}}}, Path: "output.mp4"}},
+	}.adaptCmd(cmd, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ffmpeg", "-hide_banner", "-nostats", "-i", "input.mp4", "-filter_complex", "[0:v:0]scale=1280:720[out]", "-map", "[out]", "-y", "output.mp4"}, cmd.Args)
+}
+
+func TestCommandExpectedDuration(t *testing.T) {
+	assert.Equal(t, time.Minute, Command{Duration: time.Minute}.expectedDuration(context.Background(), nil, nil))
+	assert.Equal(t, time.Duration(0), Command{Inputs: []Input{{Path: "input.mp4"}}}.expectedDuration(context.Background(), nil, nil))
+	assert.Equal(t, 90*time.Second, Command{Inputs: []Input{
+		{Options: &InputOptions{Decoding: &DecodingOptions{Duration: "30"}}, Path: "input1.mp4"},
+		{Options: &InputOptions{Decoding: &DecodingOptions{Duration: "00:01:30", Position: "10"}}, Path: "input2.mp4"},
+	}}.expectedDuration(context.Background(), nil, nil))
+
+	// Probe
+	p, cleanup := newTestBinary(t, `echo '{"format": {"duration": "120.000000"}}'`)
+	defer cleanup()
+	assert.Equal(t, 90*time.Second, Command{Inputs: []Input{
+		{Options: &InputOptions{Decoding: &DecodingOptions{Position: "30"}}, Path: "input.mp4"},
+	}}.expectedDuration(context.Background(), NewProbe(ProbeConfiguration{BinaryPath: p}), nil))
+
+	// Working dir and environment
+	p, cleanup = newTestBinary(t, `for i; do :; done
+if [ -f "$i" ] && [ "$A" = "a" ]; then
+	echo '{"format": {"duration": "120.000000"}}'
+fi
+`)
+	defer cleanup()
+	f := &FFMpeg{env: map[string]string{"A": "a"}, workingDir: filepath.Dir(p)}
+	assert.Equal(t, 2*time.Minute, Command{Inputs: []Input{{Path: "ffmpeg"}}}.expectedDuration(context.Background(), NewProbe(ProbeConfiguration{BinaryPath: p}), f.adaptCmd))
+}
+
+func TestFFMpegExpectedDuration(t *testing.T) {
+	p, cleanup := newTestBinary(t, `echo '{"format": {"duration": "120.000000"}}'`)
+	defer cleanup()
+	f := newTestFFMpeg(t, Configuration{BinaryPath: p})
+	f.SetProbe(NewProbe(ProbeConfiguration{BinaryPath: p}))
+	c := Command{Inputs: []Input{{Path: "input.mp4"}}}
+
+	// Disabled by default
+	assert.Equal(t, time.Duration(0), f.expectedDuration(context.Background(), c))
+
+	// Enabled
+	f.SetDurationProbing(true, 0)
+	assert.Equal(t, 2*time.Minute, f.expectedDuration(context.Background(), c))
+
+	// Timeout
+	p, cleanup = newTestBinary(t, `trap 'exit 255' INT
+while true; do sleep 0.01; done
+`)
+	defer cleanup()
+	f.SetProbe(NewProbe(ProbeConfiguration{BinaryPath: p}))
+	f.SetDurationProbing(true, 50*time.Millisecond)
+	assert.Equal(t, time.Duration(0), f.expectedDuration(context.Background(), c))
+}
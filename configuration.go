@@ -1,20 +1,134 @@
 package astiffmpeg
 
-import "flag"
+import (
+	"flag"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/asticode/go-astilog"
+	"github.com/pkg/errors"
+)
+
+// Default stop timeouts
+const (
+	DefaultStopGracePeriod = 10 * time.Second
+	DefaultStopKillTimeout = 5 * time.Second
+)
 
 // Flags
 var (
-	BinaryPath = flag.String("ffmpeg-binary-path", "", "the FFMpeg binary path")
+	BinaryPath              = flag.String("ffmpeg-binary-path", "", "the FFMpeg binary path")
+	Env                     = flag.String("ffmpeg-env", "", "comma separated KEY=VALUE environment variables set for every FFMpeg process")
+	LogLevel                = flag.String("ffmpeg-log-level", "", "the FFMpeg log level")
+	MaxConcurrentExecutions = flag.Int("ffmpeg-max-concurrent-executions", 0, "the max number of FFMpeg processes running at the same time")
+	NoStats                 = flag.Bool("ffmpeg-no-stats", false, "whether FFMpeg should not print encoding progress/statistics")
+	Overwrite               = flag.String("ffmpeg-overwrite", "", "whether FFMpeg should overwrite outputs (true) or never overwrite them (false)")
+	ProbeBinaryPath         = flag.String("ffprobe-binary-path", "", "the FFProbe binary path")
+	StopGracePeriod         = flag.Duration("ffmpeg-stop-grace-period", 0, "the time given to FFMpeg to finalize its outputs after being asked to quit")
+	StopKillTimeout         = flag.Duration("ffmpeg-stop-kill-timeout", 0, "the time given to FFMpeg to exit after being interrupted")
+	TempDir                 = flag.String("ffmpeg-temp-dir", "", "the FFMpeg temp dir")
+	Timeout                 = flag.Duration("ffmpeg-timeout", 0, "the max duration of an FFMpeg job")
+	WorkingDir              = flag.String("ffmpeg-working-dir", "", "the FFMpeg working dir")
 )
 
+// Duration represents a duration that can be decoded from strings such as "1m30s", see time.ParseDuration
+type Duration struct {
+	time.Duration
+}
+
+// MarshalText implements the encoding.TextMarshaler interface
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface
+func (d *Duration) UnmarshalText(b []byte) (err error) {
+	if d.Duration, err = time.ParseDuration(string(b)); err != nil {
+		err = errors.Wrapf(err, "astiffmpeg: parsing duration %s failed", b)
+		return
+	}
+	return
+}
+
 // Configuration represents the ffmpeg configuration
+// Values set per call take precedence over the configuration ones, which take precedence over ffmpeg's defaults:
+//   - Command.Global options that are set (non-empty strings, non-nil pointers, non-zero durations) override
+//     Configuration.Global ones. Boolean options enabled in the configuration can't be disabled per call. Extra
+//     options of both are rendered, the configuration ones first.
+//   - Command.Timeout overrides Configuration.Timeout. A context deadline applies in any case.
+//   - Environment variables set by commands (such as LogOptions.Color) override Configuration.Env, which overrides
+//     the $TMPDIR set by Configuration.TempDir, which overrides the environment of the current process.
 type Configuration struct {
+	// Defaults to $FFMPEG_PATH, then to the ffmpeg binary found in $PATH
 	BinaryPath string `toml:"binary_path"`
+	// Environment variables set for every ffmpeg process
+	Env map[string]string `toml:"env"`
+	// Global options applied to every command
+	Global GlobalOptions `toml:"global"`
+	// Max number of ffmpeg processes running at the same time. Start blocks until a job ends when it is reached.
+	// Defaults to no limit.
+	MaxConcurrentExecutions int `toml:"max_concurrent_executions"`
+	// Defaults to $FFPROBE_PATH, then to the ffprobe binary next to the ffmpeg binary
+	ProbeBinaryPath string `toml:"probe_binary_path"`
+	// When a job is stopped, "q" is written to ffmpeg's stdin so that it finalizes its outputs. If ffmpeg has not
+	// exited after StopGracePeriod, it is sent SIGINT. Defaults to DefaultStopGracePeriod.
+	StopGracePeriod Duration `toml:"stop_grace_period"`
+	// If ffmpeg has not exited StopKillTimeout after SIGINT, it is killed. Defaults to DefaultStopKillTimeout.
+	StopKillTimeout Duration `toml:"stop_kill_timeout"`
+	// Exported to ffmpeg processes as $TMPDIR
+	TempDir string `toml:"temp_dir"`
+	// Max duration of a job after which it is stopped gracefully. Defaults to no timeout.
+	Timeout Duration `toml:"timeout"`
+	// Directory ffmpeg processes are run in, relative paths are resolved against it. Defaults to the current
+	// working directory.
+	WorkingDir string `toml:"working_dir"`
 }
 
 // FlagConfig generates a Configuration based on flags
-func FlagConfig() Configuration {
-	return Configuration{
-		BinaryPath: *BinaryPath,
+func FlagConfig() (c Configuration) {
+	c = Configuration{
+		BinaryPath:              *BinaryPath,
+		Global:                  GlobalOptions{NoStats: *NoStats},
+		MaxConcurrentExecutions: *MaxConcurrentExecutions,
+		ProbeBinaryPath:         *ProbeBinaryPath,
+		StopGracePeriod:         Duration{Duration: *StopGracePeriod},
+		StopKillTimeout:         Duration{Duration: *StopKillTimeout},
+		TempDir:                 *TempDir,
+		Timeout:                 Duration{Duration: *Timeout},
+		WorkingDir:              *WorkingDir,
+	}
+	if len(*Env) > 0 {
+		c.Env = make(map[string]string)
+		for _, e := range strings.Split(*Env, ",") {
+			if p := strings.SplitN(e, "=", 2); len(p) == 2 {
+				c.Env[p[0]] = p[1]
+			} else {
+				astilog.Errorf("astiffmpeg: invalid environment variable %s", e)
+			}
+		}
+	}
+	if len(*LogLevel) > 0 {
+		c.Global.Log = &LogOptions{Level: *LogLevel}
+	}
+	if len(*Overwrite) > 0 {
+		if b, err := strconv.ParseBool(*Overwrite); err != nil {
+			astilog.Error(errors.Wrapf(err, "astiffmpeg: parsing overwrite flag %s failed", *Overwrite))
+		} else {
+			c.Global.Overwrite = &b
+		}
+	}
+	return
+}
+
+// ProbeConfiguration represents the ffprobe configuration
+type ProbeConfiguration struct {
+	BinaryPath string `toml:"binary_path"`
+}
+
+// FlagProbeConfig generates a ProbeConfiguration based on flags
+func FlagProbeConfig() ProbeConfiguration {
+	return ProbeConfiguration{
+		BinaryPath: *ProbeBinaryPath,
 	}
 }
@@ -0,0 +1,37 @@
+package astiffmpeg
+
+import (
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/asticode/go-astitools/ptr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigurationTOML(t *testing.T) {
+	var c Configuration
+	_, err := toml.DecodeFile("testdata/configuration.toml", &c)
+	assert.NoError(t, err)
+	assert.Equal(t, Configuration{
+		BinaryPath: "/opt/ffmpeg/bin/ffmpeg",
+		Env:        map[string]string{"LD_LIBRARY_PATH": "/opt/ffmpeg/lib"},
+		Global: GlobalOptions{
+			Extra:       []string{"-filter_threads", "2"},
+			Log:         &LogOptions{Level: LogLevelError},
+			NoStats:     true,
+			Overwrite:   astiptr.Bool(false),
+			StatsPeriod: Duration{Duration: 500 * time.Millisecond},
+		},
+		MaxConcurrentExecutions: 4,
+		StopGracePeriod:         Duration{Duration: 30 * time.Second},
+		StopKillTimeout:         Duration{Duration: 5 * time.Second},
+		TempDir:                 "/var/tmp/ffmpeg",
+		Timeout:                 Duration{Duration: time.Hour},
+		WorkingDir:              "/data",
+	}, c)
+
+	// Invalid duration
+	err = toml.Unmarshal([]byte(`timeout = "1 hour"`), &c)
+	assert.Error(t, err)
+}
@@ -0,0 +1,158 @@
+package astiffmpeg
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// stdErrErrorLinesSize is the max number of error-level lines kept for an ExecError
+const stdErrErrorLinesSize = 10
+
+// Exec error causes
+// Use them with errors.Is on an error returned by FFMpeg.Exec
+var (
+	ErrInputNotFound    = errors.New("astiffmpeg: input not found")
+	ErrInvalidData      = errors.New("astiffmpeg: invalid data")
+	ErrMuxer            = errors.New("astiffmpeg: muxer error")
+	ErrPermissionDenied = errors.New("astiffmpeg: permission denied")
+	ErrUnknownEncoder   = errors.New("astiffmpeg: unknown encoder")
+	ErrUnknownFilter    = errors.New("astiffmpeg: unknown filter")
+)
+
+// errorClassifiers maps known ffmpeg messages to causes. Order matters since the first match wins.
+var errorClassifiers = []struct {
+	cause    error
+	patterns []string
+}{
+	{cause: ErrPermissionDenied, patterns: []string{"Permission denied"}},
+	{cause: ErrInputNotFound, patterns: []string{"No such file or directory", "404 Not Found"}},
+	{cause: ErrUnknownEncoder, patterns: []string{"Unknown encoder", "Encoder not found"}},
+	{cause: ErrUnknownFilter, patterns: []string{"No such filter", "Filter not found"}},
+	{cause: ErrInvalidData, patterns: []string{"Invalid data found when processing input"}},
+	{cause: ErrMuxer, patterns: []string{
+		"Could not find tag for codec",
+		"Could not write header",
+		"Error writing trailer",
+		"Unable to find a suitable output format",
+	}},
+}
+
+// errorLineMarkers are lower-cased markers of lines logged at error level
+var errorLineMarkers = []string{
+	"could not",
+	"denied",
+	"error",
+	"failed",
+	"invalid",
+	"no such",
+	"not found",
+	"unable",
+	"unknown",
+}
+
+// errorLineIgnoredMarkers are lower-cased markers of lines logged while recovering from damaged data
+var errorLineIgnoredMarkers = []string{
+	"concealing",
+	"error concealment",
+	"last message repeated",
+}
+
+// isErrorLine returns whether the line looks like an error
+// Lines followed by several stats lines are dropped by stdErrRecorder since ffmpeg kept on processing after them.
+func isErrorLine(l []byte) bool {
+	ll := strings.ToLower(string(l))
+	for _, m := range errorLineIgnoredMarkers {
+		if strings.Contains(ll, m) {
+			return false
+		}
+	}
+	for _, m := range errorLineMarkers {
+		if strings.Contains(ll, m) {
+			return true
+		}
+	}
+	return false
+}
+
+func classifyError(lines []string) error {
+	for _, l := range lines {
+		for _, c := range errorClassifiers {
+			for _, p := range c.patterns {
+				if strings.Contains(l, p) {
+					return c.cause
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// ExecError represents an error returned when ffmpeg fails or is stopped
+type ExecError struct {
+	Args []string
+	// One of the Err* causes, nil if the failure could not be classified. When the job has been stopped, it is
+	// either the context error or ErrStalled.
+	Cause       error
+	CopyErrors  []error  // Errors that occurred while copying input readers and output writers
+	Err         error    // The error returned by os/exec
+	ErrorLines  []string // Last error-level lines of stderr, see stdErrRecorder
+	ExitCode    int      // -1 if ffmpeg was terminated by a signal
+	Signal      os.Signal
+	StdErrTail  []string // Last lines of stderr
+	StopOutcome string   // Empty if the job was not stopped
+}
+
+func newExecError(cmd *exec.Cmd, err error, r *stdErrRecorder) (e *ExecError) {
+	e = &ExecError{
+		Args:       cmd.Args,
+		Err:        err,
+		ErrorLines: r.errors(),
+		ExitCode:   -1,
+		StdErrTail: r.tail.slice(),
+	}
+	if cmd.ProcessState != nil {
+		e.ExitCode = cmd.ProcessState.ExitCode()
+		if s, ok := cmd.ProcessState.Sys().(syscall.WaitStatus); ok && s.Signaled() {
+			e.Signal = s.Signal()
+		}
+	}
+	e.Cause = classifyError(e.ErrorLines)
+	return
+}
+
+// Error implements the error interface
+func (e *ExecError) Error() string {
+	if len(e.StopOutcome) > 0 {
+		return fmt.Sprintf("astiffmpeg: %s was stopped (%s): %s", shellJoin(e.Args), e.StopOutcome, e.Cause)
+	}
+	var s = fmt.Sprintf("astiffmpeg: running %s failed", shellJoin(e.Args))
+	if e.Signal != nil {
+		s += fmt.Sprintf(" with signal %s", e.Signal)
+	} else {
+		s += fmt.Sprintf(" with exit code %d", e.ExitCode)
+	}
+	if len(e.ErrorLines) > 0 {
+		s += ": " + strings.Join(e.ErrorLines, "; ")
+	} else if len(e.StdErrTail) > 0 {
+		s += ": " + e.StdErrTail[len(e.StdErrTail)-1]
+	}
+	for _, err := range e.CopyErrors {
+		s += "; " + err.Error()
+	}
+	return s
+}
+
+// Is allows using errors.Is with the Err* causes
+func (e *ExecError) Is(target error) bool {
+	return e.Cause != nil && e.Cause == target
+}
+
+// Unwrap returns the error returned by os/exec
+func (e *ExecError) Unwrap() error {
+	return e.Err
+}
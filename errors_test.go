@@ -0,0 +1,58 @@
+package astiffmpeg
+
+import (
+	"errors"
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassifyError(t *testing.T) {
+	for _, i := range []struct {
+		cause error
+		l     string
+	}{
+		{l: "Conversion failed!"},
+		{cause: ErrInputNotFound, l: "input.mp4: No such file or directory"},
+		{cause: ErrInputNotFound, l: "[https @ 0x55d5c5a3c2c0] HTTP error 404 Not Found"},
+		{cause: ErrInvalidData, l: "input.mp4: Invalid data found when processing input"},
+		{cause: ErrMuxer, l: "Could not write header for output file #0 (incorrect codec parameters ?): Invalid argument"},
+		{cause: ErrMuxer, l: "[NULL @ 0x5581f1c4e940] Unable to find a suitable output format for 'output.xyz'"},
+		{cause: ErrPermissionDenied, l: "/root/output.mp4: Permission denied"},
+		{cause: ErrUnknownEncoder, l: "Unknown encoder 'libx265'"},
+		{cause: ErrUnknownFilter, l: "[AVFilterGraph @ 0x5603d2a57bc0] No such filter: 'scalee'"},
+	} {
+		assert.Equal(t, i.cause, classifyError([]string{i.l}), i.l)
+		assert.True(t, isErrorLine([]byte(i.l)), i.l)
+	}
+	assert.False(t, isErrorLine([]byte("frame=17448 fps=254 q=31.0 size=  176032kB time=00:11:38.14 bitrate=2065.5kbits/s speed=10.2x")))
+	assert.False(t, isErrorLine([]byte("[h264 @ 0x55d5c5a3c2c0] concealing 1620 DC, 1620 AC, 1620 MV errors in P frame")))
+	assert.False(t, isErrorLine([]byte("    Last message repeated 3 times")))
+
+	// Errors followed by several stats lines are not kept
+	r := newStdErrRecorder()
+	r.add([]byte("[h264 @ 0x55d5c5a3c2c0] error while decoding MB 12 3, bytestream -5"))
+	r.add([]byte("[h264 @ 0x55d5c5a3c2c0] No such file or directory"))
+	r.add([]byte("frame=1 fps=0.0 q=0.0 size=0kB time=00:00:00.04 bitrate=N/A speed=1x"))
+	r.add([]byte("frame=2 fps=0.0 q=0.0 size=0kB time=00:00:00.08 bitrate=N/A speed=1x"))
+	assert.Equal(t, []string{}, r.errors())
+	r.add([]byte("[mp4 @ 0x5581f1c4e940] Error writing trailer of output.mp4: No space left on device"))
+	r.add([]byte("frame=3 fps=0.0 q=0.0 Lsize=0kB time=00:00:00.12 bitrate=N/A speed=1x"))
+	r.add([]byte("Conversion failed!"))
+	assert.Equal(t, []string{"[mp4 @ 0x5581f1c4e940] Error writing trailer of output.mp4: No space left on device", "Conversion failed!"}, r.errors())
+	assert.Equal(t, ErrMuxer, newExecError(exec.Command("ffmpeg"), errors.New("exit status 1"), r).Cause)
+}
+
+func TestExecError(t *testing.T) {
+	r := newStdErrRecorder()
+	r.add([]byte("Stream mapping:"))
+	r.add([]byte("Unknown encoder 'libx265'"))
+	cmd := exec.Command("ffmpeg", "-i", "input.mp4")
+	err := newExecError(cmd, errors.New("exit status 1"), r)
+	assert.True(t, errors.Is(err, ErrUnknownEncoder))
+	assert.False(t, errors.Is(err, ErrUnknownFilter))
+	assert.Equal(t, -1, err.ExitCode)
+	assert.Equal(t, []string{"Stream mapping:", "Unknown encoder 'libx265'"}, err.StdErrTail)
+	assert.Equal(t, "astiffmpeg: running ffmpeg -i input.mp4 failed with exit code -1: Unknown encoder 'libx265'", err.Error())
+}
@@ -1,28 +1,175 @@
 package astiffmpeg
 
 import (
-	"bytes"
 	"context"
-	"os/exec"
-	"strings"
-
 	"os"
+	"os/exec"
+	"sort"
+	"sync"
 	"time"
 
-	"github.com/asticode/go-astilog"
 	"github.com/pkg/errors"
 )
 
+// DefaultDurationProbingTimeout is the default max duration of the probing of a command's inputs
+const DefaultDurationProbingTimeout = 10 * time.Second
+
 // FFMpeg represents an entity capable of running an FFMpeg binary
 // https://ffmpeg.org/ffmpeg.html
 type FFMpeg struct {
-	binaryPath   string
-	stdErrParser StdErrParser
+	binaryPath      string
+	capabilities    *capabilities
+	durationProbing time.Duration // Probing timeout, 0 when disabled
+	env             map[string]string
+	executions      chan struct{}
+	global          GlobalOptions
+	probe           *Probe
+	progressHandler func(p Progress)
+	retryPolicy     *RetryPolicy
+	stdErrParser    StdErrParser
+	stopGracePeriod time.Duration
+	stopKillTimeout time.Duration
+	tempDir         string
+	timeout         time.Duration
+	validate        bool
+	version         *Version
+	versionM        *sync.Mutex
+	watchdog        WatchdogOptions
+	workingDir      string
 }
 
 // New creates a new FFMpeg
-func New(c Configuration) *FFMpeg {
-	return &FFMpeg{binaryPath: c.BinaryPath}
+// The binary is looked up in the configuration, then in $FFMPEG_PATH, then in $PATH, and must print an ffmpeg
+// version. A matching ffprobe is looked up in the configuration, then in $FFPROBE_PATH, then next to the ffmpeg
+// binary, and is used as the probe if found.
+func New(c Configuration) (f *FFMpeg, err error) {
+	// Create ffmpeg
+	f = &FFMpeg{
+		capabilities:    newCapabilities(),
+		env:             c.Env,
+		global:          c.Global,
+		stopGracePeriod: c.StopGracePeriod.Duration,
+		stopKillTimeout: c.StopKillTimeout.Duration,
+		tempDir:         c.TempDir,
+		timeout:         c.Timeout.Duration,
+		versionM:        &sync.Mutex{},
+		workingDir:      c.WorkingDir,
+	}
+	if f.stopGracePeriod <= 0 {
+		f.stopGracePeriod = DefaultStopGracePeriod
+	}
+	if f.stopKillTimeout <= 0 {
+		f.stopKillTimeout = DefaultStopKillTimeout
+	}
+	if c.MaxConcurrentExecutions > 0 {
+		f.executions = make(chan struct{}, c.MaxConcurrentExecutions)
+	}
+
+	// Look binary
+	if f.binaryPath, err = lookBinary(c.BinaryPath, EnvBinaryPath, "ffmpeg"); err != nil {
+		err = errors.Wrap(err, "astiffmpeg: looking ffmpeg binary failed")
+		f = nil
+		return
+	} else if len(f.binaryPath) == 0 {
+		err = ErrBinaryNotFound
+		f = nil
+		return
+	}
+
+	// Check binary
+	var b []byte
+	if b, err = f.checkBinary(f.binaryPath, "ffmpeg"); err != nil {
+		err = errors.Wrap(err, "astiffmpeg: checking ffmpeg binary failed")
+		f = nil
+		return
+	}
+
+	// Cache version
+	if v, errParse := parseVersion(b); errParse == nil {
+		f.version = &v
+	}
+
+	// Look probe binary
+	var p string
+	if p, err = lookProbeBinary(c.ProbeBinaryPath, f.binaryPath); err != nil {
+		err = errors.Wrap(err, "astiffmpeg: looking ffprobe binary failed")
+		f = nil
+		return
+	} else if len(p) > 0 {
+		if _, err = f.checkBinary(p, "ffprobe"); err != nil {
+			err = errors.Wrap(err, "astiffmpeg: checking ffprobe binary failed")
+			f = nil
+			return
+		}
+		f.probe = NewProbe(ProbeConfiguration{BinaryPath: p})
+	}
+	return
+}
+
+// adaptCmd applies the configuration's working dir and environment to a cmd
+func (f *FFMpeg) adaptCmd(cmd *exec.Cmd) {
+	cmd.Dir = f.workingDir
+	cmd.Env = append(cmd.Env, f.environ()...)
+}
+
+// environ returns the environment variables set by the configuration, the last ones taking precedence
+func (f *FFMpeg) environ() (es []string) {
+	if len(f.tempDir) > 0 {
+		es = append(es, "TMPDIR="+f.tempDir)
+	}
+	var ks []string
+	for k := range f.env {
+		ks = append(ks, k)
+	}
+	sort.Strings(ks)
+	for _, k := range ks {
+		es = append(es, k+"="+f.env[k])
+	}
+	return
+}
+
+// command returns the command with the configuration's defaults applied
+func (f *FFMpeg) command(c Command) Command {
+	c.Global = c.Global.merge(f.global)
+	if c.Timeout <= 0 {
+		c.Timeout = f.timeout
+	}
+
+	// The watchdog is fed with progress blocks since stats lines are missing with -nostats or a log level below info
+	if f.watchdog.enabled() {
+		c.Global.Progress = true
+	}
+	return c
+}
+
+// acquire blocks until the number of running ffmpeg processes is below Configuration.MaxConcurrentExecutions
+func (f *FFMpeg) acquire(ctx context.Context) error {
+	if f.executions == nil {
+		return nil
+	}
+	select {
+	case f.executions <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "astiffmpeg: waiting for an execution slot failed")
+	}
+}
+
+// release must be called once a job acquired with acquire has ended
+func (f *FFMpeg) release() {
+	if f.executions != nil {
+		<-f.executions
+	}
+}
+
+// BinaryPath returns the path of the ffmpeg binary
+func (f *FFMpeg) BinaryPath() string {
+	return f.binaryPath
+}
+
+// Probe returns the probe, nil if no ffprobe binary was found and none was set
+func (f *FFMpeg) Probe() *Probe {
+	return f.probe
 }
 
 // SetStdErrParser sets the stderr parser
@@ -30,109 +177,161 @@ func (f *FFMpeg) SetStdErrParser(s StdErrParser) {
 	f.stdErrParser = s
 }
 
-// Exec executes the binary with the specified options
-// ffmpeg [global_options] {[input_file_options] -i input_url} ... {[output_file_options] output_url} ...
-func (f *FFMpeg) Exec(ctx context.Context, g GlobalOptions, in []Input, out []Output) (err error) {
-	// Create cmd
-	var cmd = exec.CommandContext(ctx, f.binaryPath)
-	cmd.Env = os.Environ()
+// SetProbe sets the probe, see SetDurationProbing
+func (f *FFMpeg) SetProbe(p *Probe) {
+	f.probe = p
+}
+
+// SetDurationProbing sets whether the inputs are probed to retrieve the expected duration when Command.Duration is
+// not provided. Probing requires a probe and is stopped after timeout, which defaults to
+// DefaultDurationProbingTimeout. It is disabled by default.
+func (f *FFMpeg) SetDurationProbing(enabled bool, timeout time.Duration) {
+	if !enabled {
+		f.durationProbing = 0
+		return
+	}
+	if timeout <= 0 {
+		timeout = DefaultDurationProbingTimeout
+	}
+	f.durationProbing = timeout
+}
+
+// SetRetryPolicy sets the retry policy applied to every job, unless the command has its own
+func (f *FFMpeg) SetRetryPolicy(p *RetryPolicy) {
+	f.retryPolicy = p
+}
 
-	// Output is redirected in stderr only
-	var bufErr = &bytes.Buffer{}
-	cmd.Stderr = bufErr
+// SetValidation sets whether commands are validated against the capabilities of the binary before being started, see
+// Validate
+func (f *FFMpeg) SetValidation(enabled bool) {
+	f.validate = enabled
+}
+
+// SetWatchdog sets the watchdog options applied to every job
+// Commands started, built or scripted with a watchdog write progress to a dedicated file descriptor, see GlobalOptions.Progress.
+func (f *FFMpeg) SetWatchdog(o WatchdogOptions) {
+	f.watchdog = o
+}
 
-	// Global options
-	g.adaptCmd(cmd)
+// SetProgressHandler sets the handler executed for each block of -progress output of every job, see
+// Command.ProgressHandler to handle the blocks of a single job
+// Progress output is only enabled when GlobalOptions.Progress is true
+func (f *FFMpeg) SetProgressHandler(fn func(p Progress)) {
+	f.progressHandler = fn
+}
 
-	// Parse stderr
-	if f.stdErrParser != nil {
-		t := time.NewTicker(f.stdErrParser.Period())
-		defer t.Stop()
-		go func() {
-			for t := range t.C {
-				f.stdErrParser.Process(t, bufErr)
-			}
-		}()
+// Exec executes the command and waits for it to exit
+func (f *FFMpeg) Exec(ctx context.Context, c Command) (err error) {
+	// Start
+	var j *Job
+	if j, err = f.Start(ctx, c); err != nil {
+		return
 	}
 
-	// Inputs
-	for idx, i := range in {
-		if err = i.adaptCmd(cmd); err != nil {
-			err = errors.Wrapf(err, "astiffmpeg: adapting cmd for input #%d failed", idx)
+	// Wait
+	err = j.Wait()
+	return
+}
+
+// Start starts the command without waiting for it to exit
+// Cancelling the context stops the job gracefully, see Configuration.StopGracePeriod. When
+// Configuration.MaxConcurrentExecutions is reached, Start blocks until another job ends or the context is cancelled.
+func (f *FFMpeg) Start(ctx context.Context, c Command) (j *Job, err error) {
+	// Apply defaults
+	c = f.command(c)
+
+	// Validate
+	if f.validate {
+		if err = f.Validate(ctx, c); err != nil {
 			return
 		}
 	}
 
-	// Outputs
-	for idx, o := range out {
-		if err = o.adaptCmd(cmd); err != nil {
-			err = errors.Wrapf(err, "astiffmpeg: adapting cmd for output #%d failed", idx)
-			return
-		}
+	// Get version
+	var v *Version
+	if v, err = f.cmdVersion(ctx, c); err != nil {
+		return
 	}
 
-	// Run cmd
-	astilog.Debugf("Executing %s", strings.Join(cmd.Args, " "))
-	if err = cmd.Run(); err != nil {
-		err = errors.Wrapf(err, "astiffmpeg: running %s failed with stderr %s", strings.Join(cmd.Args, " "), bufErr.Bytes())
+	// Get expected duration
+	// Inputs are probed before waiting for an execution slot so that a stalled input doesn't hold one
+	d := f.expectedDuration(ctx, c)
+
+	// Wait for an execution slot
+	if err = f.acquire(ctx); err != nil {
 		return
 	}
+
+	// Create job
+	var cancel context.CancelFunc
+	if c.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	j = newJob(ctx, cancel, f, c, v)
+	j.estimator = newProgressEstimator(d)
+	j.startedAt = time.Now()
+
+	// Start first attempt
+	var a *jobAttempt
+	if a, err = j.start(); err != nil {
+		cancel()
+		f.release()
+		j = nil
+		return
+	}
+
+	// Run
+	go j.run(a)
 	return
 }
 
-// Exec executes the binary with the specified options
-// ffmpeg [global_options] {[input_file_options] -i input_url} ... {[output_file_options] output_url} ...
-func (f *FFMpeg) BuildCmd(ctx context.Context, g GlobalOptions, in []Input,
-	complexInterface interface{}, out []Output) (cmd *exec.Cmd, err error) {
+// expectedDuration returns the expected duration of the command, probing its inputs if duration probing is enabled
+func (f *FFMpeg) expectedDuration(ctx context.Context, c Command) time.Duration {
+	if f.durationProbing <= 0 || f.probe == nil {
+		return c.expectedDuration(ctx, nil, nil)
+	}
+	ctx, cancel := context.WithTimeout(ctx, f.durationProbing)
+	defer cancel()
+	return c.expectedDuration(ctx, f.probe, f.adaptCmd)
+}
+
+// BuildCmd builds the cmd without running it
+// When Global.Progress is true, fd 3 must be provided through cmd.ExtraFiles
+func (f *FFMpeg) BuildCmd(ctx context.Context, c Command) (cmd *exec.Cmd, err error) {
+	// Apply defaults
+	c = f.command(c)
+
+	// Get version
+	var v *Version
+	if v, err = f.cmdVersion(ctx, c); err != nil {
+		return
+	}
+
 	// Create cmd
 	cmd = exec.CommandContext(ctx, f.binaryPath)
 	cmd.Env = os.Environ()
+	f.adaptCmd(cmd)
 
-	// Output is redirected in stderr only
-	// var bufErr = &bytes.Buffer{}
-	// cmd.Stderr = bufErr
-
-	// Global options
-	g.adaptCmd(cmd)
-
-	// Parse stderr
-	// if f.stdErrParser != nil {
-	// 	t := time.NewTicker(f.stdErrParser.Period())
-	// 	defer t.Stop()
-	// 	go func() {
-	// 		for t := range t.C {
-	// 			f.stdErrParser.Process(t, bufErr)
-	// 		}
-	// 	}()
-	// }
-
-	// Inputs
-	for idx, i := range in {
-		if err = i.adaptCmd(cmd); err != nil {
-			err = errors.Wrapf(err, "astiffmpeg: adapting cmd for input #%d failed", idx)
-			return
-		}
+	// Adapt cmd
+	if err = c.adaptCmd(cmd, v); err != nil {
+		err = errors.Wrap(err, "astiffmpeg: adapting cmd failed")
+		return
 	}
+	return
+}
 
-	complex, ok := complexInterface.(ComplexFilterOptions)
-	if ok {
-		complex.adaptCmd(cmd)
+// cmdVersion returns the version the command must be rendered for, or nil if rendering doesn't depend on it
+func (f *FFMpeg) cmdVersion(ctx context.Context, c Command) (v *Version, err error) {
+	if !c.versionGated() {
+		return
 	}
-
-	// Outputs
-	for idx, o := range out {
-		if err = o.adaptCmd(cmd); err != nil {
-			err = errors.Wrapf(err, "astiffmpeg: adapting cmd for output #%d failed", idx)
-			return
-		}
+	var fv Version
+	if fv, err = f.Version(ctx); err != nil {
+		err = errors.Wrap(err, "astiffmpeg: getting version failed")
+		return
 	}
-
-	// Run cmd
-	// astilog.Debugf("Executing %s", strings.Join(cmd.Args, " "))
-	// if err = cmd.Run(); err != nil {
-	// 	err = errors.Wrapf(err, "astiffmpeg: running %s failed with stderr %s", strings.Join(cmd.Args, " "), bufErr.Bytes())
-	// 	return
-	// }
-
+	v = &fv
 	return
 }
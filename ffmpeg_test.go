@@ -0,0 +1,403 @@
+package astiffmpeg
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/asticode/go-astitools/ptr"
+	"github.com/stretchr/testify/assert"
+)
+
+// testVersionScript answers "-version" so that test binaries pass the checks run by New
+const testVersionScript = `if [ "$1" = "-version" ]; then
+	echo "ffmpeg version 6.0"
+	exit 0
+fi
+`
+
+// newTestBinary writes a shell script standing in for the ffmpeg binary
+func newTestBinary(t *testing.T, script string) (path string, cleanup func()) {
+	dir, cleanup := newTestBinaries(t, map[string]string{"ffmpeg": testVersionScript + script})
+	return filepath.Join(dir, "ffmpeg"), cleanup
+}
+
+// newTestBinaries writes shell scripts standing in for binaries in a temporary dir
+func newTestBinaries(t *testing.T, scripts map[string]string) (dir string, cleanup func()) {
+	if runtime.GOOS == "windows" {
+		t.Skip("astiffmpeg: test binaries are shell scripts")
+	}
+	var err error
+	if dir, err = ioutil.TempDir("", "astiffmpeg"); err != nil {
+		t.Fatal(err)
+	}
+	for n, s := range scripts {
+		if err = ioutil.WriteFile(filepath.Join(dir, n), []byte("#!/bin/sh\n"+s), 0755); err != nil {
+			os.RemoveAll(dir)
+			t.Fatal(err)
+		}
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+// newTestFFMpeg creates a new FFMpeg and fails the test on error
+func newTestFFMpeg(t *testing.T, c Configuration) *FFMpeg {
+	f, err := New(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestNew(t *testing.T) {
+	// Not found
+	os.Setenv(EnvBinaryPath, "")
+	defer os.Unsetenv(EnvBinaryPath)
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", "")
+	defer os.Setenv("PATH", path)
+	_, err := New(Configuration{})
+	assert.Equal(t, ErrBinaryNotFound, err)
+
+	// Not executable
+	dir, cleanup := newTestBinaries(t, map[string]string{
+		"ffmpeg":  testVersionScript,
+		"ffprobe": `echo "ffprobe version 6.0"`,
+		"other":   `echo "other version 1.0"`,
+	})
+	defer cleanup()
+	_, err = New(Configuration{BinaryPath: filepath.Join(dir, "missing")})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "from configuration is not an executable")
+
+	// Not ffmpeg
+	_, err = New(Configuration{BinaryPath: filepath.Join(dir, "other")})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "other is not ffmpeg")
+
+	// Environment and matching ffprobe
+	os.Setenv(EnvBinaryPath, filepath.Join(dir, "ffmpeg"))
+	f, err := New(Configuration{})
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "ffmpeg"), f.BinaryPath())
+	assert.Equal(t, &Probe{binaryPath: filepath.Join(dir, "ffprobe")}, f.Probe())
+	v, err := f.Version(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "6.0", v.String())
+
+	// $PATH
+	os.Setenv(EnvBinaryPath, "")
+	os.Setenv("PATH", dir)
+	f, err = New(Configuration{})
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "ffmpeg"), f.BinaryPath())
+
+	// Invalid ffprobe
+	_, err = New(Configuration{ProbeBinaryPath: filepath.Join(dir, "other")})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "other is not ffprobe")
+}
+
+func TestFFMpegExecProgress(t *testing.T) {
+	p, cleanup := newTestBinary(t, `echo "frame=1 fps=0.0 q=0.0 size=0kB time=00:00:00.04 bitrate=N/A speed=1x" >&2
+printf 'frame=1\nout_time_us=40000\nprogress=continue\nframe=2\nout_time_us=80000\nprogress=end\n' >&3
+`)
+	defer cleanup()
+	f := newTestFFMpeg(t, Configuration{BinaryPath: p})
+	var ps []Progress
+	f.SetProgressHandler(func(p Progress) { ps = append(ps, p) })
+	var rs []DefaultStdErrResults
+	f.SetStdErrParser(DefaultStdErrParser(0, func(r DefaultStdErrResults) { rs = append(rs, r) }))
+	err := f.Exec(context.Background(), Command{Global: GlobalOptions{Progress: true}})
+	assert.NoError(t, err)
+	assert.Len(t, rs, 1)
+	assert.Len(t, ps, 2)
+	assert.Equal(t, ProgressStatusEnd, ps[1].Status)
+
+	// Job
+	p, cleanup = newTestBinary(t, `printf 'frame=1\nout_time_us=5000000\nspeed=1x\nprogress=continue\nframe=2\nout_time_us=10000000\nspeed=1x\nprogress=end\n' >&3
+`)
+	defer cleanup()
+	f = newTestFFMpeg(t, Configuration{BinaryPath: p, Global: GlobalOptions{NoStats: true}})
+	var cps []Progress
+	j, err := f.Start(context.Background(), Command{
+		Duration:        10 * time.Second,
+		Global:          GlobalOptions{Progress: true},
+		ProgressHandler: func(p Progress) { cps = append(cps, p) },
+	})
+	assert.NoError(t, err)
+	var percents []float64
+	for r := range j.Progress() {
+		if r.Percent != nil {
+			percents = append(percents, *r.Percent)
+		}
+	}
+	assert.NoError(t, j.Wait())
+	assert.Equal(t, []float64{50, 100}, percents)
+	assert.Len(t, cps, 2)
+}
+
+func TestFFMpegExecError(t *testing.T) {
+	p, cleanup := newTestBinary(t, `echo "input.mp4: No such file or directory" >&2
+exit 1
+`)
+	defer cleanup()
+	f := newTestFFMpeg(t, Configuration{BinaryPath: p})
+	err := f.Exec(context.Background(), Command{Inputs: []Input{{Path: "input.mp4"}}})
+	assert.IsType(t, &ExecError{}, err)
+	e := err.(*ExecError)
+	assert.Equal(t, ErrInputNotFound, e.Cause)
+	assert.Equal(t, 1, e.ExitCode)
+	assert.Nil(t, e.Signal)
+	assert.Equal(t, []string{"input.mp4: No such file or directory"}, e.ErrorLines)
+}
+
+func TestFFMpegStart(t *testing.T) {
+	p, cleanup := newTestBinary(t, `echo "frame=1 fps=0.0 q=0.0 size=0kB time=00:00:00.04 bitrate=N/A speed=1x" >&2
+exec sleep 10
+`)
+	defer cleanup()
+	f := newTestFFMpeg(t, Configuration{BinaryPath: p, StopGracePeriod: Duration{Duration: time.Millisecond}})
+	j, err := f.Start(context.Background(), Command{})
+	assert.NoError(t, err)
+	assert.NotZero(t, j.PID())
+	assert.False(t, j.StartedAt().IsZero())
+	r := <-j.Progress()
+	assert.Equal(t, 1, *r.Frame)
+	j.Cancel()
+	<-j.Done()
+	assert.Error(t, j.Wait())
+	assert.False(t, j.EndedAt().IsZero())
+	_, ok := <-j.Progress()
+	assert.False(t, ok)
+}
+
+func TestFFMpegStop(t *testing.T) {
+	// Graceful
+	p, cleanup := newTestBinary(t, `head -c 1 > /dev/null
+exit 0
+`)
+	defer cleanup()
+	f := newTestFFMpeg(t, Configuration{BinaryPath: p})
+	ctx, cancel := context.WithCancel(context.Background())
+	j, err := f.Start(ctx, Command{})
+	assert.NoError(t, err)
+	cancel()
+	err = j.Wait()
+	assert.Error(t, err)
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Equal(t, StopOutcomeGraceful, j.StopOutcome())
+	assert.Equal(t, StopOutcomeGraceful, err.(*ExecError).StopOutcome)
+
+	// Killed
+	p, cleanup = newTestBinary(t, `trap '' INT
+exec sleep 10
+`)
+	defer cleanup()
+	f = newTestFFMpeg(t, Configuration{BinaryPath: p, StopGracePeriod: Duration{Duration: time.Millisecond}, StopKillTimeout: Duration{Duration: time.Millisecond}})
+	j, err = f.Start(context.Background(), Command{})
+	assert.NoError(t, err)
+	j.Cancel()
+	assert.Error(t, j.Wait())
+	assert.Equal(t, StopOutcomeKilled, j.StopOutcome())
+
+	// Already finished
+	cmd := exec.Command(p)
+	assert.NoError(t, cmd.Start())
+	assert.NoError(t, cmd.Process.Kill())
+	cmd.Wait()
+	assert.Equal(t, "", interruptProcess(cmd.Process, make(chan struct{}), time.Millisecond))
+}
+
+func TestFFMpegWatchdog(t *testing.T) {
+	p, cleanup := newTestBinary(t, `echo "frame=1 fps=0.0 q=0.0 size=0kB time=00:00:00.04 bitrate=N/A speed=1x" >&2
+head -c 1 > /dev/null
+`)
+	defer cleanup()
+	f := newTestFFMpeg(t, Configuration{BinaryPath: p})
+	f.SetWatchdog(WatchdogOptions{StallTimeout: 50 * time.Millisecond})
+	err := f.Exec(context.Background(), Command{})
+	assert.True(t, errors.Is(err, ErrStalled))
+	assert.Equal(t, StopOutcomeGraceful, err.(*ExecError).StopOutcome)
+
+	// Speed
+	p, cleanup = newTestBinary(t, `while true; do
+  echo "frame=1 fps=0.0 q=0.0 size=0kB time=00:00:00.04 bitrate=N/A speed=0.1x" >&2
+  sleep 0.01
+done
+`)
+	defer cleanup()
+	f = newTestFFMpeg(t, Configuration{BinaryPath: p, StopGracePeriod: Duration{Duration: time.Millisecond}})
+	f.SetWatchdog(WatchdogOptions{MinSpeed: 0.5, MinSpeedTimeout: 50 * time.Millisecond})
+	err = f.Exec(context.Background(), Command{})
+	assert.True(t, errors.Is(err, ErrStalled))
+
+	// No stats
+	p, cleanup = newTestBinary(t, `for i in 1 2 3 4 5 6 7 8 9 10; do
+  printf 'frame=%d\nprogress=continue\n' $i >&3
+  sleep 0.02
+done
+`)
+	defer cleanup()
+	f = newTestFFMpeg(t, Configuration{BinaryPath: p, Global: GlobalOptions{NoStats: true}})
+	f.SetWatchdog(WatchdogOptions{StallTimeout: 50 * time.Millisecond})
+	assert.NoError(t, f.Exec(context.Background(), Command{}))
+}
+
+type testErrorWriter struct{}
+
+func (w testErrorWriter) Write(p []byte) (int, error) { return 0, errors.New("test") }
+
+func TestFFMpegExecPipes(t *testing.T) {
+	p, cleanup := newTestBinary(t, `echo "$@" >&2
+tr a-z A-Z
+cat <&3 >&4
+`)
+	defer cleanup()
+	f := newTestFFMpeg(t, Configuration{BinaryPath: p})
+	w1, w2 := &bytes.Buffer{}, &bytes.Buffer{}
+	var args string
+	f.SetStdErrParser(testStdErrParser(func(l []byte) { args = string(l) }))
+	err := f.Exec(context.Background(), Command{
+		Inputs: []Input{
+			{Reader: strings.NewReader("input 1")},
+			{Path: "input.mp4"},
+			{Reader: strings.NewReader("input 2")},
+		},
+		Outputs: []Output{
+			{Writer: w1},
+			{Writer: w2},
+		},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "-hide_banner -i pipe:0 -i input.mp4 -i pipe:3 -y pipe:1 -y pipe:4", args)
+	assert.Equal(t, "INPUT 1", w1.String())
+	assert.Equal(t, "input 2", w2.String())
+
+	// Copy error
+	err = f.Exec(context.Background(), Command{
+		Inputs:  []Input{{Reader: strings.NewReader("input")}},
+		Outputs: []Output{{Writer: testErrorWriter{}}},
+	})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "copying pipe:1 failed")
+
+	// Reader blocking after ffmpeg has exited
+	p, cleanup = newTestBinary(t, `exit 0
+`)
+	defer cleanup()
+	f = newTestFFMpeg(t, Configuration{BinaryPath: p})
+	r := testBlockingReader(make(chan struct{}))
+	defer close(r)
+	done := make(chan error)
+	go func() {
+		done <- f.Exec(context.Background(), Command{Inputs: []Input{{Reader: r}}, Outputs: []Output{{Path: "output.mp4"}}})
+	}()
+	select {
+	case err = <-done:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("astiffmpeg: job blocked on its input reader")
+	}
+}
+
+type testBlockingReader chan struct{}
+
+func (r testBlockingReader) Read(p []byte) (int, error) {
+	<-r
+	return 0, io.EOF
+}
+
+type testStdErrParser func(l []byte)
+
+func (p testStdErrParser) ProcessLine(t time.Time, l []byte) { p(l) }
+
+func TestFFMpegExecRetry(t *testing.T) {
+	p, cleanup := newTestBinary(t, `c="$(dirname "$0")/attempts"
+echo >> "$c"
+for a; do o="$a"; done
+if [ -e "$o" ]; then
+	echo "partial output was not removed" >&2
+	exit 2
+fi
+echo partial > "$o"
+if [ $(wc -l < "$c") -lt 3 ]; then
+	echo "tcp://localhost:1234: Connection refused" >&2
+	exit 1
+fi
+`)
+	defer cleanup()
+	o := filepath.Join(filepath.Dir(p), "output.mp4")
+	f := newTestFFMpeg(t, Configuration{BinaryPath: p})
+	f.SetRetryPolicy(&RetryPolicy{Backoff: time.Millisecond, MaxAttempts: 3})
+	j, err := f.Start(context.Background(), Command{Outputs: []Output{{Path: o}}})
+	assert.NoError(t, err)
+	assert.NoError(t, j.Wait())
+	assert.Equal(t, 3, j.Attempts())
+
+	// Not retryable
+	os.Remove(filepath.Join(filepath.Dir(p), "attempts"))
+	err = f.Exec(context.Background(), Command{
+		Outputs:     []Output{{Path: o}},
+		RetryPolicy: &RetryPolicy{Classifier: func(e *ExecError) bool { return false }, MaxAttempts: 3},
+	})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "partial output was not removed")
+}
+
+func TestFFMpegConfiguration(t *testing.T) {
+	p, cleanup := newTestBinary(t, `echo "$(pwd) $TMPDIR $A $@" >&2
+`)
+	defer cleanup()
+	dir := filepath.Dir(p)
+	f := newTestFFMpeg(t, Configuration{
+		BinaryPath: p,
+		Env:        map[string]string{"A": "a"},
+		Global:     GlobalOptions{Log: &LogOptions{Level: LogLevelError}, NoStats: true, Overwrite: astiptr.Bool(false)},
+		TempDir:    "/tmp/astiffmpeg",
+		WorkingDir: dir,
+	})
+	var line string
+	f.SetStdErrParser(testStdErrParser(func(l []byte) { line = string(l) }))
+	err := f.Exec(context.Background(), Command{Global: GlobalOptions{Log: &LogOptions{Level: LogLevelInfo}}, Outputs: []Output{{Path: "output.mp4"}}})
+	assert.NoError(t, err)
+	wd, _ := filepath.EvalSymlinks(dir)
+	assert.Contains(t, []string{dir, wd}, strings.TrimSuffix(line, " /tmp/astiffmpeg a -hide_banner -loglevel info -n -nostats output.mp4"))
+
+	// Overwrite
+	err = f.Exec(context.Background(), Command{Global: GlobalOptions{Overwrite: astiptr.Bool(true)}, Outputs: []Output{{Path: "output.mp4"}}})
+	assert.NoError(t, err)
+	assert.Contains(t, []string{dir, wd}, strings.TrimSuffix(line, " /tmp/astiffmpeg a -hide_banner -loglevel error -y -nostats output.mp4"))
+
+	// Timeout
+	p, cleanup = newTestBinary(t, `head -c 1 > /dev/null
+exit 0
+`)
+	defer cleanup()
+	f = newTestFFMpeg(t, Configuration{BinaryPath: p, MaxConcurrentExecutions: 1, Timeout: Duration{Duration: time.Hour}})
+	err = f.Exec(context.Background(), Command{Timeout: 10 * time.Millisecond})
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+
+	// Max concurrent executions
+	j, err := f.Start(context.Background(), Command{})
+	assert.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = f.Start(ctx, Command{})
+	assert.Error(t, err)
+	j.Cancel()
+	j.Wait()
+	j, err = f.Start(context.Background(), Command{})
+	assert.NoError(t, err)
+	j.Cancel()
+	j.Wait()
+}
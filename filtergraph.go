@@ -0,0 +1,222 @@
+package astiffmpeg
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// filterPadSourceRegexp matches pads referencing streams of an input such as "0" or "1:a:0"
+var filterPadSourceRegexp = regexp.MustCompile(`^(\d+)(?::(.+))?$`)
+
+// FilterGraph represents a filter graph made of chains, rendered as the value of -filter_complex
+// https://ffmpeg.org/ffmpeg-filters.html#Filtergraph-syntax-1
+type FilterGraph struct {
+	Chains []FilterChain
+}
+
+// FilterChain represents a chain of filters, each filter's output being connected to the next filter's input
+type FilterChain []FilterNode
+
+// FilterNode represents a filter and its labelled pads
+// Unlabelled pads are connected to the previous or next filter of the chain. Unlabelled inputs of the first filter of
+// the graph are connected to the inputs and unlabelled outputs of the last filter to the first output.
+type FilterNode struct {
+	Filter  fmt.Stringer
+	Inputs  []FilterPad
+	Outputs []FilterPad
+}
+
+// RawFilter represents a filter description such as "scale=1280:720" rendered as is
+// Special characters must be escaped with EscapeFilterOptionValue and EscapeFilterDescription.
+type RawFilter string
+
+// String implements the fmt.Stringer interface
+func (f RawFilter) String() string {
+	return string(f)
+}
+
+// FilterPad represents a pad label
+// Pads with a Label are links between filters, or between a filter and an output mapping it with "-map [label]".
+// Pads without a Label are sources referencing streams of an input, such as [0:v:0], and can only be filter inputs.
+type FilterPad struct {
+	// Index of the input, only used by sources
+	Input int
+	Label string
+	// Streams of the input, all of them when nil. Only used by sources.
+	Stream *StreamSpecifier
+}
+
+func (p FilterPad) string() string {
+	if len(p.Label) > 0 {
+		return "[" + p.Label + "]"
+	}
+	s := strconv.Itoa(p.Input)
+	if p.Stream != nil {
+		s += ":" + p.Stream.string()
+	}
+	return "[" + s + "]"
+}
+
+func (g FilterGraph) string() string {
+	var cs []string
+	for _, c := range g.Chains {
+		var ns []string
+		for _, n := range c {
+			var s string
+			for _, p := range n.Inputs {
+				s += p.string()
+			}
+			s += n.Filter.String()
+			for _, p := range n.Outputs {
+				s += p.string()
+			}
+			ns = append(ns, s)
+		}
+		cs = append(cs, strings.Join(ns, ","))
+	}
+	return strings.Join(cs, ";")
+}
+
+// validate returns an error if a label is dangling or consumed several times
+// Labels mapped by outputs are consumed as well.
+func (g FilterGraph) validate(mapped []string) error {
+	// Count labels
+	var consumed, produced = make(map[string]int), make(map[string]int)
+	if len(g.Chains) == 0 {
+		return errors.New("astiffmpeg: filter graph is empty")
+	}
+	for ci, c := range g.Chains {
+		if len(c) == 0 {
+			return errors.Errorf("astiffmpeg: chain #%d is empty", ci)
+		}
+		for ni, n := range c {
+			if n.Filter == nil {
+				return errors.Errorf("astiffmpeg: filter #%d of chain #%d is nil", ni, ci)
+			}
+			if tf, ok := n.Filter.(TypedFilter); ok {
+				if err := tf.Validate(); err != nil {
+					return errors.Wrapf(err, "astiffmpeg: validating filter #%d of chain #%d failed", ni, ci)
+				}
+			}
+			for _, p := range n.Inputs {
+				if len(p.Label) > 0 {
+					consumed[p.Label]++
+				}
+			}
+			for _, p := range n.Outputs {
+				if len(p.Label) == 0 {
+					return errors.Errorf("astiffmpeg: output pad %s of filter #%d of chain #%d is not labelled", p.string(), ni, ci)
+				}
+				produced[p.Label]++
+			}
+		}
+	}
+	for _, l := range mapped {
+		consumed[l]++
+	}
+
+	// Check labels
+	var ls []string
+	for l := range produced {
+		ls = append(ls, l)
+	}
+	for l := range consumed {
+		if _, ok := produced[l]; !ok {
+			ls = append(ls, l)
+		}
+	}
+	sort.Strings(ls)
+	for _, l := range ls {
+		switch {
+		case produced[l] > 1:
+			return errors.Errorf("astiffmpeg: label [%s] is produced %d times", l, produced[l])
+		case consumed[l] > 1:
+			return errors.Errorf("astiffmpeg: label [%s] is consumed %d times", l, consumed[l])
+		case produced[l] == 0:
+			return errors.Errorf("astiffmpeg: label [%s] is consumed but never produced", l)
+		case consumed[l] == 0:
+			return errors.Errorf("astiffmpeg: label [%s] is neither consumed nor mapped", l)
+		}
+	}
+	return nil
+}
+
+// parseFilterPad parses the content of a pad label
+func parseFilterPad(i string) FilterPad {
+	ms := filterPadSourceRegexp.FindStringSubmatch(i)
+	if ms == nil {
+		return FilterPad{Label: i}
+	}
+	p := FilterPad{}
+	p.Input, _ = strconv.Atoi(ms[1])
+	p.Stream = parseStreamSpecifier(ms[2])
+	return p
+}
+
+// parseFilterGraph parses a filter graph. Filter descriptions are kept as is in RawFilter nodes.
+func parseFilterGraph(i string) (g FilterGraph, err error) {
+	for ci, cs := range splitFilterGraph(i, ';') {
+		var c FilterChain
+		for ni, ns := range splitFilterGraph(cs, ',') {
+			var n FilterNode
+			s := strings.TrimSpace(ns)
+
+			// Input labels
+			for strings.HasPrefix(s, "[") {
+				e := strings.Index(s, "]")
+				if e < 0 {
+					err = errors.Errorf("astiffmpeg: unterminated label in filter #%d of chain #%d", ni, ci)
+					return
+				}
+				n.Inputs = append(n.Inputs, parseFilterPad(s[1:e]))
+				s = strings.TrimSpace(s[e+1:])
+			}
+
+			// Output labels
+			for strings.HasSuffix(s, "]") && !strings.HasSuffix(s, `\]`) {
+				b := strings.LastIndex(s, "[")
+				if b < 0 {
+					err = errors.Errorf("astiffmpeg: unterminated label in filter #%d of chain #%d", ni, ci)
+					return
+				}
+				n.Outputs = append([]FilterPad{{Label: s[b+1 : len(s)-1]}}, n.Outputs...)
+				s = strings.TrimSpace(s[:b])
+			}
+
+			// Filter
+			if len(s) == 0 {
+				err = errors.Errorf("astiffmpeg: filter #%d of chain #%d is empty", ni, ci)
+				return
+			}
+			n.Filter = RawFilter(s)
+			c = append(c, n)
+		}
+		g.Chains = append(g.Chains, c)
+	}
+	return
+}
+
+// splitFilterGraph splits the filter graph on the separator, ignoring quoted and escaped separators
+func splitFilterGraph(i string, sep rune) (ss []string) {
+	var quoted, escaped bool
+	var start int
+	for idx, r := range i {
+		switch {
+		case escaped:
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '\'':
+			quoted = !quoted
+		case r == sep && !quoted:
+			ss = append(ss, i[start:idx])
+			start = idx + 1
+		}
+	}
+	return append(ss, i[start:])
+}
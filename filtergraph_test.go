@@ -0,0 +1,70 @@
+package astiffmpeg
+
+import (
+	"os/exec"
+	"testing"
+
+	"github.com/asticode/go-astitools/ptr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilterGraph(t *testing.T) {
+	g := FilterGraph{Chains: []FilterChain{
+		{{Filter: RawFilter("split"), Inputs: []FilterPad{{Stream: &StreamSpecifier{Index: astiptr.Int(0), Type: StreamSpecifierTypeVideo}}}, Outputs: []FilterPad{{Label: "a"}, {Label: "b"}}}},
+		{{Filter: RawFilter("scale=640:-2"), Inputs: []FilterPad{{Label: "a"}}}, {Filter: FpsFilter{FPS: "25"}, Outputs: []FilterPad{{Label: "small"}}}},
+		{{Filter: RawFilter("overlay"), Inputs: []FilterPad{{Label: "b"}, {Input: 1}}, Outputs: []FilterPad{{Label: "big"}}}},
+	}}
+	assert.Equal(t, "[0:v:0]split[a][b];[a]scale=640:-2,fps=fps=25[small];[b][1]overlay[big]", g.string())
+	assert.NoError(t, g.validate([]string{"small", "big"}))
+	assert.EqualError(t, g.validate([]string{"small"}), "astiffmpeg: label [big] is neither consumed nor mapped")
+	assert.EqualError(t, g.validate([]string{"small", "big", "big"}), "astiffmpeg: label [big] is consumed 2 times")
+	assert.EqualError(t, g.validate([]string{"small", "big", "missing"}), "astiffmpeg: label [missing] is consumed but never produced")
+	assert.EqualError(t, FilterGraph{Chains: []FilterChain{
+		{{Filter: RawFilter("null"), Outputs: []FilterPad{{Label: "a"}}}},
+		{{Filter: RawFilter("anull"), Outputs: []FilterPad{{Label: "a"}}}},
+	}}.validate([]string{"a"}), "astiffmpeg: label [a] is produced 2 times")
+	assert.EqualError(t, FilterGraph{Chains: []FilterChain{{{Filter: RawFilter("null"), Outputs: []FilterPad{{Input: 0}}}}}}.validate(nil), "astiffmpeg: output pad [0] of filter #0 of chain #0 is not labelled")
+
+	// Parse
+	p, err := parseFilterGraph(g.string())
+	assert.NoError(t, err)
+	assert.Equal(t, "[0:v:0]split[a][b];[a]scale=640:-2,fps=fps=25[small];[b][1]overlay[big]", p.string())
+	p, err = parseFilterGraph(`[0:v] drawtext=text='a;b,c[d]':x=1\,2 [out]`)
+	assert.NoError(t, err)
+	assert.Equal(t, FilterGraph{Chains: []FilterChain{{{
+		Filter:  RawFilter(`drawtext=text='a;b,c[d]':x=1\,2`),
+		Inputs:  []FilterPad{{Stream: &StreamSpecifier{Type: StreamSpecifierTypeVideo}}},
+		Outputs: []FilterPad{{Label: "out"}},
+	}}}}, p)
+	_, err = parseFilterGraph("[0:v]null;")
+	assert.Error(t, err)
+}
+
+func TestComplexFilterOptions(t *testing.T) {
+	// Chains are separated with ";" and the split consumes the last chain's output
+	cmd := exec.Command("ffmpeg")
+	err := Command{
+		ComplexFilter: &ComplexFilterOptions{
+			ComplexFilters: []ComplexFilter{
+				{Filters: []string{"scale=1280:720"}, InputStreams: []StreamSpecifier{{Name: "0:v"}}, OutputStreams: []StreamSpecifier{{Name: "v"}}},
+				{Filters: []string{"yadif"}, InputStreams: []StreamSpecifier{{Name: "v"}}, OutputStreams: []StreamSpecifier{{Name: "d"}}},
+			},
+			OutputNum: astiptr.Int(2),
+		},
+		Outputs: []Output{
+			{Options: &OutputOptions{Map: &MapOptions{{Name: "[out0]"}}}, Path: "out0.mp4"},
+			{Options: &OutputOptions{Extra: []string{"-map", "[out1]"}}, Path: "out1.mp4"},
+		},
+	}.adaptCmd(cmd, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ffmpeg", "-hide_banner", "-filter_complex", "[0:v]scale=1280:720[v];[v]yadif[d];[d]split=2[out0][out1]", "-map", "[out0]", "-y", "out0.mp4", "-map", "[out1]", "-y", "out1.mp4"}, cmd.Args)
+
+	// Split of the last chain
+	g, err := ComplexFilterOptions{ComplexFilters: []ComplexFilter{{Filters: []string{"yadif"}}}, OutputNum: astiptr.Int(2)}.graph()
+	assert.NoError(t, err)
+	assert.Equal(t, "yadif,split=2[out0][out1]", g.string())
+
+	// Both filter graphs
+	err = Command{ComplexFilter: &ComplexFilterOptions{}, FilterGraph: &FilterGraph{}}.adaptCmd(exec.Command("ffmpeg"), nil)
+	assert.Error(t, err)
+}
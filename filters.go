@@ -0,0 +1,972 @@
+package astiffmpeg
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// TypedFilter represents a filter with typed options
+// It can be rendered in a -filter chain through FilterOptions.Filters or in a filter graph through FilterNode.Filter,
+// and is validated in both cases before being rendered.
+type TypedFilter interface {
+	fmt.Stringer
+	Validate() error
+}
+
+// filterOption represents a key=value filter option, or a positional value when name is empty
+type filterOption struct {
+	name, value string
+}
+
+// filterOptions represents an ordered list of filter options
+// Unset values are not added.
+type filterOptions []filterOption
+
+func (os *filterOptions) add(name, value string) {
+	if len(value) > 0 {
+		*os = append(*os, filterOption{name: name, value: value})
+	}
+}
+
+func (os *filterOptions) addBool(name string, v *bool) {
+	if v != nil {
+		os.add(name, strconv.FormatBool(*v))
+	}
+}
+
+func (os *filterOptions) addDuration(name string, v *time.Duration) {
+	if v != nil {
+		os.add(name, strconv.FormatFloat(v.Seconds(), 'f', -1, 64))
+	}
+}
+
+func (os *filterOptions) addFloat(name string, v *float64) {
+	if v != nil {
+		os.add(name, strconv.FormatFloat(*v, 'f', -1, 64))
+	}
+}
+
+func (os *filterOptions) addInt(name string, v *int) {
+	if v != nil {
+		os.add(name, strconv.Itoa(*v))
+	}
+}
+
+// filterString renders a filter with its options, escaped so that the output can be used as is in a filter graph
+func filterString(name string, os filterOptions) string {
+	if len(os) == 0 {
+		return name
+	}
+	var ss []string
+	for _, o := range os {
+		v := EscapeFilterDescription(EscapeFilterOptionValue(o.value))
+		if len(o.name) > 0 {
+			v = o.name + "=" + v
+		}
+		ss = append(ss, v)
+	}
+	return name + "=" + strings.Join(ss, ":")
+}
+
+// Special characters of each escaping level
+// https://ffmpeg.org/ffmpeg-filters.html#Notes-on-filtergraph-escaping
+const (
+	filterDescriptionSpecialChars = `\'[],;`
+	filterOptionValueSpecialChars = `\':`
+)
+
+// EscapeFilterOptionValue escapes a filter option value so that it can contain colons, backslashes, quotes and leading
+// or trailing whitespaces
+// The filter description containing the value must then be escaped with EscapeFilterDescription. Typed filters do
+// both automatically.
+func EscapeFilterOptionValue(i string) string {
+	return escapeFilter(i, filterOptionValueSpecialChars)
+}
+
+// EscapeFilterDescription escapes a filter description such as "drawtext=text=a\:b" so that it can be used in a filter
+// graph or chain even if it contains brackets, commas, semicolons, backslashes, quotes or leading and trailing
+// whitespaces
+func EscapeFilterDescription(i string) string {
+	return escapeFilter(i, filterDescriptionSpecialChars)
+}
+
+// escapeFilter prefixes special characters with a backslash, which is what av_escape does. Leading and trailing
+// whitespaces are escaped as well since they would be trimmed otherwise.
+func escapeFilter(i, specials string) string {
+	first := strings.IndexFunc(i, func(r rune) bool { return !isFilterWhitespace(r) })
+	last := strings.LastIndexFunc(i, func(r rune) bool { return !isFilterWhitespace(r) })
+	if first < 0 {
+		first, last = len(i), len(i)
+	}
+	var b strings.Builder
+	for idx, r := range i {
+		if strings.ContainsRune(specials, r) || (isFilterWhitespace(r) && (idx < first || idx > last)) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func isFilterWhitespace(r rune) bool {
+	return r == ' ' || r == '\n' || r == '\t' || r == '\r'
+}
+
+// filterValidator keeps the first error found while validating a filter's options
+type filterValidator struct {
+	err    error
+	filter string
+}
+
+func (v *filterValidator) invalid(option, value, reason string) {
+	if v.err == nil {
+		v.err = &ValidationError{Cause: ErrInvalidOptionValue, Option: v.filter + " " + option, Reason: reason, Value: value}
+	}
+}
+
+func (v *filterValidator) required(option, value string) {
+	if len(value) == 0 {
+		v.invalid(option, value, "option is required")
+	}
+}
+
+func (v *filterValidator) oneOf(option, value string, values ...string) {
+	if len(value) > 0 && !containsString(values, value) {
+		v.invalid(option, value, "must be one of "+strings.Join(values, ", "))
+	}
+}
+
+func (v *filterValidator) flags(option string, fs []string, values ...string) {
+	for _, f := range fs {
+		v.oneOf(option, f, values...)
+	}
+}
+
+func (v *filterValidator) floatRange(option string, value *float64, min, max float64) {
+	if value != nil && (*value < min || *value > max) {
+		v.invalid(option, strconv.FormatFloat(*value, 'f', -1, 64), fmt.Sprintf("must be between %s and %s",
+			strconv.FormatFloat(min, 'f', -1, 64), strconv.FormatFloat(max, 'f', -1, 64)))
+	}
+}
+
+func (v *filterValidator) floatMin(option string, value *float64, min float64) {
+	if value != nil && *value < min {
+		v.invalid(option, strconv.FormatFloat(*value, 'f', -1, 64), "must be at least "+strconv.FormatFloat(min, 'f', -1, 64))
+	}
+}
+
+func (v *filterValidator) intMin(option string, value *int, min int) {
+	if value != nil && *value < min {
+		v.invalid(option, strconv.Itoa(*value), "must be at least "+strconv.Itoa(min))
+	}
+}
+
+func (v *filterValidator) intRange(option string, value *int, min, max int) {
+	if value != nil && (*value < min || *value > max) {
+		v.invalid(option, strconv.Itoa(*value), fmt.Sprintf("must be between %d and %d", min, max))
+	}
+}
+
+func (v *filterValidator) expression(option, value string) {
+	if len(value) == 0 {
+		return
+	}
+	if len(strings.TrimFunc(value, isFilterWhitespace)) == 0 {
+		v.invalid(option, value, "expression is empty")
+		return
+	}
+	var depth int
+	for _, r := range value {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth < 0 {
+				v.invalid(option, value, "unbalanced parentheses")
+				return
+			}
+		}
+	}
+	if depth != 0 {
+		v.invalid(option, value, "unbalanced parentheses")
+	}
+}
+
+// color checks the "[0x|#]RRGGBB[AA]" or name color syntax followed by an optional "@alpha"
+func (v *filterValidator) color(option, value string) {
+	if len(value) == 0 {
+		return
+	}
+
+	// Split alpha
+	c, a, hasAlpha := value, "", false
+	if i := strings.IndexByte(value, '@'); i >= 0 {
+		c, a, hasAlpha = value[:i], value[i+1:], true
+	}
+
+	// Color
+	if h := strings.TrimPrefix(strings.TrimPrefix(c, "0x"), "#"); h != c {
+		if (len(h) != 6 && len(h) != 8) || !isHex(h) {
+			v.invalid(option, value, "hex color must have 6 or 8 digits")
+			return
+		}
+	} else if len(c) == 0 || strings.IndexFunc(c, func(r rune) bool { return !unicode.IsLetter(r) }) >= 0 {
+		v.invalid(option, value, "color must be a name or a hex value")
+		return
+	}
+
+	// Alpha
+	if !hasAlpha {
+		return
+	}
+	if h := strings.TrimPrefix(a, "0x"); h != a {
+		if len(h) != 2 || !isHex(h) {
+			v.invalid(option, value, "hex alpha must have 2 digits")
+		}
+	} else if f, err := strconv.ParseFloat(a, 64); err != nil || f < 0 || f > 1 {
+		v.invalid(option, value, "alpha must be between 0 and 1")
+	}
+}
+
+func isHex(i string) bool {
+	for _, r := range i {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", r) {
+			return false
+		}
+	}
+	return true
+}
+
+// Scale flags
+const (
+	ScaleFlagAccurateRnd   = "accurate_rnd"
+	ScaleFlagArea          = "area"
+	ScaleFlagBicubic       = "bicubic"
+	ScaleFlagBicublin      = "bicublin"
+	ScaleFlagBilinear      = "bilinear"
+	ScaleFlagFastBilinear  = "fast_bilinear"
+	ScaleFlagFullChromaInp = "full_chroma_inp"
+	ScaleFlagFullChromaInt = "full_chroma_int"
+	ScaleFlagGauss         = "gauss"
+	ScaleFlagLanczos       = "lanczos"
+	ScaleFlagNeighbor      = "neighbor"
+	ScaleFlagSinc          = "sinc"
+	ScaleFlagSpline        = "spline"
+)
+
+// Scale force original aspect ratio modes
+const (
+	ScaleForceOriginalAspectRatioDecrease = "decrease"
+	ScaleForceOriginalAspectRatioDisable  = "disable"
+	ScaleForceOriginalAspectRatioIncrease = "increase"
+)
+
+// ScaleFilter represents the scale filter
+// https://ffmpeg.org/ffmpeg-filters.html#scale-1
+type ScaleFilter struct {
+	// Makes sure both dimensions are divisible by the value when ForceOriginalAspectRatio is used
+	ForceDivisibleBy *int
+	// Decreases or increases the dimensions if necessary to keep the original aspect ratio
+	ForceOriginalAspectRatio string
+	// One or more of the ScaleFlag* constants
+	Flags []string
+	// Expression such as "720", "-2" to keep the aspect ratio with an even value or "ih/2"
+	Height string
+	// Expression such as "1280", "-2" to keep the aspect ratio with an even value or "iw/2"
+	Width string
+}
+
+// NewScaleFilter creates a new scale filter
+func NewScaleFilter(width, height string) ScaleFilter {
+	return ScaleFilter{Height: height, Width: width}
+}
+
+// String implements the fmt.Stringer interface
+func (f ScaleFilter) String() string {
+	var os filterOptions
+	os.add("w", f.Width)
+	os.add("h", f.Height)
+	os.add("flags", strings.Join(f.Flags, "+"))
+	os.add("force_original_aspect_ratio", f.ForceOriginalAspectRatio)
+	os.addInt("force_divisible_by", f.ForceDivisibleBy)
+	return filterString("scale", os)
+}
+
+// Validate implements the TypedFilter interface
+func (f ScaleFilter) Validate() error {
+	v := filterValidator{filter: "scale"}
+	v.required("w", f.Width)
+	v.required("h", f.Height)
+	v.flags("flags", f.Flags, ScaleFlagAccurateRnd, ScaleFlagArea, ScaleFlagBicubic, ScaleFlagBicublin, ScaleFlagBilinear,
+		ScaleFlagFastBilinear, ScaleFlagFullChromaInp, ScaleFlagFullChromaInt, ScaleFlagGauss, ScaleFlagLanczos,
+		ScaleFlagNeighbor, ScaleFlagSinc, ScaleFlagSpline)
+	v.oneOf("force_original_aspect_ratio", f.ForceOriginalAspectRatio, ScaleForceOriginalAspectRatioDecrease,
+		ScaleForceOriginalAspectRatioDisable, ScaleForceOriginalAspectRatioIncrease)
+	v.intRange("force_divisible_by", f.ForceDivisibleBy, 1, 256)
+	if f.ForceDivisibleBy != nil && len(f.ForceOriginalAspectRatio) == 0 {
+		v.invalid("force_divisible_by", strconv.Itoa(*f.ForceDivisibleBy), "requires force_original_aspect_ratio")
+	}
+	return v.err
+}
+
+// CropFilter represents the crop filter
+// https://ffmpeg.org/ffmpeg-filters.html#crop
+type CropFilter struct {
+	// Expression such as "ih-20"
+	Height string
+	// Expression such as "iw-20"
+	Width string
+	// Expression of the left edge, the area is centered by default
+	X string
+	// Expression of the top edge, the area is centered by default
+	Y string
+}
+
+// NewCropFilter creates a new crop filter keeping the centered area
+func NewCropFilter(width, height string) CropFilter {
+	return CropFilter{Height: height, Width: width}
+}
+
+// String implements the fmt.Stringer interface
+func (f CropFilter) String() string {
+	var os filterOptions
+	os.add("w", f.Width)
+	os.add("h", f.Height)
+	os.add("x", f.X)
+	os.add("y", f.Y)
+	return filterString("crop", os)
+}
+
+// Validate implements the TypedFilter interface
+func (f CropFilter) Validate() error {
+	v := filterValidator{filter: "crop"}
+	v.required("w", f.Width)
+	v.required("h", f.Height)
+	return v.err
+}
+
+// PadFilter represents the pad filter
+// https://ffmpeg.org/ffmpeg-filters.html#pad-1
+type PadFilter struct {
+	// Color of the padded area such as "black" or "0x000000". Defaults to black.
+	Color string
+	// Expression such as "ih+20"
+	Height string
+	// Expression such as "iw+20"
+	Width string
+	// Expression of the input's left edge such as "(ow-iw)/2". Defaults to 0.
+	X string
+	// Expression of the input's top edge such as "(oh-ih)/2". Defaults to 0.
+	Y string
+}
+
+// NewPadFilter creates a new pad filter
+func NewPadFilter(width, height string) PadFilter {
+	return PadFilter{Height: height, Width: width}
+}
+
+// String implements the fmt.Stringer interface
+func (f PadFilter) String() string {
+	var os filterOptions
+	os.add("w", f.Width)
+	os.add("h", f.Height)
+	os.add("x", f.X)
+	os.add("y", f.Y)
+	os.add("color", f.Color)
+	return filterString("pad", os)
+}
+
+// Validate implements the TypedFilter interface
+func (f PadFilter) Validate() error {
+	v := filterValidator{filter: "pad"}
+	v.required("w", f.Width)
+	v.required("h", f.Height)
+	return v.err
+}
+
+// Fps round methods
+const (
+	FpsRoundDown = "down"
+	FpsRoundInf  = "inf"
+	FpsRoundNear = "near"
+	FpsRoundUp   = "up"
+	FpsRoundZero = "zero"
+)
+
+// FpsFilter represents the fps filter
+// https://ffmpeg.org/ffmpeg-filters.html#fps-1
+type FpsFilter struct {
+	// Such as "25", "30000/1001" or "ntsc"
+	FPS string
+	// One of the FpsRound* constants
+	Round string
+}
+
+// NewFpsFilter creates a new fps filter
+func NewFpsFilter(fps string) FpsFilter {
+	return FpsFilter{FPS: fps}
+}
+
+// String implements the fmt.Stringer interface
+func (f FpsFilter) String() string {
+	var os filterOptions
+	os.add("fps", f.FPS)
+	os.add("round", f.Round)
+	return filterString("fps", os)
+}
+
+// Validate implements the TypedFilter interface
+func (f FpsFilter) Validate() error {
+	v := filterValidator{filter: "fps"}
+	v.required("fps", f.FPS)
+	v.oneOf("round", f.Round, FpsRoundDown, FpsRoundInf, FpsRoundNear, FpsRoundUp, FpsRoundZero)
+	return v.err
+}
+
+// FormatFilter represents the format filter
+// https://ffmpeg.org/ffmpeg-filters.html#format-1
+type FormatFilter struct {
+	// Pixel formats such as "yuv420p", the first one supported by the next filter is used
+	PixelFormats []string
+}
+
+// NewFormatFilter creates a new format filter
+func NewFormatFilter(pixelFormats ...string) FormatFilter {
+	return FormatFilter{PixelFormats: pixelFormats}
+}
+
+// String implements the fmt.Stringer interface
+func (f FormatFilter) String() string {
+	var os filterOptions
+	os.add("pix_fmts", strings.Join(f.PixelFormats, "|"))
+	return filterString("format", os)
+}
+
+// Validate implements the TypedFilter interface
+func (f FormatFilter) Validate() error {
+	v := filterValidator{filter: "format"}
+	v.required("pix_fmts", strings.Join(f.PixelFormats, "|"))
+	return v.err
+}
+
+// Deinterlacing filters frames
+const (
+	DeinterlaceFramesAll        = "all"
+	DeinterlaceFramesInterlaced = "interlaced"
+)
+
+// Deinterlacing filters modes
+const (
+	// Outputs one frame for each field
+	DeinterlaceModeSendField          = "send_field"
+	DeinterlaceModeSendFieldNoSpatial = "send_field_nospatial"
+	// Outputs one frame for each frame
+	DeinterlaceModeSendFrame          = "send_frame"
+	DeinterlaceModeSendFrameNoSpatial = "send_frame_nospatial"
+)
+
+// Deinterlacing filters parities
+const (
+	DeinterlaceParityAuto             = "auto"
+	DeinterlaceParityBottomFieldFirst = "bff"
+	DeinterlaceParityTopFieldFirst    = "tff"
+)
+
+// YadifFilter represents the yadif deinterlacing filter
+// https://ffmpeg.org/ffmpeg-filters.html#yadif-1
+type YadifFilter struct {
+	// Which frames to deinterlace, one of the DeinterlaceFrames* constants
+	Deint string
+	// One of the DeinterlaceMode* constants
+	Mode string
+	// One of the DeinterlaceParity* constants
+	Parity string
+}
+
+// String implements the fmt.Stringer interface
+func (f YadifFilter) String() string {
+	return filterString("yadif", deinterlaceOptions(f.Mode, f.Parity, f.Deint))
+}
+
+// Validate implements the TypedFilter interface
+func (f YadifFilter) Validate() error {
+	return validateDeinterlace("yadif", f.Mode, f.Parity, f.Deint, DeinterlaceModeSendField,
+		DeinterlaceModeSendFieldNoSpatial, DeinterlaceModeSendFrame, DeinterlaceModeSendFrameNoSpatial)
+}
+
+// BwdifFilter represents the bwdif deinterlacing filter
+// https://ffmpeg.org/ffmpeg-filters.html#bwdif
+type BwdifFilter struct {
+	// Which frames to deinterlace, one of the DeinterlaceFrames* constants
+	Deint string
+	// DeinterlaceModeSendField or DeinterlaceModeSendFrame
+	Mode string
+	// One of the DeinterlaceParity* constants
+	Parity string
+}
+
+// String implements the fmt.Stringer interface
+func (f BwdifFilter) String() string {
+	return filterString("bwdif", deinterlaceOptions(f.Mode, f.Parity, f.Deint))
+}
+
+// Validate implements the TypedFilter interface
+func (f BwdifFilter) Validate() error {
+	return validateDeinterlace("bwdif", f.Mode, f.Parity, f.Deint, DeinterlaceModeSendField, DeinterlaceModeSendFrame)
+}
+
+func deinterlaceOptions(mode, parity, deint string) (os filterOptions) {
+	os.add("mode", mode)
+	os.add("parity", parity)
+	os.add("deint", deint)
+	return
+}
+
+func validateDeinterlace(filter, mode, parity, deint string, modes ...string) error {
+	v := filterValidator{filter: filter}
+	v.oneOf("mode", mode, modes...)
+	v.oneOf("parity", parity, DeinterlaceParityAuto, DeinterlaceParityBottomFieldFirst, DeinterlaceParityTopFieldFirst)
+	v.oneOf("deint", deint, DeinterlaceFramesAll, DeinterlaceFramesInterlaced)
+	return v.err
+}
+
+// Transpose directions
+const (
+	TransposeDirCounterClockwise     = "cclock"
+	TransposeDirCounterClockwiseFlip = "cclock_flip"
+	TransposeDirClockwise            = "clock"
+	TransposeDirClockwiseFlip        = "clock_flip"
+)
+
+// Transpose passthrough modes
+const (
+	TransposePassthroughLandscape = "landscape"
+	TransposePassthroughNone      = "none"
+	TransposePassthroughPortrait  = "portrait"
+)
+
+// TransposeFilter represents the transpose filter
+// https://ffmpeg.org/ffmpeg-filters.html#transpose-1
+type TransposeFilter struct {
+	// One of the TransposeDir* constants
+	Dir string
+	// Disables the transposition when the input already has the given orientation, one of the TransposePassthrough*
+	// constants
+	Passthrough string
+}
+
+// String implements the fmt.Stringer interface
+func (f TransposeFilter) String() string {
+	var os filterOptions
+	os.add("dir", f.Dir)
+	os.add("passthrough", f.Passthrough)
+	return filterString("transpose", os)
+}
+
+// Validate implements the TypedFilter interface
+func (f TransposeFilter) Validate() error {
+	v := filterValidator{filter: "transpose"}
+	v.oneOf("dir", f.Dir, TransposeDirCounterClockwise, TransposeDirCounterClockwiseFlip, TransposeDirClockwise,
+		TransposeDirClockwiseFlip)
+	v.oneOf("passthrough", f.Passthrough, TransposePassthroughLandscape, TransposePassthroughNone,
+		TransposePassthroughPortrait)
+	return v.err
+}
+
+// HFlipFilter represents the hflip filter
+// https://ffmpeg.org/ffmpeg-filters.html#hflip
+type HFlipFilter struct{}
+
+// String implements the fmt.Stringer interface
+func (f HFlipFilter) String() string {
+	return "hflip"
+}
+
+// Validate implements the TypedFilter interface
+func (f HFlipFilter) Validate() error {
+	return nil
+}
+
+// VFlipFilter represents the vflip filter
+// https://ffmpeg.org/ffmpeg-filters.html#vflip
+type VFlipFilter struct{}
+
+// String implements the fmt.Stringer interface
+func (f VFlipFilter) String() string {
+	return "vflip"
+}
+
+// Validate implements the TypedFilter interface
+func (f VFlipFilter) Validate() error {
+	return nil
+}
+
+// SetPTSFilter represents the setpts filter
+// https://ffmpeg.org/ffmpeg-filters.html#setpts_002c-asetpts
+type SetPTSFilter struct {
+	// Expression such as "PTS-STARTPTS" or "0.5*PTS"
+	Expr string
+}
+
+// NewSetPTSFilter creates a new setpts filter
+func NewSetPTSFilter(expr string) SetPTSFilter {
+	return SetPTSFilter{Expr: expr}
+}
+
+// String implements the fmt.Stringer interface
+func (f SetPTSFilter) String() string {
+	var os filterOptions
+	os.add("expr", f.Expr)
+	return filterString("setpts", os)
+}
+
+// Validate implements the TypedFilter interface
+func (f SetPTSFilter) Validate() error {
+	v := filterValidator{filter: "setpts"}
+	v.required("expr", f.Expr)
+	return v.err
+}
+
+// TrimFilter represents the trim filter
+// Timestamps are not reset, use a SetPTSFilter with "PTS-STARTPTS" afterwards to start the output at 0.
+// https://ffmpeg.org/ffmpeg-filters.html#trim
+type TrimFilter struct {
+	// Maximum duration of the output
+	Duration *time.Duration
+	// Timestamp of the first dropped frame
+	End *time.Duration
+	// Number of the first dropped frame
+	EndFrame *int
+	// Timestamp of the first kept frame
+	Start *time.Duration
+	// Number of the first kept frame
+	StartFrame *int
+}
+
+// String implements the fmt.Stringer interface
+func (f TrimFilter) String() string {
+	var os filterOptions
+	os.addDuration("start", f.Start)
+	os.addDuration("end", f.End)
+	os.addDuration("duration", f.Duration)
+	os.addInt("start_frame", f.StartFrame)
+	os.addInt("end_frame", f.EndFrame)
+	return filterString("trim", os)
+}
+
+// Validate implements the TypedFilter interface
+func (f TrimFilter) Validate() error {
+	v := filterValidator{filter: "trim"}
+	if f.Start == nil && f.End == nil && f.Duration == nil && f.StartFrame == nil && f.EndFrame == nil {
+		v.invalid("start", "", "at least one of start, end, duration, start_frame or end_frame is required")
+	}
+	if f.Start != nil && f.End != nil && *f.End <= *f.Start {
+		v.invalid("end", f.End.String(), "must be after start")
+	}
+	if f.Duration != nil && *f.Duration <= 0 {
+		v.invalid("duration", f.Duration.String(), "must be positive")
+	}
+	if f.StartFrame != nil && f.EndFrame != nil && *f.EndFrame <= *f.StartFrame {
+		v.invalid("end_frame", strconv.Itoa(*f.EndFrame), "must be after start_frame")
+	}
+	return v.err
+}
+
+// Overlay EOF actions
+const (
+	OverlayEOFActionEndAll = "endall"
+	OverlayEOFActionPass   = "pass"
+	OverlayEOFActionRepeat = "repeat"
+)
+
+// Overlay formats
+const (
+	OverlayFormatAuto   = "auto"
+	OverlayFormatGBRP   = "gbrp"
+	OverlayFormatRGB    = "rgb"
+	OverlayFormatYUV420 = "yuv420"
+	OverlayFormatYUV422 = "yuv422"
+	OverlayFormatYUV444 = "yuv444"
+)
+
+// OverlayFilter represents the overlay filter, overlaying its second input on top of its first input
+// It can only be used in a filter graph.
+// https://ffmpeg.org/ffmpeg-filters.html#overlay-1
+type OverlayFilter struct {
+	// What to do when the second input ends, one of the OverlayEOFAction* constants
+	EOFAction string
+	// One of the OverlayFormat* constants
+	Format string
+	// Ends the output when the shortest input ends
+	Shortest *bool
+	// Expression of the overlay's left edge such as "main_w-overlay_w-10"
+	X string
+	// Expression of the overlay's top edge such as "main_h-overlay_h-10"
+	Y string
+}
+
+// NewOverlayFilter creates a new overlay filter
+func NewOverlayFilter(x, y string) OverlayFilter {
+	return OverlayFilter{X: x, Y: y}
+}
+
+// String implements the fmt.Stringer interface
+func (f OverlayFilter) String() string {
+	var os filterOptions
+	os.add("x", f.X)
+	os.add("y", f.Y)
+	os.add("eof_action", f.EOFAction)
+	os.add("format", f.Format)
+	os.addBool("shortest", f.Shortest)
+	return filterString("overlay", os)
+}
+
+// Validate implements the TypedFilter interface
+func (f OverlayFilter) Validate() error {
+	v := filterValidator{filter: "overlay"}
+	v.oneOf("eof_action", f.EOFAction, OverlayEOFActionEndAll, OverlayEOFActionPass, OverlayEOFActionRepeat)
+	v.oneOf("format", f.Format, OverlayFormatAuto, OverlayFormatGBRP, OverlayFormatRGB, OverlayFormatYUV420,
+		OverlayFormatYUV422, OverlayFormatYUV444)
+	return v.err
+}
+
+// DrawTextFilter represents the drawtext filter
+// https://ffmpeg.org/ffmpeg-filters.html#drawtext-1
+type DrawTextFilter struct {
+	BorderColor string
+	BorderWidth *int
+	// Draws a box behind the text
+	Box         *bool
+	BoxBorderW  *int
+	BoxColor    string
+	Font        string // Family name used with fontconfig such as "Sans"
+	FontColor   string
+	FontFile    string
+	FontSize    string // Expression such as "24" or "h/20"
+	ShadowColor string
+	ShadowX     *int
+	ShadowY     *int
+	// Can contain expansions such as "%{pts:hms}", backslashes are rendered as is. Can't be used with TextFile.
+	Text string
+	// Can't be used with Text
+	TextFile string
+	// Expression of the text's left edge such as "(w-text_w)/2"
+	X string
+	// Expression of the text's top edge such as "h-th-10"
+	Y string
+}
+
+// NewDrawTextFilter creates a new drawtext filter
+func NewDrawTextFilter(text string) DrawTextFilter {
+	return DrawTextFilter{Text: text}
+}
+
+// String implements the fmt.Stringer interface
+func (f DrawTextFilter) String() string {
+	var os filterOptions
+	// drawtext uses backslashes to escape expansions
+	os.add("text", strings.ReplaceAll(f.Text, `\`, `\\`))
+	os.add("textfile", f.TextFile)
+	os.add("font", f.Font)
+	os.add("fontfile", f.FontFile)
+	os.add("fontsize", f.FontSize)
+	os.add("fontcolor", f.FontColor)
+	os.add("x", f.X)
+	os.add("y", f.Y)
+	os.addInt("borderw", f.BorderWidth)
+	os.add("bordercolor", f.BorderColor)
+	os.addInt("shadowx", f.ShadowX)
+	os.addInt("shadowy", f.ShadowY)
+	os.add("shadowcolor", f.ShadowColor)
+	os.addBool("box", f.Box)
+	os.addInt("boxborderw", f.BoxBorderW)
+	os.add("boxcolor", f.BoxColor)
+	return filterString("drawtext", os)
+}
+
+// Validate implements the TypedFilter interface
+func (f DrawTextFilter) Validate() error {
+	v := filterValidator{filter: "drawtext"}
+	if len(f.Text) == 0 && len(f.TextFile) == 0 {
+		v.invalid("text", "", "either text or textfile is required")
+	} else if len(f.Text) > 0 && len(f.TextFile) > 0 {
+		v.invalid("textfile", f.TextFile, "can't be used with text")
+	}
+	v.intMin("borderw", f.BorderWidth, 0)
+	v.intMin("boxborderw", f.BoxBorderW, 0)
+	return v.err
+}
+
+// DrawBox thickness filling the box
+const DrawBoxThicknessFill = "fill"
+
+// DrawBoxFilter represents the drawbox filter
+// https://ffmpeg.org/ffmpeg-filters.html#drawbox
+type DrawBoxFilter struct {
+	// Such as "red@0.5". Defaults to black.
+	Color string
+	// Expression such as "ih/4"
+	Height string
+	// Expression or DrawBoxThicknessFill to fill the box. Defaults to 3.
+	Thickness string
+	// Expression such as "iw/4"
+	Width string
+	// Expression of the left edge
+	X string
+	// Expression of the top edge
+	Y string
+}
+
+// NewDrawBoxFilter creates a new drawbox filter
+func NewDrawBoxFilter(x, y, width, height string) DrawBoxFilter {
+	return DrawBoxFilter{Height: height, Width: width, X: x, Y: y}
+}
+
+// String implements the fmt.Stringer interface
+func (f DrawBoxFilter) String() string {
+	var os filterOptions
+	os.add("x", f.X)
+	os.add("y", f.Y)
+	os.add("w", f.Width)
+	os.add("h", f.Height)
+	os.add("color", f.Color)
+	os.add("t", f.Thickness)
+	return filterString("drawbox", os)
+}
+
+// Validate implements the TypedFilter interface
+func (f DrawBoxFilter) Validate() error {
+	v := filterValidator{filter: "drawbox"}
+	v.expression("x", f.X)
+	v.expression("y", f.Y)
+	v.expression("w", f.Width)
+	v.expression("h", f.Height)
+	v.color("color", f.Color)
+	if f.Thickness != DrawBoxThicknessFill {
+		v.expression("t", f.Thickness)
+	}
+	return v.err
+}
+
+// SubtitlesFilter represents the subtitles filter, burning subtitles into the video
+// https://ffmpeg.org/ffmpeg-filters.html#subtitles-1
+type SubtitlesFilter struct {
+	// Character encoding of the subtitles such as "ISO-8859-1"
+	CharEnc string
+	// Path of a subtitles file or of a media file containing subtitles streams
+	Filename string
+	// ASS style overriding the default one such as "FontName=Arial,FontSize=24"
+	ForceStyle string
+	// Index of the subtitles stream when Filename is a media file
+	StreamIndex *int
+}
+
+// NewSubtitlesFilter creates a new subtitles filter
+func NewSubtitlesFilter(filename string) SubtitlesFilter {
+	return SubtitlesFilter{Filename: filename}
+}
+
+// String implements the fmt.Stringer interface
+func (f SubtitlesFilter) String() string {
+	var os filterOptions
+	os.add("filename", f.Filename)
+	os.add("charenc", f.CharEnc)
+	os.addInt("si", f.StreamIndex)
+	os.add("force_style", f.ForceStyle)
+	return filterString("subtitles", os)
+}
+
+// Validate implements the TypedFilter interface
+func (f SubtitlesFilter) Validate() error {
+	v := filterValidator{filter: "subtitles"}
+	v.required("filename", f.Filename)
+	v.intMin("si", f.StreamIndex, 0)
+	return v.err
+}
+
+// UnsharpFilter represents the unsharp filter, negative amounts blur the image
+// https://ffmpeg.org/ffmpeg-filters.html#unsharp-1
+type UnsharpFilter struct {
+	// Between -2 and 5. Defaults to 0.
+	ChromaAmount *float64
+	// Odd integer between 3 and 23. Defaults to 5.
+	ChromaMatrixHeight *int
+	// Odd integer between 3 and 23. Defaults to 5.
+	ChromaMatrixWidth *int
+	// Between -2 and 5. Defaults to 1.
+	LumaAmount *float64
+	// Odd integer between 3 and 23. Defaults to 5.
+	LumaMatrixHeight *int
+	// Odd integer between 3 and 23. Defaults to 5.
+	LumaMatrixWidth *int
+}
+
+// String implements the fmt.Stringer interface
+func (f UnsharpFilter) String() string {
+	var os filterOptions
+	os.addInt("lx", f.LumaMatrixWidth)
+	os.addInt("ly", f.LumaMatrixHeight)
+	os.addFloat("la", f.LumaAmount)
+	os.addInt("cx", f.ChromaMatrixWidth)
+	os.addInt("cy", f.ChromaMatrixHeight)
+	os.addFloat("ca", f.ChromaAmount)
+	return filterString("unsharp", os)
+}
+
+// Validate implements the TypedFilter interface
+func (f UnsharpFilter) Validate() error {
+	v := filterValidator{filter: "unsharp"}
+	for _, o := range []struct {
+		name  string
+		value *int
+	}{
+		{name: "lx", value: f.LumaMatrixWidth},
+		{name: "ly", value: f.LumaMatrixHeight},
+		{name: "cx", value: f.ChromaMatrixWidth},
+		{name: "cy", value: f.ChromaMatrixHeight},
+	} {
+		v.intRange(o.name, o.value, 3, 23)
+		if o.value != nil && *o.value%2 == 0 {
+			v.invalid(o.name, strconv.Itoa(*o.value), "must be odd")
+		}
+	}
+	v.floatRange("la", f.LumaAmount, -2, 5)
+	v.floatRange("ca", f.ChromaAmount, -2, 5)
+	return v.err
+}
+
+// Hqdn3dFilter represents the hqdn3d denoising filter
+// https://ffmpeg.org/ffmpeg-filters.html#hqdn3d-1
+type Hqdn3dFilter struct {
+	// Defaults to 3*LumaSpatial/4
+	ChromaSpatial *float64
+	// Defaults to LumaTemporal*ChromaSpatial/LumaSpatial
+	ChromaTemporal *float64
+	// Defaults to 4
+	LumaSpatial *float64
+	// Defaults to 6*LumaSpatial/4
+	LumaTemporal *float64
+}
+
+// String implements the fmt.Stringer interface
+func (f Hqdn3dFilter) String() string {
+	var os filterOptions
+	os.addFloat("luma_spatial", f.LumaSpatial)
+	os.addFloat("chroma_spatial", f.ChromaSpatial)
+	os.addFloat("luma_tmp", f.LumaTemporal)
+	os.addFloat("chroma_tmp", f.ChromaTemporal)
+	return filterString("hqdn3d", os)
+}
+
+// Validate implements the TypedFilter interface
+func (f Hqdn3dFilter) Validate() error {
+	v := filterValidator{filter: "hqdn3d"}
+	v.floatMin("luma_spatial", f.LumaSpatial, 0)
+	v.floatMin("chroma_spatial", f.ChromaSpatial, 0)
+	v.floatMin("luma_tmp", f.LumaTemporal, 0)
+	v.floatMin("chroma_tmp", f.ChromaTemporal, 0)
+	return v.err
+}
@@ -0,0 +1,148 @@
+package astiffmpeg
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/asticode/go-astitools/ptr"
+	pkgerrors "github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTypedFilters(t *testing.T) {
+	for _, v := range []struct {
+		f TypedFilter
+		s string
+	}{
+		{f: NewScaleFilter("1280", "-2"), s: "scale=w=1280:h=-2"},
+		{f: ScaleFilter{Flags: []string{ScaleFlagLanczos, ScaleFlagAccurateRnd}, ForceDivisibleBy: astiptr.Int(2), ForceOriginalAspectRatio: ScaleForceOriginalAspectRatioDecrease, Height: "720", Width: "1280"}, s: "scale=w=1280:h=720:flags=lanczos+accurate_rnd:force_original_aspect_ratio=decrease:force_divisible_by=2"},
+		{f: NewCropFilter("iw-20", "ih-20"), s: "crop=w=iw-20:h=ih-20"},
+		{f: PadFilter{Color: "black", Height: "720", Width: "1280", X: "(ow-iw)/2", Y: "(oh-ih)/2"}, s: "pad=w=1280:h=720:x=(ow-iw)/2:y=(oh-ih)/2:color=black"},
+		{f: FpsFilter{FPS: "30000/1001", Round: FpsRoundNear}, s: "fps=fps=30000/1001:round=near"},
+		{f: NewFormatFilter("yuv420p", "nv12"), s: "format=pix_fmts=yuv420p|nv12"},
+		{f: YadifFilter{}, s: "yadif"},
+		{f: BwdifFilter{Deint: DeinterlaceFramesInterlaced, Mode: DeinterlaceModeSendField, Parity: DeinterlaceParityTopFieldFirst}, s: "bwdif=mode=send_field:parity=tff:deint=interlaced"},
+		{f: TransposeFilter{Dir: TransposeDirClockwise, Passthrough: TransposePassthroughPortrait}, s: "transpose=dir=clock:passthrough=portrait"},
+		{f: HFlipFilter{}, s: "hflip"},
+		{f: VFlipFilter{}, s: "vflip"},
+		{f: NewSetPTSFilter("PTS-STARTPTS"), s: "setpts=expr=PTS-STARTPTS"},
+		{f: TrimFilter{End: durationPtr(12 * time.Second), Start: durationPtr(1500 * time.Millisecond)}, s: "trim=start=1.5:end=12"},
+		{f: OverlayFilter{EOFAction: OverlayEOFActionPass, Shortest: astiptr.Bool(true), X: "10", Y: "10"}, s: "overlay=x=10:y=10:eof_action=pass:shortest=true"},
+		{f: DrawTextFilter{FontColor: "white", FontSize: "24", Text: "Live", X: "10", Y: "10"}, s: "drawtext=text=Live:fontsize=24:fontcolor=white:x=10:y=10"},
+		{f: DrawBoxFilter{Color: "red@0.5", Thickness: DrawBoxThicknessFill}, s: "drawbox=color=red@0.5:t=fill"},
+		{f: DrawBoxFilter{Color: "0xFF0000@0x80", Thickness: "max(2,ih/100)", X: "(iw-w)/2"}, s: "drawbox=x=(iw-w)/2:color=0xFF0000@0x80:t=max(2\\,ih/100)"},
+		{f: UnsharpFilter{LumaAmount: astiptr.Float(1.5), LumaMatrixHeight: astiptr.Int(7), LumaMatrixWidth: astiptr.Int(7)}, s: "unsharp=lx=7:ly=7:la=1.5"},
+		{f: Hqdn3dFilter{LumaSpatial: astiptr.Float(4)}, s: "hqdn3d=luma_spatial=4"},
+	} {
+		assert.NoError(t, v.f.Validate(), v.s)
+		assert.Equal(t, v.s, v.f.String())
+	}
+
+	// Invalid
+	for _, v := range []struct {
+		err string
+		f   TypedFilter
+	}{
+		{err: "astiffmpeg: scale h: astiffmpeg: invalid option value: option is required", f: ScaleFilter{Width: "1280"}},
+		{err: "astiffmpeg: scale flags lanczoz: astiffmpeg: invalid option value: must be one of accurate_rnd, area, bicubic, bicublin, bilinear, fast_bilinear, full_chroma_inp, full_chroma_int, gauss, lanczos, neighbor, sinc, spline", f: ScaleFilter{Flags: []string{"lanczoz"}, Height: "720", Width: "1280"}},
+		{err: "astiffmpeg: scale force_divisible_by 2: astiffmpeg: invalid option value: requires force_original_aspect_ratio", f: ScaleFilter{ForceDivisibleBy: astiptr.Int(2), Height: "720", Width: "1280"}},
+		{err: "astiffmpeg: fps round nearest: astiffmpeg: invalid option value: must be one of down, inf, near, up, zero", f: FpsFilter{FPS: "25", Round: "nearest"}},
+		{err: "astiffmpeg: bwdif mode send_field_nospatial: astiffmpeg: invalid option value: must be one of send_field, send_frame", f: BwdifFilter{Mode: DeinterlaceModeSendFieldNoSpatial}},
+		{err: "astiffmpeg: trim end 1s: astiffmpeg: invalid option value: must be after start", f: TrimFilter{End: durationPtr(time.Second), Start: durationPtr(2 * time.Second)}},
+		{err: "astiffmpeg: drawbox color red@1.5: astiffmpeg: invalid option value: alpha must be between 0 and 1", f: DrawBoxFilter{Color: "red@1.5"}},
+		{err: "astiffmpeg: drawbox color 0xff00: astiffmpeg: invalid option value: hex color must have 6 or 8 digits", f: DrawBoxFilter{Color: "0xff00"}},
+		{err: "astiffmpeg: drawbox color #ff0000@0xf: astiffmpeg: invalid option value: hex alpha must have 2 digits", f: DrawBoxFilter{Color: "#ff0000@0xf"}},
+		{err: "astiffmpeg: drawbox color red 2: astiffmpeg: invalid option value: color must be a name or a hex value", f: DrawBoxFilter{Color: "red 2"}},
+		{err: "astiffmpeg: drawbox t (filled: astiffmpeg: invalid option value: unbalanced parentheses", f: DrawBoxFilter{Thickness: "(filled"}},
+		{err: "astiffmpeg: drawbox w iw/4): astiffmpeg: invalid option value: unbalanced parentheses", f: DrawBoxFilter{Width: "iw/4)"}},
+		{err: "astiffmpeg: drawtext textfile text.txt: astiffmpeg: invalid option value: can't be used with text", f: DrawTextFilter{Text: "Live", TextFile: "text.txt"}},
+		{err: "astiffmpeg: unsharp lx 4: astiffmpeg: invalid option value: must be odd", f: UnsharpFilter{LumaMatrixWidth: astiptr.Int(4)}},
+		{err: "astiffmpeg: unsharp ca 6: astiffmpeg: invalid option value: must be between -2 and 5", f: UnsharpFilter{ChromaAmount: astiptr.Float(6)}},
+		{err: "astiffmpeg: hqdn3d luma_tmp -1: astiffmpeg: invalid option value: must be at least 0", f: Hqdn3dFilter{LumaTemporal: astiptr.Float(-1)}},
+	} {
+		err := v.f.Validate()
+		assert.True(t, errors.Is(err, ErrInvalidOptionValue), v.err)
+		assert.EqualError(t, err, v.err)
+	}
+}
+
+func TestTypedFiltersRendering(t *testing.T) {
+	// Filter chain
+	cmd := exec.Command("ffmpeg")
+	err := OutputOptions{Encoding: &EncodingOptions{Filters: []StreamOption{{
+		Stream: &StreamSpecifier{Type: StreamSpecifierTypeVideo},
+		Value:  FilterOptions{Filters: []fmt.Stringer{YadifFilter{}, NewScaleFilter("1280", "-2"), NewFormatFilter("yuv420p")}},
+	}}}}.adaptCmd(cmd, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ffmpeg", "-filter:v", "yadif,scale=w=1280:h=-2,format=pix_fmts=yuv420p"}, cmd.Args)
+	err = OutputOptions{Encoding: &EncodingOptions{Filters: []StreamOption{{
+		Value: FilterOptions{Filters: []fmt.Stringer{NewScaleFilter("1280", "")}},
+	}}}}.adaptCmd(exec.Command("ffmpeg"), nil)
+	assert.True(t, errors.Is(pkgerrors.Cause(err), ErrInvalidOptionValue))
+
+	// Filter graph
+	g := FilterGraph{Chains: []FilterChain{
+		{{Filter: NewScaleFilter("320", "-2"), Inputs: []FilterPad{{Input: 1}}, Outputs: []FilterPad{{Label: "logo"}}}},
+		{{Filter: NewOverlayFilter("main_w-overlay_w-10", "10"), Inputs: []FilterPad{{Input: 0}, {Label: "logo"}}, Outputs: []FilterPad{{Label: "out"}}}},
+	}}
+	assert.NoError(t, g.validate([]string{"out"}))
+	assert.Equal(t, "[1]scale=w=320:h=-2[logo];[0][logo]overlay=x=main_w-overlay_w-10:y=10[out]", g.string())
+	g.Chains[0][0].Filter = NewScaleFilter("", "-2")
+	err = g.validate([]string{"out"})
+	assert.True(t, errors.Is(pkgerrors.Cause(err), ErrInvalidOptionValue))
+	assert.EqualError(t, err, "astiffmpeg: validating filter #0 of chain #0 failed: astiffmpeg: scale w: astiffmpeg: invalid option value: option is required")
+}
+
+func TestEscapeFilter(t *testing.T) {
+	for _, v := range []struct {
+		description string
+		i           string
+		value       string
+	}{
+		{},
+		{description: "plain", i: "plain", value: "plain"},
+		{description: `a\\:b`, i: "a:b", value: `a\:b`},
+		{description: `it\\\'s`, i: "it's", value: `it\'s`},
+		{description: `C\\:\\\\subs\\\\a.srt`, i: `C:\subs\a.srt`, value: `C\:\\subs\\a.srt`},
+		{description: `a\,b\;\[c\]`, i: "a,b;[c]", value: "a,b;[c]"},
+		{description: `\\ padded\\\ `, i: " padded ", value: `\ padded\ `},
+		{description: `\\ \\\ `, i: "  ", value: `\ \ `},
+		{description: "a b\tc", i: "a b\tc", value: "a b\tc"},
+		{description: `%{pts\\:hms}`, i: "%{pts:hms}", value: `%{pts\:hms}`},
+		{description: `€\\:€`, i: "€:€", value: `€\:€`},
+	} {
+		assert.Equal(t, v.value, EscapeFilterOptionValue(v.i), v.i)
+		assert.Equal(t, v.description, EscapeFilterDescription(EscapeFilterOptionValue(v.i)), v.i)
+	}
+
+	// Typed filters
+	for _, v := range []struct {
+		f TypedFilter
+		s string
+	}{
+		{f: NewDrawTextFilter("this is a 'string': may contain one, or more, special characters"), s: `drawtext=text=this is a \\\'string\\\'\\: may contain one\, or more\, special characters`},
+		{f: NewDrawTextFilter(`a\b`), s: `drawtext=text=a\\\\\\\\b`},
+		{f: NewDrawTextFilter(" Live "), s: `drawtext=text=\\ Live\\\ `},
+		{f: SubtitlesFilter{Filename: `C:\subs\movie [fr].srt`, ForceStyle: "FontName=Arial,FontSize=24"}, s: `subtitles=filename=C\\:\\\\subs\\\\movie \[fr\].srt:force_style=FontName=Arial\,FontSize=24`},
+		{f: NewScaleFilter("min(iw,1280)", "-2"), s: `scale=w=min(iw\,1280):h=-2`},
+	} {
+		assert.NoError(t, v.f.Validate())
+		assert.Equal(t, v.s, v.f.String())
+	}
+
+	// Filter graph
+	g := FilterGraph{Chains: []FilterChain{{
+		{Filter: NewDrawTextFilter("a;b,[c]"), Inputs: []FilterPad{{Input: 0}}},
+		{Filter: NewSubtitlesFilter("subs; final.srt"), Outputs: []FilterPad{{Label: "out"}}},
+	}}}
+	assert.Equal(t, `[0]drawtext=text=a\;b\,\[c\],subtitles=filename=subs\; final.srt[out]`, g.string())
+	p, err := parseFilterGraph(g.string())
+	assert.NoError(t, err)
+	assert.Equal(t, FilterGraph{Chains: []FilterChain{{
+		{Filter: RawFilter(`drawtext=text=a\;b\,\[c\]`), Inputs: []FilterPad{{Input: 0}}},
+		{Filter: RawFilter(`subtitles=filename=subs\; final.srt`), Outputs: []FilterPad{{Label: "out"}}},
+	}}}, p)
+}
@@ -1,6 +1,7 @@
 module github.com/ctaccel/go-astiffmpeg
 
 require (
+	github.com/BurntSushi/toml v0.3.1
 	github.com/asticode/go-astilog v1.0.0
 	github.com/asticode/go-astitools v1.0.0
 	github.com/pkg/errors v0.8.1
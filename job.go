@@ -0,0 +1,527 @@
+package astiffmpeg
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/asticode/go-astilog"
+	"github.com/pkg/errors"
+)
+
+// jobProgressBufferSize is the number of progress results buffered in a job's progress channel
+const jobProgressBufferSize = 10
+
+// Stop outcomes
+const (
+	// ffmpeg exited after "q" was written to its stdin and finalized its outputs
+	StopOutcomeGraceful = "graceful"
+	// ffmpeg exited after SIGINT which usually finalizes outputs as well
+	StopOutcomeInterrupted = "interrupted"
+	// ffmpeg was killed and its outputs are most likely unusable
+	StopOutcomeKilled = "killed"
+)
+
+// Job represents a command started with FFMpeg.Start
+// A job runs several ffmpeg processes in a row when it is retried, see RetryPolicy
+type Job struct {
+	attempts    int
+	c           Command
+	cancel      context.CancelFunc
+	ctx         context.Context
+	current     *jobAttempt
+	done        chan struct{}
+	endedAt     time.Time
+	err         error
+	estimator   *progressEstimator
+	f           *FFMpeg
+	m           *sync.Mutex
+	outputs     []string // Files created by the command that are removed between attempts
+	progress    chan DefaultStdErrResults
+	retryPolicy *RetryPolicy
+	startedAt   time.Time
+	stopCause   error
+	stopOutcome string
+	version     *Version
+}
+
+// jobAttempt represents one of the job's ffmpeg processes
+type jobAttempt struct {
+	cmd       *exec.Cmd
+	exited    chan struct{}
+	pipes     []*pipe
+	progressR *os.File
+	stdErr    io.ReadCloser
+	stdIn     io.WriteCloser
+	watchdog  *jobWatchdog
+	watched   chan struct{}
+}
+
+func newJob(ctx context.Context, cancel context.CancelFunc, f *FFMpeg, c Command, v *Version) *Job {
+	j := &Job{
+		c:           c,
+		cancel:      cancel,
+		ctx:         ctx,
+		done:        make(chan struct{}),
+		f:           f,
+		m:           &sync.Mutex{},
+		progress:    make(chan DefaultStdErrResults, jobProgressBufferSize),
+		retryPolicy: f.retryPolicy,
+		version:     v,
+	}
+	if c.RetryPolicy != nil {
+		j.retryPolicy = c.RetryPolicy
+	}
+	if j.retryPolicy != nil && !j.retryPolicy.KeepPartialOutputs {
+		j.outputs = c.removableOutputs(f.workingDir)
+	}
+	return j
+}
+
+// Attempts returns the number of ffmpeg processes started so far
+func (j *Job) Attempts() int {
+	j.m.Lock()
+	defer j.m.Unlock()
+	return j.attempts
+}
+
+// Cancel stops the job gracefully, see Configuration.StopGracePeriod
+// It doesn't wait for the job to end
+func (j *Job) Cancel() {
+	j.cancel()
+}
+
+// Done returns a channel closed once the job has ended
+func (j *Job) Done() <-chan struct{} {
+	return j.done
+}
+
+// EndedAt returns the time at which the job ended. It is zero until the job has ended.
+func (j *Job) EndedAt() time.Time {
+	j.m.Lock()
+	defer j.m.Unlock()
+	return j.endedAt
+}
+
+// PID returns the process id of the current attempt
+func (j *Job) PID() int {
+	j.m.Lock()
+	defer j.m.Unlock()
+	return j.current.cmd.Process.Pid
+}
+
+// Progress returns a channel of progress results parsed from -progress blocks when GlobalOptions.Progress is true, and
+// from stderr stats lines otherwise. It is closed once the job has ended.
+// Results are dropped when the channel is full so that a slow consumer never blocks ffmpeg.
+func (j *Job) Progress() <-chan DefaultStdErrResults {
+	return j.progress
+}
+
+// StartedAt returns the time at which the job started
+func (j *Job) StartedAt() time.Time {
+	return j.startedAt
+}
+
+// StopOutcome returns how the job was stopped. It is empty if the job was not stopped.
+func (j *Job) StopOutcome() string {
+	j.m.Lock()
+	defer j.m.Unlock()
+	return j.stopOutcome
+}
+
+// Wait waits for the job to end and returns its error
+func (j *Job) Wait() error {
+	<-j.done
+	j.m.Lock()
+	defer j.m.Unlock()
+	return j.err
+}
+
+func (j *Job) sendProgress(r DefaultStdErrResults) {
+	if j.estimator != nil {
+		j.estimator.estimate(&r)
+	}
+	select {
+	case j.progress <- r:
+	default:
+	}
+}
+
+// start starts a new ffmpeg process
+func (j *Job) start() (a *jobAttempt, err error) {
+	// Create cmd
+	// The context is not given to the cmd since it would kill ffmpeg right away
+	a = &jobAttempt{
+		cmd:     exec.Command(j.f.binaryPath),
+		exited:  make(chan struct{}),
+		watched: make(chan struct{}),
+	}
+	a.cmd.Env = os.Environ()
+	j.f.adaptCmd(a.cmd)
+
+	// Adapt cmd
+	if err = j.c.adaptCmd(a.cmd, j.version); err != nil {
+		err = errors.Wrap(err, "astiffmpeg: adapting cmd failed")
+		return
+	}
+
+	// Output is redirected in stderr only
+	if a.stdErr, err = a.cmd.StderrPipe(); err != nil {
+		err = errors.Wrap(err, "astiffmpeg: creating stderr pipe failed")
+		return
+	}
+
+	// Get pipes
+	inputPipes, outputPipes := j.c.pipes()
+	for _, p := range inputPipes {
+		a.pipes = append(a.pipes, p)
+	}
+	for _, p := range outputPipes {
+		a.pipes = append(a.pipes, p)
+	}
+
+	// Make sure pipes are closed if the process is not started
+	defer func() {
+		if err != nil {
+			for _, p := range a.pipes {
+				p.close()
+			}
+		}
+	}()
+
+	// Open pipes
+	var extraFiles = make(map[int]*os.File)
+	for _, p := range a.pipes {
+		if err = p.open(); err != nil {
+			err = errors.Wrapf(err, "astiffmpeg: opening %s failed", p.url())
+			return
+		}
+		switch p.fd {
+		case 0:
+			a.cmd.Stdin = p.child
+		case 1:
+			a.cmd.Stdout = p.child
+		default:
+			extraFiles[p.fd] = p.child
+		}
+	}
+
+	// "q" is written in stdin to stop ffmpeg gracefully unless stdin is used by an input
+	if a.cmd.Stdin == nil {
+		if a.stdIn, err = a.cmd.StdinPipe(); err != nil {
+			err = errors.Wrap(err, "astiffmpeg: creating stdin pipe failed")
+			return
+		}
+	}
+
+	// Progress is written in a dedicated pipe
+	var progressW *os.File
+	if j.c.Global.Progress {
+		if a.progressR, progressW, err = os.Pipe(); err != nil {
+			err = errors.Wrap(err, "astiffmpeg: creating progress pipe failed")
+			return
+		}
+		extraFiles[progressFD] = progressW
+	}
+
+	// Extra files are ordered by fd
+	for fd := progressFD; fd < progressFD+len(extraFiles); fd++ {
+		a.cmd.ExtraFiles = append(a.cmd.ExtraFiles, extraFiles[fd])
+	}
+
+	// Start cmd
+	astilog.Debugf("Executing %s", shellJoin(a.cmd.Args))
+	if j.f.watchdog.enabled() {
+		a.watchdog = newJobWatchdog(j.f.watchdog, time.Now())
+	}
+	err = a.cmd.Start()
+	if progressW != nil {
+		// The child has its own copy of the write end
+		progressW.Close()
+	}
+	if err != nil {
+		if a.progressR != nil {
+			a.progressR.Close()
+		}
+		err = errors.Wrapf(err, "astiffmpeg: starting %s failed", shellJoin(a.cmd.Args))
+		return
+	}
+
+	// The child has its own copy of the pipes ends
+	for _, p := range a.pipes {
+		p.child.Close()
+	}
+
+	// Update job
+	j.m.Lock()
+	j.attempts++
+	j.current = a
+	j.m.Unlock()
+
+	// Watch
+	go j.watch(a)
+	if a.watchdog != nil {
+		go j.runWatchdog(a)
+	}
+	return
+}
+
+// watch stops the process when the context is cancelled
+func (j *Job) watch(a *jobAttempt) {
+	defer close(a.watched)
+	select {
+	case <-j.ctx.Done():
+		// The context may be cancelled while the process has already exited
+		select {
+		case <-a.exited:
+		default:
+			j.stop(a)
+		}
+	case <-a.exited:
+	}
+}
+
+// stop asks ffmpeg to quit, then interrupts it and finally kills it
+func (j *Job) stop(a *jobAttempt) {
+	// Quit
+	// This is not possible when stdin is used by an input
+	astilog.Debugf("astiffmpeg: stopping pid %d", a.cmd.Process.Pid)
+	if a.stdIn != nil {
+		if _, err := a.stdIn.Write([]byte("q")); err == nil && waitExited(a.exited, j.f.stopGracePeriod) {
+			j.setStopOutcome(StopOutcomeGraceful)
+			return
+		}
+	}
+
+	// Interrupt, then kill
+	j.setStopOutcome(interruptProcess(a.cmd.Process, a.exited, j.f.stopKillTimeout))
+}
+
+// interruptProcess interrupts the process, kills it if it has not exited after timeout and returns the stop outcome
+// The outcome is empty if the process had already finished, in which case it has not been stopped.
+func interruptProcess(p *os.Process, exited <-chan struct{}, timeout time.Duration) string {
+	// Interrupt
+	// This is not supported on every platform
+	err := p.Signal(os.Interrupt)
+	if err == os.ErrProcessDone {
+		return ""
+	} else if err == nil && waitExited(exited, timeout) {
+		return StopOutcomeInterrupted
+	}
+
+	// Kill
+	if err = p.Kill(); err == os.ErrProcessDone {
+		return ""
+	} else if err != nil {
+		astilog.Error(errors.Wrapf(err, "astiffmpeg: killing pid %d failed", p.Pid))
+	}
+	return StopOutcomeKilled
+}
+
+func waitExited(exited <-chan struct{}, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-exited:
+		return true
+	case <-t.C:
+		return false
+	}
+}
+
+// stopWithCause stops the job gracefully and records why
+func (j *Job) stopWithCause(cause error) {
+	j.m.Lock()
+	if j.stopCause == nil {
+		j.stopCause = cause
+	}
+	j.m.Unlock()
+	j.cancel()
+}
+
+func (j *Job) setStopOutcome(o string) {
+	if len(o) == 0 {
+		return
+	}
+	j.m.Lock()
+	defer j.m.Unlock()
+	j.stopOutcome = o
+}
+
+// run waits for the job's processes and starts new ones as long as the retry policy allows it
+func (j *Job) run(a *jobAttempt) {
+	// Clean up
+	var err error
+	defer func() {
+		j.m.Lock()
+		j.endedAt = time.Now()
+		j.err = err
+		j.m.Unlock()
+		close(j.progress)
+		j.f.release()
+		close(j.done)
+		j.cancel()
+	}()
+
+	for {
+		// Wait
+		if err = j.wait(a); err == nil {
+			return
+		}
+
+		// Check whether the failure is retryable
+		attempts := j.Attempts()
+		if !j.retryPolicy.retryable(j.c, err, attempts) {
+			return
+		}
+
+		// Back off
+		d := j.retryPolicy.backoff(attempts)
+		astilog.Debugf("astiffmpeg: attempt #%d failed, retrying in %s: %s", attempts, d, err)
+		t := time.NewTimer(d)
+		select {
+		case <-j.ctx.Done():
+			t.Stop()
+			return
+		case <-t.C:
+		}
+
+		// Clean up partial outputs
+		if !j.retryPolicy.KeepPartialOutputs {
+			removeOutputs(j.outputs)
+		}
+
+		// Start a new process
+		var errStart error
+		j.estimator = newProgressEstimator(j.estimator.duration)
+		if a, errStart = j.start(); errStart != nil {
+			err = errors.Wrapf(errStart, "astiffmpeg: starting attempt #%d failed", attempts+1)
+			return
+		}
+	}
+}
+
+// wait reads the process pipes until they're closed, then waits for the process to exit
+func (j *Job) wait(a *jobAttempt) (err error) {
+	// Copy pipes
+	// Errors of input copies ending after the process has exited are not recorded
+	var copyDone bool
+	var copyErrs []error
+	var copyM = &sync.Mutex{}
+	var copyWg = &sync.WaitGroup{}
+	for _, p := range a.pipes {
+		if p.r == nil {
+			copyWg.Add(1)
+		}
+		go func(p *pipe) {
+			if p.r == nil {
+				defer copyWg.Done()
+			}
+			if err := p.copy(); err != nil {
+				copyM.Lock()
+				if !copyDone {
+					copyErrs = append(copyErrs, errors.Wrapf(err, "astiffmpeg: copying %s failed", p.url()))
+				}
+				copyM.Unlock()
+			}
+			p.parent.Close()
+		}(p)
+	}
+
+	// Parse progress
+	var progressDone = make(chan struct{})
+	if a.progressR != nil {
+		go func() {
+			defer close(progressDone)
+			defer a.progressR.Close()
+			p := newProgressParser(func(p Progress) {
+				j.observe(a, p.Frame, p.OutTime, p.Speed)
+				j.sendProgress(p.stdErrResults())
+				if j.f.progressHandler != nil {
+					j.f.progressHandler(p)
+				}
+				if j.c.ProgressHandler != nil {
+					j.c.ProgressHandler(p)
+				}
+			})
+			if errRead := readRecords(a.progressR, func(t time.Time, l []byte) { p.processLine(l) }); errRead != nil {
+				astilog.Error(errors.Wrap(errRead, "astiffmpeg: reading progress failed"))
+				io.Copy(ioutil.Discard, a.progressR)
+			}
+		}()
+	} else {
+		close(progressDone)
+	}
+
+	// Parse stderr
+	// Reads must be completed before waiting for the cmd
+	var r = newStdErrRecorder()
+	// Progress blocks are more accurate than stats lines and are delivered instead when available
+	var p = DefaultStdErrParser(0, func(r DefaultStdErrResults) {
+		j.observe(a, r.Frame, r.Time, r.Speed)
+		if a.progressR == nil {
+			j.sendProgress(r)
+		}
+	})
+	if errRead := readRecords(a.stdErr, func(t time.Time, l []byte) {
+		r.add(l)
+		p.ProcessLine(t, l)
+		if j.f.stdErrParser != nil {
+			j.f.stdErrParser.ProcessLine(t, l)
+		}
+		if j.c.stdErrParser != nil {
+			j.c.stdErrParser.ProcessLine(t, l)
+		}
+	}); errRead != nil {
+		astilog.Error(errors.Wrap(errRead, "astiffmpeg: reading stderr failed"))
+		io.Copy(ioutil.Discard, a.stdErr)
+	}
+
+	// Wait for progress to be read as well
+	<-progressDone
+
+	// Wait cmd
+	err = a.cmd.Wait()
+	close(a.exited)
+
+	// Wait for the stop sequence to be over
+	<-a.watched
+
+	// Wait for outputs to be copied
+	// Input readers such as network connections may block forever once the process has exited, therefore their
+	// copies are not waited for and their pipes are closed so that pending writes fail
+	copyWg.Wait()
+	for _, p := range a.pipes {
+		if p.r != nil {
+			p.parent.Close()
+		}
+	}
+	copyM.Lock()
+	copyDone = true
+	copyM.Unlock()
+
+	// Process error
+	j.m.Lock()
+	defer j.m.Unlock()
+	if len(j.stopOutcome) > 0 {
+		e := newExecError(a.cmd, err, r)
+		e.Cause = j.ctx.Err()
+		if j.stopCause != nil {
+			e.Cause = j.stopCause
+		}
+		e.CopyErrors = copyErrs
+		e.StopOutcome = j.stopOutcome
+		err = e
+	} else if err != nil {
+		e := newExecError(a.cmd, err, r)
+		e.CopyErrors = copyErrs
+		err = e
+	} else if len(copyErrs) > 0 {
+		err = copyErrs[0]
+	}
+	return
+}
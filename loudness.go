@@ -0,0 +1,301 @@
+package astiffmpeg
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/asticode/go-astitools/ptr"
+	"github.com/pkg/errors"
+)
+
+// Loudness represents loudness measurements
+type Loudness struct {
+	Integrated float64 // LUFS
+	Range      float64 // LU
+	Threshold  float64 // LUFS
+	TruePeak   float64 // dBTP
+}
+
+// Loudnorm normalization types
+const (
+	LoudnormNormalizationTypeDynamic = "dynamic"
+	LoudnormNormalizationTypeLinear  = "linear"
+)
+
+// LoudnessNormalization represents the outcome of a two-pass loudness normalization
+type LoudnessNormalization struct {
+	// Loudness of the output, measured by the second pass
+	After Loudness
+	// Loudness of the input, measured by the first pass
+	Before Loudness
+	// One of the LoudnormNormalizationType* constants, dynamic meaning the targets couldn't be reached with a fixed gain
+	NormalizationType string
+	// Offset gain between the output and the target integrated loudness, in LU
+	TargetOffset float64
+}
+
+// LoudnessNormalize normalizes the loudness of the audio of the command's single output in two passes
+// The first pass measures the loudness of the audio mapped by the output, without encoding it. The second pass runs
+// the command with a loudnorm filter, configured with the targets and the measured values, appended to the output's
+// last audio filter chain. Targets can be created with NewEBUR128LoudnormFilter. Inputs can't be readers since
+// they're read twice, outputs mapping filter graph labels are not supported, and the log level is raised to info since
+// loudnorm prints its measurements at that level.
+func (f *FFMpeg) LoudnessNormalize(ctx context.Context, c Command, targets LoudnormFilter) (n LoudnessNormalization, err error) {
+	// Check command
+	if len(c.Outputs) != 1 {
+		err = errors.Errorf("astiffmpeg: loudness normalization requires 1 output, got %d", len(c.Outputs))
+		return
+	}
+	if ls := c.mappedLabels(); len(ls) > 0 {
+		err = errors.Errorf("astiffmpeg: output maps filter graph label [%s], which is not supported", ls[0])
+		return
+	}
+	for idx, i := range c.Inputs {
+		if i.Reader != nil {
+			err = errors.Errorf("astiffmpeg: input #%d is a reader and can't be read twice", idx)
+			return
+		}
+	}
+
+	// Check targets
+	targets.PrintFormat = LoudnormPrintFormatJSON
+	if err = targets.Validate(); err != nil {
+		err = errors.Wrap(err, "astiffmpeg: validating targets failed")
+		return
+	}
+
+	// loudnorm prints its measurements at the info level
+	c.Global.Log = f.loudnormLogOptions(c.Global.Log)
+
+	// Measure
+	var m loudnormStats
+	if m, err = f.loudnormStats(ctx, loudnessMeasurementCommand(c, targets)); err != nil {
+		err = errors.Wrap(err, "astiffmpeg: measuring loudness failed")
+		return
+	}
+	if n.Before, err = m.input(); err != nil {
+		err = errors.Wrap(err, "astiffmpeg: parsing measured loudness failed")
+		return
+	}
+	if math.IsInf(n.Before.Integrated, -1) {
+		err = errors.New("astiffmpeg: measured loudness is -inf, audio is silent")
+		return
+	}
+
+	// Apply
+	var offset float64
+	if offset, err = strconv.ParseFloat(m.TargetOffset, 64); err != nil {
+		err = errors.Wrapf(err, "astiffmpeg: parsing target offset %s failed", m.TargetOffset)
+		return
+	}
+	targets.MeasuredI = astiptr.Float(n.Before.Integrated)
+	targets.MeasuredLRA = astiptr.Float(n.Before.Range)
+	targets.MeasuredThresh = astiptr.Float(n.Before.Threshold)
+	targets.MeasuredTP = astiptr.Float(n.Before.TruePeak)
+	targets.Offset = astiptr.Float(offset)
+	if targets.Linear == nil {
+		targets.Linear = astiptr.Bool(true)
+	}
+	var a loudnormStats
+	if a, err = f.loudnormStats(ctx, loudnessApplyCommand(c, targets)); err != nil {
+		err = errors.Wrap(err, "astiffmpeg: applying loudness normalization failed")
+		return
+	}
+	if n.After, err = a.output(); err != nil {
+		err = errors.Wrap(err, "astiffmpeg: parsing output loudness failed")
+		return
+	}
+	if n.TargetOffset, err = strconv.ParseFloat(a.TargetOffset, 64); err != nil {
+		err = errors.Wrapf(err, "astiffmpeg: parsing target offset %s failed", a.TargetOffset)
+		return
+	}
+	n.NormalizationType = a.NormalizationType
+	return
+}
+
+// loudnormLogOptions returns log options with a level letting loudnorm print its measurements
+func (f *FFMpeg) loudnormLogOptions(o *LogOptions) *LogOptions {
+	var l LogOptions
+	if o != nil {
+		l = *o
+	}
+	if f.global.Log != nil {
+		l = l.merge(*f.global.Log)
+	}
+	switch l.Level {
+	case LogLevelError, LogLevelFatal, LogLevelPanic, LogLevelQuiet, LogLevelWarning:
+		l.Level = LogLevelInfo
+	}
+	return &l
+}
+
+// loudnessMeasurementCommand returns the command measuring the loudness of the audio mapped by the output
+func loudnessMeasurementCommand(c Command, targets LoudnormFilter) Command {
+	// Keep the audio filters and mapping of the output
+	var fs []StreamOption
+	var m *MapOptions
+	if o := c.Outputs[0].Options; o != nil {
+		m = o.Map
+		if o.Encoding != nil {
+			for _, so := range o.Encoding.Filters {
+				if isAudioStreamOption(so) {
+					fs = append(fs, so)
+				}
+			}
+		}
+	}
+
+	// Audio is decoded and filtered, but neither encoded nor written
+	c.Outputs = []Output{{
+		Options: &OutputOptions{
+			Encoding: &EncodingOptions{
+				DisableData:     true,
+				DisableSubtitle: true,
+				DisableVideo:    true,
+				Filters:         appendAudioFilter(fs, targets),
+			},
+			Format: "null",
+			Map:    m,
+		},
+		Path: "-",
+	}}
+	return c
+}
+
+// loudnessApplyCommand returns the command with the loudnorm filter appended to the output's audio filters
+// The output is copied so that the caller's command is not modified.
+func loudnessApplyCommand(c Command, targets LoudnormFilter) Command {
+	o := c.Outputs[0]
+	var oo OutputOptions
+	if o.Options != nil {
+		oo = *o.Options
+	}
+	var e EncodingOptions
+	if oo.Encoding != nil {
+		e = *oo.Encoding
+	}
+	e.Filters = appendAudioFilter(e.Filters, targets)
+	oo.Encoding = &e
+	o.Options = &oo
+	c.Outputs = []Output{o}
+	return c
+}
+
+func isAudioStreamOption(so StreamOption) bool {
+	return so.Stream != nil && so.Stream.Type == StreamSpecifierTypeAudio
+}
+
+// appendAudioFilter appends the filter to the last audio filter chain, or to a new one applying to all audio streams
+// if there's none
+// Filter options are copied so that the input slice is not modified.
+func appendAudioFilter(fs []StreamOption, f fmt.Stringer) []StreamOption {
+	o := append([]StreamOption{}, fs...)
+	for idx := len(o) - 1; idx >= 0; idx-- {
+		v, ok := o[idx].Value.(FilterOptions)
+		if !ok || !isAudioStreamOption(o[idx]) {
+			continue
+		}
+		v.Filters = append(append([]fmt.Stringer{}, v.Filters...), f)
+		o[idx].Value = v
+		return o
+	}
+	return append(o, StreamOption{
+		Stream: &StreamSpecifier{Type: StreamSpecifierTypeAudio},
+		Value:  FilterOptions{Filters: []fmt.Stringer{f}},
+	})
+}
+
+// loudnormStats runs the command and returns the measurements printed by its loudnorm filter
+func (f *FFMpeg) loudnormStats(ctx context.Context, c Command) (s loudnormStats, err error) {
+	p := &loudnormParser{}
+	c.stdErrParser = p
+	if err = f.Exec(ctx, c); err != nil {
+		return
+	}
+	if p.stats == nil {
+		err = errors.New("astiffmpeg: no loudnorm measurements found in stderr")
+		return
+	}
+	s = *p.stats
+	return
+}
+
+// loudnormStats represents the measurements printed by loudnorm with print_format=json
+// Values are strings since they can be "-inf" or "inf".
+type loudnormStats struct {
+	InputI            string `json:"input_i"`
+	InputLRA          string `json:"input_lra"`
+	InputThresh       string `json:"input_thresh"`
+	InputTP           string `json:"input_tp"`
+	NormalizationType string `json:"normalization_type"`
+	OutputI           string `json:"output_i"`
+	OutputLRA         string `json:"output_lra"`
+	OutputThresh      string `json:"output_thresh"`
+	OutputTP          string `json:"output_tp"`
+	TargetOffset      string `json:"target_offset"`
+}
+
+func (s loudnormStats) input() (Loudness, error) {
+	return parseLoudness(s.InputI, s.InputLRA, s.InputThresh, s.InputTP)
+}
+
+func (s loudnormStats) output() (Loudness, error) {
+	return parseLoudness(s.OutputI, s.OutputLRA, s.OutputThresh, s.OutputTP)
+}
+
+func parseLoudness(i, lra, thresh, tp string) (l Loudness, err error) {
+	for _, v := range []struct {
+		dst *float64
+		s   string
+	}{
+		{dst: &l.Integrated, s: i},
+		{dst: &l.Range, s: lra},
+		{dst: &l.Threshold, s: thresh},
+		{dst: &l.TruePeak, s: tp},
+	} {
+		if *v.dst, err = strconv.ParseFloat(v.s, 64); err != nil {
+			err = errors.Wrapf(err, "astiffmpeg: parsing %s failed", v.s)
+			return
+		}
+	}
+	return
+}
+
+// loudnormParser captures the last JSON block printed by loudnorm in stderr
+// The block follows a line prefixed with the filter's name such as "[Parsed_loudnorm_0 @ 0x55d0c0a4f8c0]":
+//
+//	{
+//		"input_i" : "-27.61",
+//		...
+//	}
+type loudnormParser struct {
+	buf     *bytes.Buffer // nil when not in a block
+	pending bool          // a loudnorm line has been seen and its block has not started yet
+	stats   *loudnormStats
+}
+
+func (p *loudnormParser) ProcessLine(t time.Time, l []byte) {
+	l = bytes.TrimSpace(l)
+	switch {
+	case bytes.HasPrefix(l, []byte("[Parsed_loudnorm_")):
+		p.buf, p.pending = nil, true
+	case p.pending && bytes.Equal(l, []byte("{")):
+		p.buf, p.pending = &bytes.Buffer{}, false
+		p.buf.Write(l)
+	case p.buf != nil:
+		p.buf.Write(l)
+		if !bytes.Equal(l, []byte("}")) {
+			return
+		}
+		var s loudnormStats
+		if err := json.Unmarshal(p.buf.Bytes(), &s); err == nil {
+			p.stats = &s
+		}
+		p.buf = nil
+	}
+}
@@ -0,0 +1,113 @@
+package astiffmpeg
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/asticode/go-astitools/ptr"
+	"github.com/stretchr/testify/assert"
+)
+
+const testLoudnormScript = `echo "$*" >> "$(dirname "$0")/args"
+case "$*" in
+*silent*)
+	printf '[Parsed_loudnorm_0 @ 0x1] \n{\n\t"input_i" : "-inf",\n\t"input_tp" : "-inf",\n\t"input_lra" : "0.00",\n\t"input_thresh" : "-70.00",\n\t"output_i" : "-inf",\n\t"output_tp" : "-inf",\n\t"output_lra" : "0.00",\n\t"output_thresh" : "-70.00",\n\t"normalization_type" : "dynamic",\n\t"target_offset" : "inf"\n}\n' >&2
+	;;
+*measured_I*)
+	printf 'size=1kB time=00:00:10.00 bitrate=1.0kbits/s speed=10x\n[Parsed_loudnorm_0 @ 0x1] \n{\n\t"input_i" : "-27.61",\n\t"input_tp" : "-4.47",\n\t"input_lra" : "18.06",\n\t"input_thresh" : "-39.20",\n\t"output_i" : "-23.04",\n\t"output_tp" : "-1.02",\n\t"output_lra" : "6.90",\n\t"output_thresh" : "-33.70",\n\t"normalization_type" : "linear",\n\t"target_offset" : "0.04"\n}\n' >&2
+	;;
+*)
+	printf '[Parsed_loudnorm_0 @ 0x1] \n{\n\t"input_i" : "-27.61",\n\t"input_tp" : "-4.47",\n\t"input_lra" : "18.06",\n\t"input_thresh" : "-39.20",\n\t"output_i" : "-23.58",\n\t"output_tp" : "-1.00",\n\t"output_lra" : "7.00",\n\t"output_thresh" : "-34.10",\n\t"normalization_type" : "dynamic",\n\t"target_offset" : "0.58"\n}\n' >&2
+	;;
+esac
+`
+
+func TestFFMpegLoudnessNormalize(t *testing.T) {
+	dir, cleanup := newTestBinaries(t, map[string]string{"ffmpeg": testVersionScript + testLoudnormScript})
+	defer cleanup()
+	f := newTestFFMpeg(t, Configuration{BinaryPath: filepath.Join(dir, "ffmpeg"), Global: GlobalOptions{Log: &LogOptions{Level: LogLevelError}}})
+
+	// Normalize
+	c := Command{
+		Inputs: []Input{{Path: "input.mp4"}},
+		Outputs: []Output{{
+			Options: &OutputOptions{
+				Encoding: &EncodingOptions{
+					Codec:      []StreamOption{{Stream: &StreamSpecifier{Type: StreamSpecifierTypeAudio}, Value: "aac"}},
+					Filters:    []StreamOption{{Stream: &StreamSpecifier{Type: StreamSpecifierTypeAudio}, Value: FilterOptions{Filters: []fmt.Stringer{NewVolumeFilter("0.5")}}}},
+					SampleRate: []StreamOption{{Stream: &StreamSpecifier{Type: StreamSpecifierTypeAudio}, Value: 48000}},
+				},
+			},
+			Path: "output.mp4",
+		}},
+	}
+	n, err := f.LoudnessNormalize(context.Background(), c, NewEBUR128LoudnormFilter())
+	assert.NoError(t, err)
+	assert.Equal(t, LoudnessNormalization{
+		After:             Loudness{Integrated: -23.04, Range: 6.9, Threshold: -33.7, TruePeak: -1.02},
+		Before:            Loudness{Integrated: -27.61, Range: 18.06, Threshold: -39.2, TruePeak: -4.47},
+		NormalizationType: LoudnormNormalizationTypeLinear,
+		TargetOffset:      0.04,
+	}, n)
+	b, err := ioutil.ReadFile(filepath.Join(dir, "args"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"-hide_banner -loglevel info -i input.mp4 -filter:a volume=volume=0.5,loudnorm=I=-23:TP=-1:print_format=json -dn -sn -vn -f null -y -",
+		"-hide_banner -loglevel info -i input.mp4 -ar:a 48000 -codec:a aac -filter:a volume=volume=0.5,loudnorm=I=-23:TP=-1:measured_I=-27.61:measured_LRA=18.06:measured_TP=-4.47:measured_thresh=-39.2:offset=0.58:linear=true:print_format=json -y output.mp4",
+	}, strings.Split(strings.TrimSpace(string(b)), "\n"))
+
+	// The command is not modified
+	assert.Len(t, c.Outputs[0].Options.Encoding.Filters[0].Value.(FilterOptions).Filters, 1)
+
+	// Silent input
+	_, err = f.LoudnessNormalize(context.Background(), Command{Inputs: []Input{{Path: "silent.mp4"}}, Outputs: []Output{{Path: "output.mp4"}}}, NewEBUR128LoudnormFilter())
+	assert.EqualError(t, err, "astiffmpeg: measured loudness is -inf, audio is silent")
+
+	// Invalid
+	_, err = f.LoudnessNormalize(context.Background(), Command{Inputs: []Input{{Path: "input.mp4"}}}, NewEBUR128LoudnormFilter())
+	assert.EqualError(t, err, "astiffmpeg: loudness normalization requires 1 output, got 0")
+	_, err = f.LoudnessNormalize(context.Background(), Command{Inputs: []Input{{Reader: strings.NewReader("")}}, Outputs: []Output{{Path: "output.mp4"}}}, NewEBUR128LoudnormFilter())
+	assert.EqualError(t, err, "astiffmpeg: input #0 is a reader and can't be read twice")
+	_, err = f.LoudnessNormalize(context.Background(), Command{
+		FilterGraph: &FilterGraph{Chains: []FilterChain{{{Filter: NewVolumeFilter("0.5"), Inputs: []FilterPad{{Input: 0}}, Outputs: []FilterPad{{Label: "a"}}}}}},
+		Inputs:      []Input{{Path: "input.mp4"}},
+		Outputs:     []Output{{Options: &OutputOptions{Map: &MapOptions{{Name: "[a]"}}}, Path: "output.mp4"}},
+	}, NewEBUR128LoudnormFilter())
+	assert.EqualError(t, err, "astiffmpeg: output maps filter graph label [a], which is not supported")
+	_, err = f.LoudnessNormalize(context.Background(), c, LoudnormFilter{TruePeak: astiptr.Float(1)})
+	assert.Error(t, err)
+}
+
+func TestLoudnormParser(t *testing.T) {
+	p := &loudnormParser{}
+	for _, l := range []string{
+		`[Parsed_loudnorm_0 @ 0x55d0c0a4f8c0] `,
+		`{`,
+		`	"input_i" : "-inf",`,
+		`	"input_tp" : "-4.47",`,
+		`	"input_lra" : "18.06",`,
+		`	"input_thresh" : "-39.20",`,
+		`	"output_i" : "-23.58",`,
+		`	"output_tp" : "-1.00",`,
+		`	"output_lra" : "7.00",`,
+		`	"output_thresh" : "-34.10",`,
+		`	"normalization_type" : "dynamic",`,
+		`	"target_offset" : "0.58"`,
+		`}`,
+		`{`,
+	} {
+		p.ProcessLine(time.Now(), []byte(l))
+	}
+	assert.NotNil(t, p.stats)
+	l, err := p.stats.input()
+	assert.NoError(t, err)
+	assert.True(t, math.IsInf(l.Integrated, -1))
+	assert.Equal(t, 18.06, l.Range)
+	assert.Equal(t, "0.58", p.stats.TargetOffset)
+}
@@ -1,14 +1,17 @@
 package astiffmpeg
 
 import (
+	"io"
 	"os/exec"
 	"reflect"
+	"sort"
 	"strconv"
 
 	"fmt"
 	"strings"
 
 	"math"
+	"time"
 
 	"github.com/asticode/go-astilog"
 	"github.com/pkg/errors"
@@ -16,15 +19,49 @@ import (
 
 // GlobalOptions represents global options
 type GlobalOptions struct {
-	Log       *LogOptions
-	NoStats   bool
-	Overwrite *bool
+	// Options rendered as is after the other global options
+	Extra   []string    `toml:"extra"`
+	Log     *LogOptions `toml:"log"`
+	NoStats bool        `toml:"no_stats"`
+	// Rendered as -y when true and -n when false. When nil, -y is rendered before each output path.
+	Overwrite *bool `toml:"overwrite"`
+	// Write program-friendly progress information to a dedicated file descriptor. Progress blocks are delivered to
+	// the handler set with FFMpeg.SetProgressHandler. When building the cmd yourself, fd 3 must be provided through
+	// cmd.ExtraFiles.
+	Progress bool `toml:"progress"`
 	// Dump full command line and console output to a file named program-YYYYMMDD-HHMMSS.log in the current directory.
 	// This file can be useful for bug reports. It also implies -loglevel verbose.
-	Report bool
+	Report bool `toml:"report"`
+	// Period at which encoding progress/statistics are updated. Requires ffmpeg >= 4.4.
+	StatsPeriod Duration `toml:"stats_period"`
 }
 
-func (o GlobalOptions) adaptCmd(cmd *exec.Cmd) {
+// merge returns the options with unset values taken from the defaults, see Configuration for precedence
+func (o GlobalOptions) merge(d GlobalOptions) GlobalOptions {
+	if len(d.Extra) > 0 {
+		o.Extra = append(append([]string{}, d.Extra...), o.Extra...)
+	}
+	if d.Log != nil {
+		if o.Log == nil {
+			o.Log = d.Log
+		} else {
+			l := o.Log.merge(*d.Log)
+			o.Log = &l
+		}
+	}
+	o.NoStats = o.NoStats || d.NoStats
+	if o.Overwrite == nil {
+		o.Overwrite = d.Overwrite
+	}
+	o.Progress = o.Progress || d.Progress
+	o.Report = o.Report || d.Report
+	if o.StatsPeriod.Duration <= 0 {
+		o.StatsPeriod = d.StatsPeriod
+	}
+	return o
+}
+
+func (o GlobalOptions) adaptCmd(cmd *exec.Cmd, v *Version) (err error) {
 	cmd.Args = append(cmd.Args, "-hide_banner")
 	if o.Log != nil {
 		o.Log.adaptCmd(cmd)
@@ -39,9 +76,20 @@ func (o GlobalOptions) adaptCmd(cmd *exec.Cmd) {
 	if o.NoStats {
 		cmd.Args = append(cmd.Args, "-nostats")
 	}
+	if o.Progress {
+		cmd.Args = append(cmd.Args, "-progress", "pipe:"+strconv.Itoa(progressFD))
+	}
 	if o.Report {
 		cmd.Args = append(cmd.Args, "-report")
 	}
+	if o.StatsPeriod.Duration > 0 {
+		if err = requireVersion(v, 4, 4, "-stats_period"); err != nil {
+			return
+		}
+		cmd.Args = append(cmd.Args, "-stats_period", strconv.FormatFloat(o.StatsPeriod.Seconds(), 'f', -1, 64))
+	}
+	cmd.Args = append(cmd.Args, o.Extra...)
+	return
 }
 
 // Log levels
@@ -70,9 +118,20 @@ const (
 
 // LogOptions represents log options
 type LogOptions struct {
-	Color    *bool
-	Level    string
-	Repeated bool
+	Color    *bool  `toml:"color"`
+	Level    string `toml:"level"`
+	Repeated bool   `toml:"repeated"`
+}
+
+// merge returns the options with unset values taken from the defaults
+func (o LogOptions) merge(d LogOptions) LogOptions {
+	if o.Color == nil {
+		o.Color = d.Color
+	}
+	if len(o.Level) == 0 {
+		o.Level, o.Repeated = d.Level, d.Repeated
+	}
+	return o
 }
 
 func (o LogOptions) adaptCmd(cmd *exec.Cmd) {
@@ -183,6 +242,66 @@ func (n Number) string() (o string) {
 	return
 }
 
+// parseDuration parses an ffmpeg time duration
+// [-][HH:]MM:SS[.m...] or [-]S+[.m...][s|ms|us]
+// https://ffmpeg.org/ffmpeg-utils.html#time-duration-syntax
+func parseDuration(i string) (d time.Duration, err error) {
+	// Sign
+	var neg bool
+	if strings.HasPrefix(i, "-") {
+		neg = true
+		i = i[1:]
+	}
+
+	// Parse
+	if strings.Contains(i, ":") {
+		ps := strings.Split(i, ":")
+		if len(ps) > 3 {
+			err = fmt.Errorf("astiffmpeg: invalid duration %s", i)
+			return
+		}
+		var s float64
+		if s, err = strconv.ParseFloat(ps[len(ps)-1], 64); err != nil {
+			err = errors.Wrapf(err, "astiffmpeg: parsing seconds of %s failed", i)
+			return
+		}
+		d = time.Duration(math.Round(s * float64(time.Second)))
+		for idx, u := range []time.Duration{time.Minute, time.Hour} {
+			if len(ps)-2-idx < 0 {
+				break
+			}
+			var p int
+			if p, err = strconv.Atoi(ps[len(ps)-2-idx]); err != nil {
+				err = errors.Wrapf(err, "astiffmpeg: parsing %s failed", i)
+				return
+			}
+			d += time.Duration(p) * u
+		}
+	} else {
+		var u = time.Second
+		switch {
+		case strings.HasSuffix(i, "ms"):
+			u = time.Millisecond
+			i = strings.TrimSuffix(i, "ms")
+		case strings.HasSuffix(i, "us"):
+			u = time.Microsecond
+			i = strings.TrimSuffix(i, "us")
+		case strings.HasSuffix(i, "s"):
+			i = strings.TrimSuffix(i, "s")
+		}
+		var s float64
+		if s, err = strconv.ParseFloat(i, 64); err != nil {
+			err = errors.Wrapf(err, "astiffmpeg: parsing %s failed", i)
+			return
+		}
+		d = time.Duration(math.Round(s * float64(u)))
+	}
+	if neg {
+		d = -d
+	}
+	return
+}
+
 // Stream specifier types
 const (
 	StreamSpecifierTypeAudio                = "a"
@@ -218,6 +337,10 @@ func (s StreamSpecifier) string() (o string) {
 type Input struct {
 	Options *InputOptions
 	Path    string
+	// When set, Path is ignored and ffmpeg reads the input from a pipe fed with Reader. When building the cmd
+	// yourself, the pipe must be provided through cmd.Stdin or cmd.ExtraFiles. The job doesn't wait for Reader once
+	// ffmpeg has exited: if it blocks, closing it is up to the caller.
+	Reader io.Reader
 }
 
 func (i Input) adaptCmd(cmd *exec.Cmd) (err error) {
@@ -234,6 +357,8 @@ func (i Input) adaptCmd(cmd *exec.Cmd) (err error) {
 // InputOptions represents input options
 type InputOptions struct {
 	Decoding *DecodingOptions
+	// Options rendered as is after the other input options
+	Extra []string
 }
 
 func (o InputOptions) adaptCmd(cmd *exec.Cmd) (err error) {
@@ -243,6 +368,7 @@ func (o InputOptions) adaptCmd(cmd *exec.Cmd) (err error) {
 			return
 		}
 	}
+	cmd.Args = append(cmd.Args, o.Extra...)
 	return
 }
 
@@ -305,16 +431,24 @@ func (o DecodingOptions) adaptCmd(cmd *exec.Cmd) (err error) {
 type Output struct {
 	Options *OutputOptions
 	Path    string
+	// When set, Path is ignored and ffmpeg writes the output to a pipe copied into Writer. Since the format can't be
+	// guessed from the path, OutputOptions.Format should be set. When building the cmd yourself, the pipe must be
+	// provided through cmd.Stdout or cmd.ExtraFiles.
+	Writer io.Writer
 }
 
-func (o Output) adaptCmd(cmd *exec.Cmd) (err error) {
+// adaptCmd renders the output, with -y before its path when overwrite is true
+func (o Output) adaptCmd(cmd *exec.Cmd, v *Version, overwrite bool) (err error) {
 	if o.Options != nil {
-		if err = o.Options.adaptCmd(cmd); err != nil {
+		if err = o.Options.adaptCmd(cmd, v); err != nil {
 			err = errors.Wrap(err, "astiffmpeg: adapting cmd for output failed")
 			return
 		}
 	}
-	cmd.Args = append(cmd.Args, "-y", o.Path)
+	if overwrite {
+		cmd.Args = append(cmd.Args, "-y")
+	}
+	cmd.Args = append(cmd.Args, o.Path)
 	return
 }
 
@@ -346,6 +480,21 @@ const (
 	CoderVLC     = "vlc"
 )
 
+// FPS modes
+const (
+	FPSModeAuto        = "auto"
+	FPSModeCFR         = "cfr"
+	FPSModeDrop        = "drop"
+	FPSModePassthrough = "passthrough"
+	FPSModeVFR         = "vfr"
+)
+
+// HLS segment types
+const (
+	HlsSegmentTypeFMP4   = "fmp4"
+	HlsSegmentTypeMPEGTS = "mpegts"
+)
+
 // Presets
 const (
 	PresetUltrafast = "ultrafast"
@@ -385,16 +534,20 @@ const (
 // OutputOptions represents output options
 type OutputOptions struct {
 	Encoding *EncodingOptions
-	Format   string
-	Map      *MapOptions
+	// Options rendered as is after the other output options
+	Extra  []string
+	Format string
+	Map    *MapOptions
+	// Private options of encoders and muxers, rendered after the other output options but before Extra
+	Private []PrivateOptions
 }
 
-func (o OutputOptions) adaptCmd(cmd *exec.Cmd) (err error) {
+func (o OutputOptions) adaptCmd(cmd *exec.Cmd, v *Version) (err error) {
 	if o.Map != nil {
 		o.Map.adaptCmd(cmd)
 	}
 	if o.Encoding != nil {
-		if err = o.Encoding.adaptCmd(cmd); err != nil {
+		if err = o.Encoding.adaptCmd(cmd, v); err != nil {
 			err = errors.Wrap(err, "astiffmpeg: adapting cmd for encoding options failed")
 			return
 		}
@@ -402,9 +555,15 @@ func (o OutputOptions) adaptCmd(cmd *exec.Cmd) (err error) {
 	if len(o.Format) > 0 {
 		cmd.Args = append(cmd.Args, "-f", o.Format)
 	}
+	for _, p := range o.Private {
+		p.adaptCmd(cmd)
+	}
+	cmd.Args = append(cmd.Args, o.Extra...)
 	return
 }
 
+// ComplexFilter represents a chain of filters
+// Input streams are either input streams such as "0:v" or labels, output streams are labels.
 type ComplexFilter struct {
 	Filters       []string
 	InputStreams  []StreamSpecifier
@@ -412,86 +571,143 @@ type ComplexFilter struct {
 }
 
 // ComplexFilterOptions represents complex filter option
+// Use FilterGraph for anything more than a few chains.
 type ComplexFilterOptions struct {
+	// Splits the output of the last chain, or of the first input if there's no chain, into outputs labelled [out0],
+	// [out1], etc.
 	OutputNum      *int
 	ComplexFilters []ComplexFilter
 }
 
-func (o ComplexFilterOptions) adaptCmd(cmd *exec.Cmd) (err error) {
-	if o.OutputNum != nil {
-		s := fmt.Sprintf("split=%d", *o.OutputNum)
-		for index := 0; index < *o.OutputNum; index++ {
-			s = s + fmt.Sprintf("[out%d]", index)
+// graph converts the options into a filter graph
+func (o ComplexFilterOptions) graph() (g FilterGraph, err error) {
+	// Chains
+	for _, cf := range o.ComplexFilters {
+		var c FilterChain
+		for _, f := range cf.Filters {
+			c = append(c, FilterNode{Filter: RawFilter(f)})
+		}
+		if len(c) == 0 {
+			continue
 		}
-		o.ComplexFilters = append(o.ComplexFilters, ComplexFilter{
-			Filters: []string{s},
-		})
+		for _, i := range cf.InputStreams {
+			c[0].Inputs = append(c[0].Inputs, parseFilterPad(i.string()))
+		}
+		for _, o := range cf.OutputStreams {
+			c[len(c)-1].Outputs = append(c[len(c)-1].Outputs, FilterPad{Label: o.string()})
+		}
+		g.Chains = append(g.Chains, c)
 	}
 
-	if len(o.ComplexFilters) > 0 {
-		var vs []string
-		for _, cf := range o.ComplexFilters {
-			var v string
-			for _, i := range cf.InputStreams {
-				v += "[" + i.string() + "]"
-			}
-			v += strings.Join(cf.Filters, ",")
-			for _, o := range cf.OutputStreams {
-				v += "[" + o.string() + "]"
-			}
-			if len(v) != 0 {
-				vs = append(vs, v)
-			}
+	// Split
+	if o.OutputNum != nil {
+		n := FilterNode{Filter: RawFilter("split=" + strconv.Itoa(*o.OutputNum))}
+		for idx := 0; idx < *o.OutputNum; idx++ {
+			n.Outputs = append(n.Outputs, FilterPad{Label: "out" + strconv.Itoa(idx)})
+		}
+		if len(g.Chains) == 0 {
+			g.Chains = append(g.Chains, FilterChain{n})
+			return
+		}
+		c := g.Chains[len(g.Chains)-1]
+		switch l := c[len(c)-1]; len(l.Outputs) {
+		case 0:
+			g.Chains[len(g.Chains)-1] = append(c, n)
+		case 1:
+			n.Inputs = []FilterPad{l.Outputs[0]}
+			g.Chains = append(g.Chains, FilterChain{n})
+		default:
+			err = errors.New("astiffmpeg: the last chain has several outputs and can't be split")
+			return
 		}
-		// cmd.Args = append(cmd.Args, "-filter_complex", "\""+strings.Join(vs, ";")+"\"")
-		cmd.Args = append(cmd.Args, "-filter_complex", strings.Join(vs, ","))
-
 	}
-
 	return
 }
 
 // EncodingOptions represents encoding options
 type EncodingOptions struct {
-	AudioSamplerate    *int
-	AudioChannels      *int
-	BFrames            *int
-	Bitrate            []StreamOption
-	BStrategy          *int
-	BufSize            *Number
-	Codec              []StreamOption
-	Coder              string
-	ConstantQuality    *float64
-	CRF                *int
-	Filters            []StreamOption
-	Framerate          *float64
-	FrameSize          string
-	GOP                *int
-	KeyintMin          *int
-	Level              *float64
-	Maxrate            []StreamOption
-	Minrate            []StreamOption
-	Preset             string
-	Profile            []StreamOption
-	RateControl        string
+	// Applies to all audio streams, use SampleRate to target specific streams
+	AudioSamplerate *int
+	// Applies to all audio streams, use Channels to target specific streams
+	AudioChannels *int
+	BFrames       *int
+	// Number values such as 128k, use a StreamSpecifierTypeAudio stream for -b:a
+	Bitrate   []StreamOption
+	BStrategy *int
+	BufSize   *Number
+	// String values such as ChannelLayoutStereo
+	ChannelLayout []StreamOption
+	// Int values
+	Channels        []StreamOption
+	Codec           []StreamOption
+	Coder           string
+	ConstantQuality *float64
+	CRF             *int
+	DisableAudio    bool
+	DisableData     bool
+	DisableSubtitle bool
+	DisableVideo    bool
+	// FilterOptions values, use a StreamSpecifierTypeAudio stream for -af
+	Filters []StreamOption
+	// Rendered as -vsync with ffmpeg < 5.1
+	FPSMode     string
+	Framerate   *float64
+	FrameSize   string
+	GOP         *int
+	KeyintMin   *int
+	Level       *float64
+	Maxrate     []StreamOption
+	Minrate     []StreamOption
+	Preset      string
+	Profile     []StreamOption
+	RateControl string
+	// String values such as SampleFormatFLTP
+	SampleFormat []StreamOption
+	// Int values
+	SampleRate         []StreamOption
 	SCThreshold        *int
 	Tune               string
 	MaxMuxingQSize     *int
 	Customize          map[string]interface{} // the third party, e.g IDT
-	RemoveAudio        string
 	HlsTime            *int
 	HlsListSize        *int
 	HlsKeyInfoFile     string
 	HlsSegmentFileName string
+	// HlsSegmentTypeFMP4 requires ffmpeg >= 3.4
+	HlsSegmentType string
 }
 
-func (o EncodingOptions) adaptCmd(cmd *exec.Cmd) (err error) {
+func (o EncodingOptions) adaptCmd(cmd *exec.Cmd, v *Version) (err error) {
 	if o.AudioSamplerate != nil {
 		cmd.Args = append(cmd.Args, "-ar", strconv.Itoa(*o.AudioSamplerate))
 	}
 	if o.AudioChannels != nil {
 		cmd.Args = append(cmd.Args, "-ac", strconv.Itoa(*o.AudioChannels))
 	}
+	for idx, ro := range o.SampleRate {
+		if err = ro.adaptCmd(cmd, "-ar", intStreamOptionValue); err != nil {
+			err = errors.Wrapf(err, "astiffmpeg: adapting cmd for -ar option #%d failed", idx)
+			return
+		}
+	}
+	for idx, ro := range o.Channels {
+		if err = ro.adaptCmd(cmd, "-ac", intStreamOptionValue); err != nil {
+			err = errors.Wrapf(err, "astiffmpeg: adapting cmd for -ac option #%d failed", idx)
+			return
+		}
+	}
+	for idx, ro := range o.ChannelLayout {
+		if err = ro.adaptCmd(cmd, "-channel_layout", stringStreamOptionValue); err != nil {
+			err = errors.Wrapf(err, "astiffmpeg: adapting cmd for -channel_layout option #%d failed", idx)
+			return
+		}
+	}
+	for idx, ro := range o.SampleFormat {
+		if err = ro.adaptCmd(cmd, "-sample_fmt", stringStreamOptionValue); err != nil {
+			err = errors.Wrapf(err, "astiffmpeg: adapting cmd for -sample_fmt option #%d failed", idx)
+			return
+		}
+	}
 	if o.BFrames != nil {
 		cmd.Args = append(cmd.Args, "-bf", strconv.Itoa(*o.BFrames))
 	}
@@ -537,6 +753,9 @@ func (o EncodingOptions) adaptCmd(cmd *exec.Cmd) (err error) {
 	for idx, ro := range o.Filters {
 		if err = ro.adaptCmd(cmd, "-filter", func(i interface{}) (string, error) {
 			if v, ok := i.(FilterOptions); ok {
+				if err := v.validate(); err != nil {
+					return "", err
+				}
 				return v.string(), nil
 			}
 			return "", errors.New("astiffmpeg: value should be a FilterOptions")
@@ -545,6 +764,13 @@ func (o EncodingOptions) adaptCmd(cmd *exec.Cmd) (err error) {
 			return
 		}
 	}
+	if len(o.FPSMode) > 0 {
+		if v == nil || v.AtLeast(5, 1) {
+			cmd.Args = append(cmd.Args, "-fps_mode", o.FPSMode)
+		} else {
+			cmd.Args = append(cmd.Args, "-vsync", o.FPSMode)
+		}
+	}
 	if o.Framerate != nil {
 		cmd.Args = append(cmd.Args, "-r", strconv.FormatFloat(*o.Framerate, 'f', 3, 64))
 	}
@@ -620,7 +846,21 @@ func (o EncodingOptions) adaptCmd(cmd *exec.Cmd) (err error) {
 	if len(o.HlsSegmentFileName) > 0 {
 		cmd.Args = append(cmd.Args, "-hls_segment_filename", o.HlsSegmentFileName)
 	}
-	for key, value := range o.Customize {
+	if len(o.HlsSegmentType) > 0 {
+		if o.HlsSegmentType == HlsSegmentTypeFMP4 {
+			if err = requireVersion(v, 3, 4, "-hls_segment_type fmp4"); err != nil {
+				return
+			}
+		}
+		cmd.Args = append(cmd.Args, "-hls_segment_type", o.HlsSegmentType)
+	}
+	var keys []string
+	for key := range o.Customize {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value := o.Customize[key]
 		t := reflect.TypeOf(value)
 		switch t.Kind() {
 		case reflect.Int:
@@ -631,12 +871,35 @@ func (o EncodingOptions) adaptCmd(cmd *exec.Cmd) (err error) {
 			cmd.Args = append(cmd.Args, fmt.Sprintf("-%s", key), value.(string))
 		}
 	}
-	if o.RemoveAudio == "y" {
+	if o.DisableAudio {
 		cmd.Args = append(cmd.Args, "-an")
 	}
+	if o.DisableData {
+		cmd.Args = append(cmd.Args, "-dn")
+	}
+	if o.DisableSubtitle {
+		cmd.Args = append(cmd.Args, "-sn")
+	}
+	if o.DisableVideo {
+		cmd.Args = append(cmd.Args, "-vn")
+	}
 	return
 }
 
+func intStreamOptionValue(i interface{}) (string, error) {
+	if v, ok := i.(int); ok {
+		return strconv.Itoa(v), nil
+	}
+	return "", errors.New("astiffmpeg: value should be an int")
+}
+
+func stringStreamOptionValue(i interface{}) (string, error) {
+	if v, ok := i.(string); ok {
+		return v, nil
+	}
+	return "", errors.New("astiffmpeg: value should be a string")
+}
+
 // Ratio represents a ration
 type Ratio struct {
 	Antecedent, Consequent int
@@ -657,6 +920,8 @@ func (s Scale) string() string {
 
 // FilterOptions represents filter options
 type FilterOptions struct {
+	// Filters rendered after the other ones, such as a ScaleFilter. Typed filters are validated.
+	Filters  []fmt.Stringer
 	SAR      *Ratio
 	ScaleNPP *Scale
 }
@@ -665,6 +930,32 @@ func (o FilterOptions) add(k, v string) string {
 	return fmt.Sprintf("%s=%s", k, v)
 }
 
+// names returns the names of the filters
+func (o FilterOptions) names() (ns []string) {
+	if o.SAR != nil {
+		ns = append(ns, "setsar")
+	}
+	if o.ScaleNPP != nil {
+		ns = append(ns, "scale_npp")
+	}
+	for _, f := range o.Filters {
+		ns = append(ns, strings.SplitN(f.String(), "=", 2)[0])
+	}
+	return
+}
+
+// validate validates the typed filters
+func (o FilterOptions) validate() error {
+	for _, f := range o.Filters {
+		if tf, ok := f.(TypedFilter); ok {
+			if err := tf.Validate(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 func (o FilterOptions) string() string {
 	var items []string
 	if o.SAR != nil {
@@ -673,6 +964,9 @@ func (o FilterOptions) string() string {
 	if o.ScaleNPP != nil {
 		items = append(items, o.add("scale_npp", o.ScaleNPP.string()))
 	}
+	for _, f := range o.Filters {
+		items = append(items, f.String())
+	}
 	return strings.Join(items, ",")
 }
 
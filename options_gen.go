@@ -0,0 +1,280 @@
+// Code generated by astiffmpeg-gen from testdata/ffmpeg-help-full.txt. DO NOT EDIT.
+
+package astiffmpeg
+
+import (
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// AacEncoderOptions represents the options of the aac encoder
+type AacEncoderOptions struct {
+	// Coding algorithm. Defaults to fast.
+	AacCoder string
+	// Perceptual noise substitution. Defaults to true.
+	AacPns *bool
+	// Restricts the options to the matching output streams
+	Stream *StreamSpecifier
+}
+
+func (o AacEncoderOptions) adaptCmd(cmd *exec.Cmd) {
+	if len(o.AacCoder) > 0 {
+		cmd.Args = append(cmd.Args, avOptionFlag("aac_coder", o.Stream), o.AacCoder)
+	}
+	if o.AacPns != nil {
+		cmd.Args = append(cmd.Args, avOptionFlag("aac_pns", o.Stream), strconv.FormatBool(*o.AacPns))
+	}
+}
+
+// Aac encoder aac_coder values
+const (
+	// ANMR method.
+	AacEncoderAacCoderAnmr = "anmr"
+	// Two loop searching method.
+	AacEncoderAacCoderTwoloop = "twoloop"
+	// Default fast search.
+	AacEncoderAacCoderFast = "fast"
+)
+
+// Libx264EncoderOptions represents the options of the libx264 encoder
+type Libx264EncoderOptions struct {
+	// AQ method. Defaults to -1.
+	AqMode string
+	// AQ strength. Reduces blocking and blurring in flat and textured areas. Defaults to -1.
+	AqStrength *float64
+	// Select the quality for constant quality mode. Defaults to -1.
+	Crf *float64
+	// Use fast settings when encoding first pass. Defaults to true.
+	Fastfirstpass *bool
+	// Signal HRD information (requires vbv-bufsize; cbr not allowed in .mp4). Defaults to -1.
+	NalHrd string
+	// Set the encoding preset (cf. x264 --fullhelp). Defaults to medium.
+	Preset string
+	// Set profile restrictions (cf. x264 --fullhelp).
+	Profile string
+	// Tune the encoding params (cf. x264 --fullhelp).
+	Tune string
+	// Override the x264 configuration using a :-separated list of key=value parameters.
+	X264Params map[string]string
+	// Restricts the options to the matching output streams
+	Stream *StreamSpecifier
+}
+
+func (o Libx264EncoderOptions) adaptCmd(cmd *exec.Cmd) {
+	if len(o.AqMode) > 0 {
+		cmd.Args = append(cmd.Args, avOptionFlag("aq-mode", o.Stream), o.AqMode)
+	}
+	if o.AqStrength != nil {
+		cmd.Args = append(cmd.Args, avOptionFlag("aq-strength", o.Stream), strconv.FormatFloat(*o.AqStrength, 'f', -1, 64))
+	}
+	if o.Crf != nil {
+		cmd.Args = append(cmd.Args, avOptionFlag("crf", o.Stream), strconv.FormatFloat(*o.Crf, 'f', -1, 64))
+	}
+	if o.Fastfirstpass != nil {
+		cmd.Args = append(cmd.Args, avOptionFlag("fastfirstpass", o.Stream), strconv.FormatBool(*o.Fastfirstpass))
+	}
+	if len(o.NalHrd) > 0 {
+		cmd.Args = append(cmd.Args, avOptionFlag("nal-hrd", o.Stream), o.NalHrd)
+	}
+	if len(o.Preset) > 0 {
+		cmd.Args = append(cmd.Args, avOptionFlag("preset", o.Stream), o.Preset)
+	}
+	if len(o.Profile) > 0 {
+		cmd.Args = append(cmd.Args, avOptionFlag("profile", o.Stream), o.Profile)
+	}
+	if len(o.Tune) > 0 {
+		cmd.Args = append(cmd.Args, avOptionFlag("tune", o.Stream), o.Tune)
+	}
+	if len(o.X264Params) > 0 {
+		cmd.Args = append(cmd.Args, avOptionFlag("x264-params", o.Stream), avOptionDictionary(o.X264Params))
+	}
+}
+
+// Libx264 encoder aq-mode values
+const (
+	Libx264EncoderAqModeNone = "none"
+	// Variance AQ (complexity mask).
+	Libx264EncoderAqModeVariance = "variance"
+	// Auto-variance AQ.
+	Libx264EncoderAqModeAutovariance = "autovariance"
+	// Auto-variance AQ with bias to dark scenes.
+	Libx264EncoderAqModeAutovarianceBiased = "autovariance-biased"
+)
+
+// Libx264 encoder nal-hrd values
+const (
+	Libx264EncoderNalHrdNone = "none"
+	Libx264EncoderNalHrdVbr  = "vbr"
+	Libx264EncoderNalHrdCbr  = "cbr"
+)
+
+// HlsMuxerOptions represents the options of the hls muxer
+type HlsMuxerOptions struct {
+	// Set flags affecting HLS playlist and media file generation. Defaults to 0.
+	HlsFlags []string
+	// Set segment length at init list. Defaults to 0.
+	HlsInitTime *time.Duration
+	// Set maximum number of playlist entries. Defaults to 5.
+	HlsListSize *int
+	// Set the HLS playlist type. Defaults to 0.
+	HlsPlaylistType string
+	// Filename template for segment files.
+	HlsSegmentFilename string
+	// Set hls segment files type. Defaults to mpegts.
+	HlsSegmentType string
+	// Set segment length. Defaults to 2.
+	HlsTime *time.Duration
+	// Set the HTTP method(default: PUT).
+	Method string
+	// Set first number in the sequence. Defaults to 0.
+	StartNumber *int64
+}
+
+func (o HlsMuxerOptions) adaptCmd(cmd *exec.Cmd) {
+	if len(o.HlsFlags) > 0 {
+		cmd.Args = append(cmd.Args, "-hls_flags", avOptionFlags(o.HlsFlags))
+	}
+	if o.HlsInitTime != nil {
+		cmd.Args = append(cmd.Args, "-hls_init_time", strconv.FormatFloat(o.HlsInitTime.Seconds(), 'f', -1, 64))
+	}
+	if o.HlsListSize != nil {
+		cmd.Args = append(cmd.Args, "-hls_list_size", strconv.Itoa(*o.HlsListSize))
+	}
+	if len(o.HlsPlaylistType) > 0 {
+		cmd.Args = append(cmd.Args, "-hls_playlist_type", o.HlsPlaylistType)
+	}
+	if len(o.HlsSegmentFilename) > 0 {
+		cmd.Args = append(cmd.Args, "-hls_segment_filename", o.HlsSegmentFilename)
+	}
+	if len(o.HlsSegmentType) > 0 {
+		cmd.Args = append(cmd.Args, "-hls_segment_type", o.HlsSegmentType)
+	}
+	if o.HlsTime != nil {
+		cmd.Args = append(cmd.Args, "-hls_time", strconv.FormatFloat(o.HlsTime.Seconds(), 'f', -1, 64))
+	}
+	if len(o.Method) > 0 {
+		cmd.Args = append(cmd.Args, "-method", o.Method)
+	}
+	if o.StartNumber != nil {
+		cmd.Args = append(cmd.Args, "-start_number", strconv.FormatInt(*o.StartNumber, 10))
+	}
+}
+
+// Hls muxer hls_flags values
+const (
+	// Generate a single media file indexed with byte ranges.
+	HlsMuxerHlsFlagsSingleFile = "single_file"
+	// Delete segment files that are no longer part of the playlist.
+	HlsMuxerHlsFlagsDeleteSegments = "delete_segments"
+	// Add EXT-X-INDEPENDENT-SEGMENTS, whenever applicable.
+	HlsMuxerHlsFlagsIndependentSegments = "independent_segments"
+)
+
+// Hls muxer hls_playlist_type values
+const (
+	// EVENT playlist.
+	HlsMuxerHlsPlaylistTypeEvent = "event"
+	// VOD playlist.
+	HlsMuxerHlsPlaylistTypeVod = "vod"
+)
+
+// Hls muxer hls_segment_type values
+const (
+	// Make segment file to mpegts files in m3u8.
+	HlsMuxerHlsSegmentTypeMpegts = "mpegts"
+	// Make segment file to fragment mp4 files in m3u8.
+	HlsMuxerHlsSegmentTypeFmp4 = "fmp4"
+)
+
+// Mp4MuxerOptions represents the options of the mp4 muxer
+type Mp4MuxerOptions struct {
+	// Maximum fragment duration. Defaults to 0.
+	FragDuration *int
+	// MOV muxer flags. Defaults to 0.
+	Movflags []string
+}
+
+func (o Mp4MuxerOptions) adaptCmd(cmd *exec.Cmd) {
+	if o.FragDuration != nil {
+		cmd.Args = append(cmd.Args, "-frag_duration", strconv.Itoa(*o.FragDuration))
+	}
+	if len(o.Movflags) > 0 {
+		cmd.Args = append(cmd.Args, "-movflags", avOptionFlags(o.Movflags))
+	}
+}
+
+// Mp4 muxer movflags values
+const (
+	// Add RTP hint tracks.
+	Mp4MuxerMovflagsRtphint = "rtphint"
+	// Make the initial moov atom empty.
+	Mp4MuxerMovflagsEmptyMoov = "empty_moov"
+	// Fragment at video keyframes.
+	Mp4MuxerMovflagsFragKeyframe = "frag_keyframe"
+	// Run a second pass to put the index (moov atom) at the beginning of the file.
+	Mp4MuxerMovflagsFaststart = "faststart"
+)
+
+// EqFilterOptions represents the options of the eq filter
+type EqFilterOptions struct {
+	// Set the brightness adjustment. Defaults to 0.0.
+	Brightness string
+	// Set the contrast adjustment, negative values give a negative image. Defaults to 1.0.
+	Contrast string
+	// Specify when to evaluate expressions. Defaults to init.
+	Eval string
+	// Set the initial gamma value. Defaults to 1.0.
+	Gamma string
+	// Gamma value for blue. Defaults to 1.0.
+	GammaB string
+	// Gamma value for green. Defaults to 1.0.
+	GammaG string
+	// Gamma value for red. Defaults to 1.0.
+	GammaR string
+	// Set the gamma weight which reduces the effect of gamma on bright areas. Defaults to 1.0.
+	GammaWeight string
+	// Set the saturation adjustment. Defaults to 1.0.
+	Saturation string
+}
+
+// String implements the fmt.Stringer interface
+func (o EqFilterOptions) String() string {
+	var os filterOptions
+	if len(o.Brightness) > 0 {
+		os.add("brightness", o.Brightness)
+	}
+	if len(o.Contrast) > 0 {
+		os.add("contrast", o.Contrast)
+	}
+	if len(o.Eval) > 0 {
+		os.add("eval", o.Eval)
+	}
+	if len(o.Gamma) > 0 {
+		os.add("gamma", o.Gamma)
+	}
+	if len(o.GammaB) > 0 {
+		os.add("gamma_b", o.GammaB)
+	}
+	if len(o.GammaG) > 0 {
+		os.add("gamma_g", o.GammaG)
+	}
+	if len(o.GammaR) > 0 {
+		os.add("gamma_r", o.GammaR)
+	}
+	if len(o.GammaWeight) > 0 {
+		os.add("gamma_weight", o.GammaWeight)
+	}
+	if len(o.Saturation) > 0 {
+		os.add("saturation", o.Saturation)
+	}
+	return filterString("eq", os)
+}
+
+// Eq filter eval values
+const (
+	// Eval expressions once during initialization.
+	EqFilterEvalInit = "init"
+	// Eval expressions per-frame.
+	EqFilterEvalFrame = "frame"
+)
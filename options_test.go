@@ -3,7 +3,9 @@ package astiffmpeg
 import (
 	"math"
 	"testing"
+	"time"
 
+	"github.com/asticode/go-astitools/ptr"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -34,3 +36,55 @@ func TestNumber(t *testing.T) {
 		}
 	}
 }
+
+func TestParseDuration(t *testing.T) {
+	for _, i := range []struct {
+		d        time.Duration
+		hasError bool
+		i        string
+	}{
+		{hasError: true, i: "abc"},
+		{hasError: true, i: "1:2:3:4"},
+		{d: 55 * time.Second, i: "55"},
+		{d: 200 * time.Millisecond, i: "0.2"},
+		{d: 200 * time.Millisecond, i: "200ms"},
+		{d: 200 * time.Microsecond, i: "200us"},
+		{d: 12*time.Minute + 3*time.Second, i: "12:03"},
+		{d: 23*time.Hour + 189*time.Millisecond, i: "23:00:00.189"},
+		{d: -2*time.Minute - 500*time.Millisecond, i: "-02:00.5"},
+		{d: 3 * time.Second, i: "3s"},
+	} {
+		d, err := parseDuration(i.i)
+		if i.hasError {
+			assert.Error(t, err, i.i)
+		} else {
+			assert.NoError(t, err, i.i)
+			assert.Equal(t, i.d, d, i.i)
+		}
+	}
+}
+
+func TestGlobalOptionsMerge(t *testing.T) {
+	d := GlobalOptions{
+		Extra:       []string{"-a"},
+		Log:         &LogOptions{Color: astiptr.Bool(false), Level: LogLevelError, Repeated: true},
+		NoStats:     true,
+		Overwrite:   astiptr.Bool(true),
+		StatsPeriod: Duration{Duration: time.Second},
+	}
+	assert.Equal(t, d, GlobalOptions{}.merge(d))
+	assert.Equal(t, GlobalOptions{
+		Extra:       []string{"-a", "-b"},
+		Log:         &LogOptions{Color: astiptr.Bool(false), Level: LogLevelInfo},
+		NoStats:     true,
+		Overwrite:   astiptr.Bool(false),
+		Progress:    true,
+		StatsPeriod: Duration{Duration: 2 * time.Second},
+	}, GlobalOptions{
+		Extra:       []string{"-b"},
+		Log:         &LogOptions{Level: LogLevelInfo},
+		Overwrite:   astiptr.Bool(false),
+		Progress:    true,
+		StatsPeriod: Duration{Duration: 2 * time.Second},
+	}.merge(d))
+}
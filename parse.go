@@ -0,0 +1,543 @@
+package astiffmpeg
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/asticode/go-astitools/ptr"
+	"github.com/pkg/errors"
+)
+
+// argsBooleanFlags are the flags that don't take a value, "-no" prefixed flags being their negation. Every other flag
+// is expected to take one.
+var argsBooleanFlags = map[string]bool{
+	"-accurate_seek":              true,
+	"-an":                         true,
+	"-autorotate":                 true,
+	"-autoscale":                  true,
+	"-benchmark":                  true,
+	"-benchmark_all":              true,
+	"-bitexact":                   true,
+	"-copy_unknown":               true,
+	"-copyinkf":                   true,
+	"-copyts":                     true,
+	"-debug_ts":                   true,
+	"-display_hflip":              true,
+	"-display_vflip":              true,
+	"-dn":                         true,
+	"-dump":                       true,
+	"-find_stream_info":           true,
+	"-fix_sub_duration":           true,
+	"-fix_sub_duration_heartbeat": true,
+	"-hex":                        true,
+	"-hide_banner":                true,
+	"-ignore_chapters":            true,
+	"-ignore_unknown":             true,
+	"-n":                          true,
+	"-nostdin":                    true,
+	"-psnr":                       true,
+	"-qphist":                     true,
+	"-re":                         true,
+	"-recast_media":               true,
+	"-report":                     true,
+	"-shortest":                   true,
+	"-sn":                         true,
+	"-start_at_zero":              true,
+	"-stats":                      true,
+	"-stdin":                      true,
+	"-vn":                         true,
+	"-vstats":                     true,
+	"-xerror":                     true,
+	"-y":                          true,
+}
+
+// argsGlobalFlags are the flags applying to the whole command whatever their position
+var argsGlobalFlags = map[string]bool{
+	"-abort_on":               true,
+	"-benchmark":              true,
+	"-benchmark_all":          true,
+	"-copy_unknown":           true,
+	"-copytb":                 true,
+	"-copyts":                 true,
+	"-debug_ts":               true,
+	"-dump":                   true,
+	"-filter_complex_threads": true,
+	"-filter_hw_device":       true,
+	"-filter_threads":         true,
+	"-hex":                    true,
+	"-hide_banner":            true,
+	"-ignore_unknown":         true,
+	"-init_hw_device":         true,
+	"-loglevel":               true,
+	"-max_error_rate":         true,
+	"-n":                      true,
+	"-nostats":                true,
+	"-nostdin":                true,
+	"-progress":               true,
+	"-report":                 true,
+	"-sdp_file":               true,
+	"-start_at_zero":          true,
+	"-stats":                  true,
+	"-stats_period":           true,
+	"-timelimit":              true,
+	"-v":                      true,
+	"-vstats":                 true,
+	"-vstats_file":            true,
+	"-xerror":                 true,
+}
+
+// argsStreamSpecifierRegexp matches stream specifiers that StreamSpecifier can describe
+var argsStreamSpecifierRegexp = regexp.MustCompile(`^(?:([asvV])(?::(\d+))?|(\d+))$`)
+
+// arg represents a parsed flag and its value
+type arg struct {
+	flag     string // E.g. "-c:v"
+	hasValue bool
+	name     string // E.g. "-c"
+	spec     string // E.g. "v"
+	value    string
+}
+
+func (a arg) args() []string {
+	if a.hasValue {
+		return []string{a.flag, a.value}
+	}
+	return []string{a.flag}
+}
+
+// ParseArgs parses an ffmpeg command line, without the binary, into a command
+// Options that the option structs can't describe are kept as is in the Extra field of their level so that the
+// command renders back to an equivalent command line.
+func ParseArgs(args []string) (c Command, err error) {
+	// Loop through args
+	var pending []arg
+	for idx := 0; idx < len(args); idx++ {
+		// Output path
+		if !isArgFlag(args[idx]) {
+			var o *OutputOptions
+			if o, err = parseOutputOptions(pending); err != nil {
+				err = errors.Wrapf(err, "astiffmpeg: parsing options of output %s failed", args[idx])
+				return
+			}
+			c.Outputs = append(c.Outputs, Output{Options: o, Path: args[idx]})
+			pending = nil
+			continue
+		}
+
+		// Get flag
+		a := arg{flag: args[idx], name: args[idx]}
+		if i := strings.Index(a.flag, ":"); i > 0 {
+			a.name, a.spec = a.flag[:i], a.flag[i+1:]
+		}
+
+		// Get value
+		// Values may start with "-" such as in "-flags -global_header"
+		if !isArgBooleanFlag(a.name) {
+			if idx+1 >= len(args) {
+				err = errors.Errorf("astiffmpeg: missing value for %s", a.flag)
+				return
+			}
+			idx++
+			a.hasValue, a.value = true, args[idx]
+		}
+
+		// Process flag
+		switch {
+		case a.name == "-i":
+			var o *InputOptions
+			if o, err = parseInputOptions(pending); err != nil {
+				err = errors.Wrapf(err, "astiffmpeg: parsing options of input %s failed", a.value)
+				return
+			}
+			c.Inputs = append(c.Inputs, Input{Options: o, Path: a.value})
+			pending = nil
+		case a.name == "-filter_complex" || a.name == "-lavfi":
+			if c.FilterGraph != nil {
+				err = errors.New("astiffmpeg: several complex filters are not supported")
+				return
+			}
+			var g FilterGraph
+			if g, err = parseFilterGraph(a.value); err != nil {
+				err = errors.Wrapf(err, "astiffmpeg: parsing filter graph %s failed", a.value)
+				return
+			}
+			c.FilterGraph = &g
+		case a.name == "-y" && len(c.Inputs) == 0 && len(c.Outputs) == 0:
+			c.Global.Overwrite = astiptr.Bool(true)
+		case a.name == "-y":
+			// "-y" is rendered before output paths when Global.Overwrite is not set
+		case argsGlobalFlags[a.name]:
+			parseGlobalOption(&c.Global, a)
+		default:
+			pending = append(pending, a)
+		}
+	}
+
+	// Trailing options
+	if len(pending) > 0 {
+		var ts []string
+		for _, a := range pending {
+			ts = append(ts, a.args()...)
+		}
+		err = errors.Errorf("astiffmpeg: trailing options %s", strings.Join(ts, " "))
+		return
+	}
+	return
+}
+
+// isArgBooleanFlag returns whether the flag doesn't take a value
+func isArgBooleanFlag(name string) bool {
+	return argsBooleanFlags[name] || (strings.HasPrefix(name, "-no") && argsBooleanFlags["-"+name[3:]])
+}
+
+// isArgFlag returns whether the arg is a flag. Negative numbers and "-" are not flags.
+func isArgFlag(a string) bool {
+	return len(a) > 1 && a[0] == '-' && (a[1] < '0' || a[1] > '9') && a[1] != '.'
+}
+
+func parseGlobalOption(o *GlobalOptions, a arg) {
+	switch {
+	case a.name == "-hide_banner":
+		// "-hide_banner" is always rendered
+	case (a.name == "-loglevel" || a.name == "-v") && len(a.spec) == 0 && o.Log == nil && !strings.Contains(strings.TrimPrefix(a.value, "repeat+"), "+"):
+		o.Log = &LogOptions{Level: strings.TrimPrefix(a.value, "repeat+"), Repeated: strings.HasPrefix(a.value, "repeat+")}
+	case a.name == "-n" && o.Overwrite == nil:
+		o.Overwrite = astiptr.Bool(false)
+	case a.name == "-nostats":
+		o.NoStats = true
+	case a.name == "-progress" && a.value == "pipe:"+strconv.Itoa(progressFD):
+		o.Progress = true
+	case a.name == "-report":
+		o.Report = true
+	case a.name == "-stats_period" && o.StatsPeriod.Duration == 0:
+		d, err := parseDuration(a.value)
+		if err != nil || d <= 0 {
+			o.Extra = append(o.Extra, a.args()...)
+			return
+		}
+		o.StatsPeriod = Duration{Duration: d}
+	default:
+		o.Extra = append(o.Extra, a.args()...)
+	}
+}
+
+func parseInputOptions(as []arg) (o *InputOptions, err error) {
+	// No options
+	if len(as) == 0 {
+		return
+	}
+
+	// Loop through args
+	o = &InputOptions{}
+	var d = &DecodingOptions{}
+	var decoding bool
+	for _, a := range as {
+		// Only codecs can be specific to a stream
+		if len(a.spec) > 0 && a.name != "-c" && a.name != "-codec" {
+			o.Extra = append(o.Extra, a.args()...)
+			continue
+		}
+
+		// Process arg
+		parsed := true
+		switch a.name {
+		case "-c", "-codec":
+			if parsed = d.Codec == nil; parsed {
+				d.Codec = &StreamOption{Stream: parseStreamSpecifier(a.spec), Value: a.value}
+			}
+		case "-deint":
+			d.DeinterlacingMode = a.value
+		case "-drop_second_field":
+			if parsed = a.value == "0" || a.value == "1"; parsed {
+				d.DropSecondField = astiptr.Bool(a.value == "1")
+			}
+		case "-hwaccel":
+			d.HardwareAcceleration = a.value
+		case "-hwaccel_device":
+			var i int
+			if i, err = strconv.Atoi(a.value); err != nil {
+				err = nil
+				parsed = false
+			} else {
+				d.HardwareAccelerationDevice = astiptr.Int(i)
+			}
+		case "-ss":
+			d.Position = a.value
+		case "-t":
+			d.Duration = a.value
+		default:
+			parsed = false
+		}
+		if parsed {
+			decoding = true
+		} else {
+			o.Extra = append(o.Extra, a.args()...)
+		}
+	}
+
+	// "-hwaccel_device" is only rendered with "-hwaccel"
+	if d.HardwareAccelerationDevice != nil && len(d.HardwareAcceleration) == 0 {
+		o.Extra = append(o.Extra, "-hwaccel_device", strconv.Itoa(*d.HardwareAccelerationDevice))
+		d.HardwareAccelerationDevice = nil
+	}
+
+	// Update options
+	if decoding {
+		o.Decoding = d
+	}
+	return
+}
+
+func parseOutputOptions(as []arg) (o *OutputOptions, err error) {
+	// No options
+	if len(as) == 0 {
+		return
+	}
+
+	// Loop through args
+	o = &OutputOptions{}
+	var e = &EncodingOptions{}
+	var encoding bool
+	for _, a := range as {
+		// Map
+		if a.name == "-map" && len(a.spec) == 0 {
+			if o.Map == nil {
+				o.Map = &MapOptions{}
+			}
+			*o.Map = append(*o.Map, parseMapOption(a.value))
+			continue
+		}
+
+		// Format
+		if a.name == "-f" && len(a.spec) == 0 && len(o.Format) == 0 {
+			o.Format = a.value
+			continue
+		}
+
+		// Encoding
+		if parseEncodingOption(e, a) {
+			encoding = true
+		} else {
+			o.Extra = append(o.Extra, a.args()...)
+		}
+	}
+
+	// Update options
+	if encoding {
+		o.Encoding = e
+	}
+	return
+}
+
+// parseEncodingOption returns false if the arg can't be described by the encoding options
+func parseEncodingOption(e *EncodingOptions, a arg) bool {
+	// Stream options
+	var so *[]StreamOption
+	var fn func(v string) (interface{}, bool)
+	switch a.name {
+	case "-b", "-maxrate", "-minrate":
+		so = map[string]*[]StreamOption{"-b": &e.Bitrate, "-maxrate": &e.Maxrate, "-minrate": &e.Minrate}[a.name]
+		fn = func(v string) (interface{}, bool) {
+			n, err := parseNumber(v)
+			return n, err == nil
+		}
+	case "-c", "-codec", "-profile":
+		so = map[string]*[]StreamOption{"-c": &e.Codec, "-codec": &e.Codec, "-profile": &e.Profile}[a.name]
+		fn = func(v string) (interface{}, bool) { return v, true }
+	case "-channel_layout", "-sample_fmt":
+		so = map[string]*[]StreamOption{"-channel_layout": &e.ChannelLayout, "-sample_fmt": &e.SampleFormat}[a.name]
+		fn = func(v string) (interface{}, bool) { return v, true }
+	case "-ac", "-ar":
+		// Options without stream specifier are described by AudioChannels and AudioSamplerate
+		if len(a.spec) == 0 {
+			break
+		}
+		so = map[string]*[]StreamOption{"-ac": &e.Channels, "-ar": &e.SampleRate}[a.name]
+		fn = func(v string) (interface{}, bool) {
+			i, err := strconv.Atoi(v)
+			return i, err == nil
+		}
+	case "-af", "-filter", "-vf":
+		// -af and -vf are aliases of -filter:a and -filter:v
+		if a.name != "-filter" {
+			if len(a.spec) > 0 {
+				return false
+			}
+			a.spec = a.name[1:2]
+		}
+		so = &e.Filters
+		fn = func(v string) (interface{}, bool) { return parseFilterOptions(v) }
+	}
+	if so != nil {
+		v, ok := fn(a.value)
+		if ok {
+			*so = append(*so, StreamOption{Stream: parseStreamSpecifier(a.spec), Value: v})
+		}
+		return ok
+	}
+
+	// Other options can't be specific to a stream
+	if len(a.spec) > 0 {
+		return false
+	}
+
+	// Strings
+	if s, ok := map[string]*string{
+		"-coder":                &e.Coder,
+		"-fps_mode":             &e.FPSMode,
+		"-hls_key_info_file":    &e.HlsKeyInfoFile,
+		"-hls_segment_filename": &e.HlsSegmentFileName,
+		"-hls_segment_type":     &e.HlsSegmentType,
+		"-preset":               &e.Preset,
+		"-rc":                   &e.RateControl,
+		"-s":                    &e.FrameSize,
+		"-tune":                 &e.Tune,
+	}[a.name]; ok {
+		if len(*s) > 0 {
+			return false
+		}
+		*s = a.value
+		return true
+	}
+
+	// Ints
+	if i, ok := map[string]**int{
+		"-ac":                    &e.AudioChannels,
+		"-ar":                    &e.AudioSamplerate,
+		"-b_strategy":            &e.BStrategy,
+		"-bf":                    &e.BFrames,
+		"-crf":                   &e.CRF,
+		"-g":                     &e.GOP,
+		"-hls_list_size":         &e.HlsListSize,
+		"-hls_time":              &e.HlsTime,
+		"-keyint_min":            &e.KeyintMin,
+		"-max_muxing_queue_size": &e.MaxMuxingQSize,
+		"-sc_threshold":          &e.SCThreshold,
+	}[a.name]; ok {
+		v, err := strconv.Atoi(a.value)
+		if err != nil || *i != nil {
+			return false
+		}
+		*i = astiptr.Int(v)
+		return true
+	}
+
+	// Floats
+	if f, ok := map[string]**float64{
+		"-cq":    &e.ConstantQuality,
+		"-level": &e.Level,
+		"-r":     &e.Framerate,
+	}[a.name]; ok {
+		v, err := strconv.ParseFloat(a.value, 64)
+		if err != nil || *f != nil {
+			return false
+		}
+		*f = astiptr.Float(v)
+		return true
+	}
+
+	// Others
+	switch a.name {
+	case "-an", "-dn", "-sn", "-vn":
+		*map[string]*bool{"-an": &e.DisableAudio, "-dn": &e.DisableData, "-sn": &e.DisableSubtitle, "-vn": &e.DisableVideo}[a.name] = true
+		return true
+	case "-vsync":
+		// Numeric values are deprecated and have no -fps_mode equivalent
+		if _, err := strconv.Atoi(a.value); err == nil || len(e.FPSMode) > 0 {
+			return false
+		}
+		e.FPSMode = a.value
+		return true
+	case "-bufsize":
+		n, err := parseNumber(a.value)
+		if err != nil || e.BufSize != nil {
+			return false
+		}
+		e.BufSize = &n
+		return true
+	}
+	return false
+}
+
+// parseNumber parses a number only if it renders back to the same string
+func parseNumber(i string) (n Number, err error) {
+	if len(i) == 0 {
+		err = errors.New("astiffmpeg: empty number")
+		return
+	}
+	if n, err = numberFromString(i); err != nil {
+		return
+	}
+	if s := n.string(); s != i {
+		err = errors.Errorf("astiffmpeg: number %s renders as %s", i, s)
+		return
+	}
+	return
+}
+
+// parseFilterOptions parses filters only if they can be described by FilterOptions
+func parseFilterOptions(i string) (o FilterOptions, ok bool) {
+	for _, f := range splitFilterGraph(i, ',') {
+		ps := strings.SplitN(f, "=", 2)
+		switch {
+		case len(f) == 0:
+			return
+		case ps[0] == "setsar" && len(ps) == 2:
+			if o.SAR != nil {
+				return
+			}
+			if o.SAR = probeRatio(ps[1], "/"); o.SAR == nil {
+				return
+			}
+		case ps[0] == "scale_npp" && len(ps) == 2:
+			if o.ScaleNPP != nil {
+				return
+			}
+			r := probeRatio(ps[1], ":")
+			if r == nil {
+				return
+			}
+			o.ScaleNPP = &Scale{Width: r.Antecedent, Height: r.Consequent}
+		default:
+			o.Filters = append(o.Filters, RawFilter(f))
+		}
+	}
+
+	// Filters are rendered in a fixed order
+	ok = o.string() == i
+	return
+}
+
+func parseStreamSpecifier(i string) *StreamSpecifier {
+	if len(i) == 0 {
+		return nil
+	}
+	ms := argsStreamSpecifierRegexp.FindStringSubmatch(i)
+	if ms == nil {
+		return &StreamSpecifier{Name: i}
+	}
+	s := &StreamSpecifier{Type: ms[1]}
+	for _, m := range []string{ms[2], ms[3]} {
+		if len(m) > 0 {
+			v, _ := strconv.Atoi(m)
+			s.Index = astiptr.Int(v)
+		}
+	}
+	return s
+}
+
+func parseMapOption(i string) MapOption {
+	ps := strings.SplitN(i, ":", 2)
+	id, err := strconv.Atoi(ps[0])
+	if err != nil || strconv.Itoa(id) != ps[0] {
+		return MapOption{Name: i}
+	}
+	o := MapOption{InputFileID: id}
+	if len(ps) > 1 {
+		if o.Stream = parseStreamSpecifier(ps[1]); len(o.Stream.Name) > 0 {
+			return MapOption{Name: i}
+		}
+	}
+	return o
+}
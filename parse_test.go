@@ -0,0 +1,107 @@
+package astiffmpeg
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/asticode/go-astitools/ptr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseArgs(t *testing.T) {
+	for _, v := range []struct {
+		hasError bool
+		i        string
+		o        string
+	}{
+		{i: "-i input.mp4 output.mp4", o: "-hide_banner -i input.mp4 -y output.mp4"},
+		{i: "-y -loglevel repeat+error -nostats -progress pipe:3 -threads 4 -i input.mp4 -an output.mp4", o: "-hide_banner -loglevel repeat+error -y -nostats -progress pipe:3 -threads 4 -i input.mp4 -an output.mp4"},
+		{i: "-stats_period 1 -hwaccel cuda -hwaccel_device 1 -c:v h264_cuvid -ss 10 -t 5 -f mpegts -i input.ts -y output.mp4", o: "-hide_banner -stats_period 1 -hwaccel cuda -hwaccel_device 1 -t 5 -ss 10 -c:v h264_cuvid -f mpegts -i input.ts -y output.mp4"},
+		{i: "-i input.mp4 -filter_complex [0:v]scale=1280:720,setsar=1[out] -map [out] -map 0:a:0 -c:v libx264 -b:v 5M -bufsize 10M -preset fast -g 50 -movflags +faststart -f mp4 output.mp4", o: "-hide_banner -i input.mp4 -filter_complex [0:v]scale=1280:720,setsar=1[out] -map [out] -map 0:a:0 -b:v 5M -bufsize 10M -codec:v libx264 -g 50 -preset fast -f mp4 -movflags +faststart -y output.mp4"},
+		{i: "-i input.mp4 -filter_complex [0:v]split[a][b];[a]null[c];[b][c]overlay[d] -map [d] -itsoffset -1 -filter:v setsar=1/1 -vf yadif output.mp4", o: "-hide_banner -i input.mp4 -filter_complex [0:v]split[a][b];[a]null[c];[b][c]overlay[d] -map [d] -filter:v setsar=1/1 -filter:v yadif -itsoffset -1 -y output.mp4"},
+		{i: "-i input.mp4 -af volume=0.5,aresample=async=1 -ar:a:1 44100 -sample_fmt:a s16 -vn -sn output.m4a", o: "-hide_banner -i input.mp4 -ar:a:1 44100 -sample_fmt:a s16 -filter:a volume=0.5,aresample=async=1 -sn -vn -y output.m4a"},
+		{i: "-i input.mp4 -c copy out1.mp4 -b:a 128k out2.mp4", o: "-hide_banner -i input.mp4 -codec copy -y out1.mp4 -b:a 128k -y out2.mp4"},
+		{i: "-n -i input.mp4 -c copy output.mp4", o: "-hide_banner -n -i input.mp4 -codec copy output.mp4"},
+		{i: "-i input.mp4 -copyinkf -noautoscale -c copy output.mp4", o: "-hide_banner -i input.mp4 -codec copy -copyinkf -noautoscale -y output.mp4"},
+		{i: "-fflags -genpts -i input.mp4 -flags -global_header -movflags -empty_moov output.mp4", o: "-hide_banner -fflags -genpts -i input.mp4 -flags -global_header -movflags -empty_moov -y output.mp4"},
+		{hasError: true, i: "-i input.mp4 -filter_complex [0:v]split[a][b] -map [a] output.mp4"},
+		{hasError: true, i: "-i input.mp4 -filter_complex [0:v]null[a];[a]null -map [a] output.mp4"},
+		{hasError: true, i: "-i"},
+		{hasError: true, i: "-i input.mp4 output.mp4 -c copy"},
+	} {
+		c, err := ParseArgs(strings.Fields(v.i))
+		cmd := exec.Command("ffmpeg")
+		if err == nil {
+			err = c.adaptCmd(cmd, nil)
+		}
+		if v.hasError {
+			assert.Error(t, err, v.i)
+			continue
+		}
+		assert.NoError(t, err, v.i)
+		assert.Equal(t, v.o, strings.Join(cmd.Args[1:], " "), v.i)
+	}
+}
+
+func TestParseArgsRoundTrip(t *testing.T) {
+	c := Command{
+		FilterGraph: &FilterGraph{Chains: []FilterChain{{
+			{Filter: RawFilter("scale=1280:720"), Inputs: []FilterPad{{Stream: &StreamSpecifier{Type: StreamSpecifierTypeVideo}}}},
+			{Filter: RawFilter("fps=25"), Outputs: []FilterPad{{Label: "out"}}},
+		}}},
+		Global: GlobalOptions{
+			Extra:     []string{"-filter_threads", "2"},
+			Log:       &LogOptions{Level: LogLevelError},
+			NoStats:   true,
+			Overwrite: astiptr.Bool(false),
+			Report:    true,
+		},
+		Inputs: []Input{
+			{
+				Options: &InputOptions{
+					Decoding: &DecodingOptions{
+						Codec:             &StreamOption{Stream: &StreamSpecifier{Type: StreamSpecifierTypeVideo}, Value: "h264"},
+						DeinterlacingMode: DeinterlacingModeAdaptive,
+						DropSecondField:   astiptr.Bool(true),
+						Position:          "00:01:00",
+					},
+					Extra: []string{"-re"},
+				},
+				Path: "input.mp4",
+			},
+			{Path: "input.srt"},
+		},
+		Outputs: []Output{{
+			Options: &OutputOptions{
+				Encoding: &EncodingOptions{
+					AudioChannels:   astiptr.Int(2),
+					AudioSamplerate: astiptr.Int(48000),
+					Bitrate:         []StreamOption{{Stream: &StreamSpecifier{Index: astiptr.Int(0), Type: StreamSpecifierTypeAudio}, Value: Number{Prefix: "k", Value: 128.0}}},
+					ChannelLayout:   []StreamOption{{Stream: &StreamSpecifier{Index: astiptr.Int(1), Type: StreamSpecifierTypeAudio}, Value: ChannelLayout51}},
+					Channels:        []StreamOption{{Stream: &StreamSpecifier{Index: astiptr.Int(1), Type: StreamSpecifierTypeAudio}, Value: 6}},
+					Codec:           []StreamOption{{Value: "libx264"}},
+					CRF:             astiptr.Int(23),
+					DisableData:     true,
+					DisableSubtitle: true,
+					Filters:         []StreamOption{{Value: FilterOptions{SAR: &Ratio{Antecedent: 1, Consequent: 1}, ScaleNPP: &Scale{Width: 1280, Height: 720}}}},
+					Framerate:       astiptr.Float(25),
+					Level:           astiptr.Float(4.1),
+					Profile:         []StreamOption{{Stream: &StreamSpecifier{Type: StreamSpecifierTypeVideo}, Value: ProfileHigh}},
+					SampleFormat:    []StreamOption{{Value: SampleFormatFLTP}},
+					SampleRate:      []StreamOption{{Stream: &StreamSpecifier{Index: astiptr.Int(1), Type: StreamSpecifierTypeAudio}, Value: 44100}},
+					Tune:            TuneFilm,
+				},
+				Extra:  []string{"-shortest"},
+				Format: "mp4",
+				Map:    &MapOptions{{Name: "[out]"}, {InputFileID: 1, Stream: &StreamSpecifier{Type: StreamSpecifierTypeSubtitle}}},
+			},
+			Path: "output.mp4",
+		}},
+	}
+	cmd := exec.Command("ffmpeg")
+	assert.NoError(t, c.adaptCmd(cmd, nil))
+	p, err := ParseArgs(cmd.Args[1:])
+	assert.NoError(t, err)
+	assert.Equal(t, c, p)
+}
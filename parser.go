@@ -2,6 +2,7 @@ package astiffmpeg
 
 import (
 	"bytes"
+	"sync"
 	"time"
 
 	"strconv"
@@ -11,61 +12,126 @@ import (
 	"github.com/asticode/go-astitools/ptr"
 )
 
-// StdErrParser represents an object capable of parsing stderr
+// StdErrParser represents an object capable of parsing stderr line by line
+// Lines are split on both "\n" and "\r" and are only valid until ProcessLine returns
 type StdErrParser interface {
-	Period() time.Duration
-	Process(t time.Time, b *bytes.Buffer)
+	ProcessLine(t time.Time, l []byte)
 }
 
 // DefaultStdErrParser creates the default stderr parser
+// fn is executed at most once per period with the latest stats line. A zero period means every stats line.
 func DefaultStdErrParser(period time.Duration, fn func(r DefaultStdErrResults)) StdErrParser {
 	return &defaultStdErrParser{
 		fn:     fn,
+		m:      &sync.Mutex{},
 		period: period,
 	}
 }
 
 type defaultStdErrParser struct {
 	fn     func(r DefaultStdErrResults)
+	last   time.Time
+	m      *sync.Mutex
 	period time.Duration
 }
 
-func (p defaultStdErrParser) Period() time.Duration {
-	return p.period
-}
-
-func (p defaultStdErrParser) Process(t time.Time, b *bytes.Buffer) {
-	// Split on \n
-	var lines = bytes.Split(b.Bytes(), []byte("\n"))
-	if len(lines) == 0 {
+func (p *defaultStdErrParser) ProcessLine(t time.Time, l []byte) {
+	// Only stats lines are parsed
+	if !isStatsLine(l) {
 		return
 	}
 
-	// Split on \r
-	var items = bytes.Split(lines[len(lines)-1], []byte("\r"))
-	if len(items) < 2 {
+	// Throttle
+	p.m.Lock()
+	if p.period > 0 && !p.last.IsZero() && t.Sub(p.last) < p.period {
+		p.m.Unlock()
 		return
 	}
-
-	// Parse results
-	r := p.parseResults(items[len(items)-2])
+	p.last = t
+	p.m.Unlock()
 
 	// Execute callback
-	p.fn(r)
-	return
+	p.fn(p.parseResults(l))
+}
+
+// Stats lines start with "frame=" or, when there's no video, with "size="
+func isStatsLine(l []byte) bool {
+	return bytes.HasPrefix(l, []byte("frame=")) || bytes.HasPrefix(l, []byte("size="))
 }
 
 // DefaultStdErrResults represents default stderr results
 type DefaultStdErrResults struct {
 	Bitrate *float64 // bits/s
-	FPS     *int
-	Frame   *int
+	// Estimated time left. Only set on results delivered by Job.Progress when the duration is known.
+	ETA   *time.Duration
+	FPS   *int
+	Frame *int
+	// Between 0 and 100. Only set on results delivered by Job.Progress when the duration is known.
+	Percent *float64
 	Q       *float64
 	Size    *int // bits
 	Speed   *float64
 	Time    *time.Duration
 }
 
+// progressEstimatorWindowSize is the number of speed samples the ETA is smoothed over
+const progressEstimatorWindowSize = 10
+
+// progressEstimator adds percent and ETA to results based on the expected duration
+type progressEstimator struct {
+	duration time.Duration
+	next     int
+	speeds   []float64
+}
+
+func newProgressEstimator(duration time.Duration) *progressEstimator {
+	return &progressEstimator{
+		duration: duration,
+		speeds:   make([]float64, 0, progressEstimatorWindowSize),
+	}
+}
+
+func (e *progressEstimator) estimate(r *DefaultStdErrResults) {
+	// Nothing to estimate
+	if e.duration <= 0 || r.Time == nil {
+		return
+	}
+
+	// Percent
+	p := float64(*r.Time) / float64(e.duration) * 100
+	if p > 100 {
+		p = 100
+	} else if p < 0 {
+		p = 0
+	}
+	r.Percent = astiptr.Float(p)
+
+	// Add speed sample
+	if r.Speed == nil || *r.Speed <= 0 {
+		return
+	}
+	if len(e.speeds) < progressEstimatorWindowSize {
+		e.speeds = append(e.speeds, *r.Speed)
+	} else {
+		e.speeds[e.next] = *r.Speed
+		e.next = (e.next + 1) % progressEstimatorWindowSize
+	}
+
+	// Smooth speed
+	var speed float64
+	for _, s := range e.speeds {
+		speed += s
+	}
+	speed /= float64(len(e.speeds))
+
+	// ETA
+	left := e.duration - *r.Time
+	if left < 0 {
+		left = 0
+	}
+	r.ETA = astiptr.Duration(time.Duration(float64(left) / speed))
+}
+
 // frame=17448 fps=254 q=31.0 size=  176032kB time=00:11:38.14 bitrate=2065.5kbits/s speed=10.2x
 func (p defaultStdErrParser) parseResults(b []byte) (r DefaultStdErrResults) {
 	// Split on =
@@ -21,3 +21,35 @@ func TestDefaultStdErrParser(t *testing.T) {
 		Time:    astiptr.Duration(140*time.Millisecond + 38*time.Second + 11*time.Minute),
 	}, r)
 }
+
+func TestDefaultStdErrParserProcessLine(t *testing.T) {
+	var rs []DefaultStdErrResults
+	p := DefaultStdErrParser(time.Second, func(r DefaultStdErrResults) { rs = append(rs, r) })
+	n := time.Now()
+	p.ProcessLine(n, []byte("Input #0, mov,mp4,m4a,3gp,3g2,mj2, from 'input.mp4':"))
+	p.ProcessLine(n, []byte("frame=1 fps=0.0 q=0.0 size=0kB time=00:00:00.04 bitrate=N/A speed=1x"))
+	p.ProcessLine(n.Add(500*time.Millisecond), []byte("frame=2 fps=0.0 q=0.0 size=0kB time=00:00:00.08 bitrate=N/A speed=1x"))
+	p.ProcessLine(n.Add(time.Second), []byte("size=12kB time=00:00:01.00 bitrate=N/A speed=1x"))
+	assert.Len(t, rs, 2)
+	assert.Equal(t, astiptr.Int(1), rs[0].Frame)
+	assert.Equal(t, astiptr.Duration(time.Second), rs[1].Time)
+}
+
+func TestProgressEstimator(t *testing.T) {
+	e := newProgressEstimator(100 * time.Second)
+	r := DefaultStdErrResults{Speed: astiptr.Float(1), Time: astiptr.Duration(10 * time.Second)}
+	e.estimate(&r)
+	assert.Equal(t, astiptr.Float(10), r.Percent)
+	assert.Equal(t, astiptr.Duration(90*time.Second), r.ETA)
+	r = DefaultStdErrResults{Speed: astiptr.Float(3), Time: astiptr.Duration(20 * time.Second)}
+	e.estimate(&r)
+	assert.Equal(t, astiptr.Float(20), r.Percent)
+	assert.Equal(t, astiptr.Duration(40*time.Second), r.ETA)
+
+	// Unknown duration
+	e = newProgressEstimator(0)
+	r = DefaultStdErrResults{Speed: astiptr.Float(1), Time: astiptr.Duration(10 * time.Second)}
+	e.estimate(&r)
+	assert.Nil(t, r.Percent)
+	assert.Nil(t, r.ETA)
+}
@@ -0,0 +1,102 @@
+package astiffmpeg
+
+import (
+	"io"
+	"os"
+	"strconv"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// pipe represents an input reader or an output writer wired to one of ffmpeg's file descriptors
+type pipe struct {
+	child  *os.File // End given to ffmpeg
+	fd     int
+	parent *os.File // End kept by the parent
+	r      io.Reader
+	w      io.Writer
+}
+
+func (p *pipe) url() string {
+	return "pipe:" + strconv.Itoa(p.fd)
+}
+
+func (p *pipe) open() (err error) {
+	var r, w *os.File
+	if r, w, err = os.Pipe(); err != nil {
+		err = errors.Wrap(err, "astiffmpeg: creating pipe failed")
+		return
+	}
+	if p.r != nil {
+		p.child, p.parent = r, w
+	} else {
+		p.child, p.parent = w, r
+	}
+	return
+}
+
+func (p *pipe) close() {
+	if p.child != nil {
+		p.child.Close()
+	}
+	if p.parent != nil {
+		p.parent.Close()
+	}
+}
+
+// copy copies data between the pipe and the reader or writer until one of them is closed
+// The parent end is not closed so that errors can be recorded before ffmpeg sees the end of an input.
+func (p *pipe) copy() (err error) {
+	if p.r != nil {
+		// ffmpeg may stop reading before the end of the reader
+		if _, err = io.Copy(p.parent, p.r); err != nil {
+			if pe, ok := err.(*os.PathError); ok && pe.Err == syscall.EPIPE {
+				err = nil
+			}
+		}
+	} else {
+		_, err = io.Copy(p.w, p.parent)
+	}
+	return
+}
+
+// pipes assigns a file descriptor to every input reader and output writer
+// The first reader uses stdin, the first writer uses stdout and the others use extra file descriptors, starting
+// right after the progress one
+func (c Command) pipes() (inputs, outputs map[int]*pipe) {
+	// Get first extra fd
+	var fd = progressFD
+	if c.Global.Progress {
+		fd++
+	}
+
+	// Inputs
+	inputs = make(map[int]*pipe)
+	for idx, i := range c.Inputs {
+		if i.Reader == nil {
+			continue
+		}
+		p := &pipe{fd: 0, r: i.Reader}
+		if len(inputs) > 0 {
+			p.fd = fd
+			fd++
+		}
+		inputs[idx] = p
+	}
+
+	// Outputs
+	outputs = make(map[int]*pipe)
+	for idx, o := range c.Outputs {
+		if o.Writer == nil {
+			continue
+		}
+		p := &pipe{fd: 1, w: o.Writer}
+		if len(outputs) > 0 {
+			p.fd = fd
+			fd++
+		}
+		outputs[idx] = p
+	}
+	return
+}
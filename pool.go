@@ -0,0 +1,347 @@
+package astiffmpeg
+
+import (
+	"container/heap"
+	"context"
+	"runtime"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// ErrPoolClosed is returned when submitting a job to a closed pool
+var ErrPoolClosed = errors.New("astiffmpeg: pool is closed")
+
+// Pool job states
+const (
+	PoolJobStateCancelled = "cancelled"
+	PoolJobStateFailed    = "failed"
+	PoolJobStateQueued    = "queued"
+	PoolJobStateRunning   = "running"
+	PoolJobStateSucceeded = "succeeded"
+)
+
+// PoolConfiguration represents the pool configuration
+type PoolConfiguration struct {
+	// Capacity of named semaphores such as "nvenc sessions"
+	Resources map[string]int `toml:"resources"`
+	// Total weight of the jobs running at the same time. Defaults to Workers.
+	Slots int `toml:"slots"`
+	// Max number of jobs running at the same time. Defaults to the number of CPUs.
+	Workers int `toml:"workers"`
+}
+
+// PoolJob represents a job submitted to a pool
+type PoolJob struct {
+	Command Command
+	// Jobs with a higher priority are started first. Jobs with the same priority are started in submission order.
+	Priority int
+	// Amount of each named semaphore the job holds while running
+	Resources map[string]int
+	// Number of slots the job holds while running, a 4K encode should weigh more than an audio remux. Defaults to 1.
+	Weight int
+}
+
+// Pool represents a bounded pool of workers running jobs by priority
+// A job only starts once there's a free worker, enough free slots and enough of each named semaphore
+type Pool struct {
+	c         PoolConfiguration
+	closed    bool
+	f         *FFMpeg
+	m         *sync.Mutex
+	queue     *poolQueue
+	resources map[string]int
+	running   int
+	seq       int
+	slots     int
+}
+
+// NewPool creates a new pool
+func NewPool(f *FFMpeg, c PoolConfiguration) *Pool {
+	if c.Workers <= 0 {
+		c.Workers = runtime.NumCPU()
+	}
+	if c.Slots <= 0 {
+		c.Slots = c.Workers
+	}
+	return &Pool{
+		c:         c,
+		f:         f,
+		m:         &sync.Mutex{},
+		queue:     &poolQueue{},
+		resources: make(map[string]int),
+	}
+}
+
+// QueueDepth returns the number of queued jobs
+func (p *Pool) QueueDepth() int {
+	p.m.Lock()
+	defer p.m.Unlock()
+	return p.queue.Len()
+}
+
+// Running returns the number of running jobs
+func (p *Pool) Running() int {
+	p.m.Lock()
+	defer p.m.Unlock()
+	return p.running
+}
+
+// Close cancels queued jobs and prevents new ones from being submitted. Running jobs are not stopped.
+func (p *Pool) Close() {
+	p.m.Lock()
+	p.closed = true
+	var qs []*QueuedJob
+	for p.queue.Len() > 0 {
+		qs = append(qs, heap.Pop(p.queue).(*QueuedJob))
+	}
+	p.m.Unlock()
+	for _, q := range qs {
+		q.finish(PoolJobStateCancelled, context.Canceled)
+	}
+}
+
+// Submit queues a job
+// Cancelling the context removes the job from the queue, or stops it gracefully if it's running
+func (p *Pool) Submit(ctx context.Context, j PoolJob) (q *QueuedJob, err error) {
+	// Default weight
+	if j.Weight <= 0 {
+		j.Weight = 1
+	}
+
+	// Make sure the job can run at all
+	if j.Weight > p.c.Slots {
+		err = errors.Errorf("astiffmpeg: weight %d exceeds %d slots", j.Weight, p.c.Slots)
+		return
+	}
+	for k, v := range j.Resources {
+		if c, ok := p.c.Resources[k]; !ok {
+			err = errors.Errorf("astiffmpeg: unknown resource %s", k)
+			return
+		} else if v > c {
+			err = errors.Errorf("astiffmpeg: %d %s exceeds capacity %d", v, k, c)
+			return
+		}
+	}
+
+	// Create queued job
+	ctx, cancel := context.WithCancel(ctx)
+	q = &QueuedJob{
+		cancel: cancel,
+		ctx:    ctx,
+		done:   make(chan struct{}),
+		j:      j,
+		m:      &sync.Mutex{},
+		p:      p,
+		state:  PoolJobStateQueued,
+	}
+
+	// Queue
+	p.m.Lock()
+	if p.closed {
+		p.m.Unlock()
+		cancel()
+		q, err = nil, ErrPoolClosed
+		return
+	}
+	q.seq = p.seq
+	p.seq++
+	heap.Push(p.queue, q)
+	p.m.Unlock()
+
+	// Watch context
+	go q.watch()
+
+	// Dispatch
+	p.dispatch()
+	return
+}
+
+// fits must be called with the pool's lock held
+func (p *Pool) fits(j PoolJob) bool {
+	if p.running >= p.c.Workers || p.slots+j.Weight > p.c.Slots {
+		return false
+	}
+	for k, v := range j.Resources {
+		if p.resources[k]+v > p.c.Resources[k] {
+			return false
+		}
+	}
+	return true
+}
+
+// dispatch starts queued jobs by priority until the next one doesn't fit
+// Jobs with a lower priority never overtake the head of the queue so that heavy jobs can't starve
+func (p *Pool) dispatch() {
+	p.m.Lock()
+	defer p.m.Unlock()
+	for p.queue.Len() > 0 && p.fits((*p.queue)[0].j) {
+		// Reserve
+		q := heap.Pop(p.queue).(*QueuedJob)
+		p.running++
+		p.slots += q.j.Weight
+		for k, v := range q.j.Resources {
+			p.resources[k] += v
+		}
+
+		// Run
+		q.setState(PoolJobStateRunning)
+		go q.run()
+	}
+}
+
+// release must be called once a job is over
+func (p *Pool) release(j PoolJob) {
+	p.m.Lock()
+	p.running--
+	p.slots -= j.Weight
+	for k, v := range j.Resources {
+		p.resources[k] -= v
+	}
+	p.m.Unlock()
+	p.dispatch()
+}
+
+// remove removes a queued job from the queue and returns false if it was not queued anymore
+func (p *Pool) remove(q *QueuedJob) bool {
+	p.m.Lock()
+	defer p.m.Unlock()
+	if q.index < 0 {
+		return false
+	}
+	heap.Remove(p.queue, q.index)
+	return true
+}
+
+// QueuedJob represents a job submitted to a pool
+type QueuedJob struct {
+	cancel context.CancelFunc
+	ctx    context.Context
+	done   chan struct{}
+	err    error
+	index  int // Index in the queue, -1 once dequeued
+	j      PoolJob
+	job    *Job
+	m      *sync.Mutex
+	p      *Pool
+	seq    int
+	state  string
+}
+
+// Cancel removes the job from the queue, or stops it gracefully if it's running
+func (q *QueuedJob) Cancel() {
+	q.cancel()
+}
+
+// Done returns a channel closed once the job has ended
+func (q *QueuedJob) Done() <-chan struct{} {
+	return q.done
+}
+
+// Job returns the underlying job. It is nil until the job is running.
+func (q *QueuedJob) Job() *Job {
+	q.m.Lock()
+	defer q.m.Unlock()
+	return q.job
+}
+
+// State returns the job state
+func (q *QueuedJob) State() string {
+	q.m.Lock()
+	defer q.m.Unlock()
+	return q.state
+}
+
+// Wait waits for the job to end and returns its error
+func (q *QueuedJob) Wait() error {
+	<-q.done
+	q.m.Lock()
+	defer q.m.Unlock()
+	return q.err
+}
+
+func (q *QueuedJob) setState(s string) {
+	q.m.Lock()
+	defer q.m.Unlock()
+	q.state = s
+}
+
+func (q *QueuedJob) finish(state string, err error) {
+	q.m.Lock()
+	q.err = err
+	q.state = state
+	q.m.Unlock()
+	close(q.done)
+	q.cancel()
+}
+
+// watch removes the job from the queue when its context is cancelled
+func (q *QueuedJob) watch() {
+	select {
+	case <-q.ctx.Done():
+		if q.p.remove(q) {
+			q.finish(PoolJobStateCancelled, q.ctx.Err())
+		}
+	case <-q.done:
+	}
+}
+
+func (q *QueuedJob) run() {
+	// Release
+	defer q.p.release(q.j)
+
+	// Start
+	j, err := q.p.f.Start(q.ctx, q.j.Command)
+	if err != nil {
+		q.finish(PoolJobStateFailed, err)
+		return
+	}
+	q.m.Lock()
+	q.job = j
+	q.m.Unlock()
+
+	// Wait
+	if err = j.Wait(); err != nil {
+		if q.ctx.Err() != nil {
+			q.finish(PoolJobStateCancelled, err)
+		} else {
+			q.finish(PoolJobStateFailed, err)
+		}
+		return
+	}
+	q.finish(PoolJobStateSucceeded, nil)
+}
+
+// poolQueue is a priority queue of queued jobs implementing heap.Interface
+type poolQueue []*QueuedJob
+
+func (q poolQueue) Len() int { return len(q) }
+
+func (q poolQueue) Less(i, j int) bool {
+	if q[i].j.Priority != q[j].j.Priority {
+		return q[i].j.Priority > q[j].j.Priority
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q poolQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *poolQueue) Push(x interface{}) {
+	i := x.(*QueuedJob)
+	i.index = len(*q)
+	*q = append(*q, i)
+}
+
+func (q *poolQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	i := old[n-1]
+	old[n-1] = nil
+	i.index = -1
+	*q = old[:n-1]
+	return i
+}
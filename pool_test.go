@@ -0,0 +1,70 @@
+package astiffmpeg
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPool(t *testing.T) {
+	p, cleanup := newTestBinary(t, `head -c 1 > /dev/null
+`)
+	defer cleanup()
+	f := newTestFFMpeg(t, Configuration{BinaryPath: p})
+	pl := NewPool(f, PoolConfiguration{
+		Resources: map[string]int{"nvenc": 1},
+		Slots:     4,
+		Workers:   2,
+	})
+	defer pl.Close()
+
+	// Invalid jobs
+	_, err := pl.Submit(context.Background(), PoolJob{Weight: 5})
+	assert.Error(t, err)
+	_, err = pl.Submit(context.Background(), PoolJob{Resources: map[string]int{"unknown": 1}})
+	assert.Error(t, err)
+
+	// Fill the pool
+	q1, err := pl.Submit(context.Background(), PoolJob{Resources: map[string]int{"nvenc": 1}})
+	assert.NoError(t, err)
+	q2, err := pl.Submit(context.Background(), PoolJob{Resources: map[string]int{"nvenc": 1}})
+	assert.NoError(t, err)
+	q3, err := pl.Submit(context.Background(), PoolJob{Weight: 3})
+	assert.NoError(t, err)
+	q4, err := pl.Submit(context.Background(), PoolJob{Priority: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, PoolJobStateRunning, q1.State())
+	assert.Equal(t, PoolJobStateQueued, q2.State())
+	assert.Equal(t, PoolJobStateQueued, q3.State())
+	assert.Equal(t, PoolJobStateRunning, q4.State())
+	assert.Equal(t, 2, pl.Running())
+	assert.Equal(t, 2, pl.QueueDepth())
+
+	// Cancel a queued job
+	q2.Cancel()
+	assert.Error(t, q2.Wait())
+	assert.Equal(t, PoolJobStateCancelled, q2.State())
+	for pl.QueueDepth() > 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// q3 doesn't fit until q1 is over
+	assert.Equal(t, PoolJobStateQueued, q3.State())
+	q1.Cancel()
+	assert.Error(t, q1.Wait())
+	assert.Equal(t, PoolJobStateCancelled, q1.State())
+	for q3.Job() == nil {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, PoolJobStateRunning, q3.State())
+	assert.Equal(t, 0, pl.QueueDepth())
+	q3.Cancel()
+	q4.Cancel()
+	q3.Wait()
+	q4.Wait()
+	for pl.Running() > 0 {
+		time.Sleep(time.Millisecond)
+	}
+}
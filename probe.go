@@ -0,0 +1,376 @@
+package astiffmpeg
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/asticode/go-astilog"
+	"github.com/asticode/go-astitools/ptr"
+	"github.com/pkg/errors"
+)
+
+// Probe represents an entity capable of running an FFProbe binary
+// https://ffmpeg.org/ffprobe.html
+type Probe struct {
+	binaryPath string
+}
+
+// NewProbe creates a new Probe
+func NewProbe(c ProbeConfiguration) *Probe {
+	return &Probe{binaryPath: c.BinaryPath}
+}
+
+// Probe codec types
+const (
+	ProbeCodecTypeAttachment = "attachment"
+	ProbeCodecTypeAudio      = "audio"
+	ProbeCodecTypeData       = "data"
+	ProbeCodecTypeSubtitle   = "subtitle"
+	ProbeCodecTypeVideo      = "video"
+)
+
+// ProbeResults represents probe results
+type ProbeResults struct {
+	Chapters []ProbeChapter
+	Format   ProbeFormat
+	Streams  []ProbeStream
+}
+
+// ProbeChapter represents a probed chapter
+type ProbeChapter struct {
+	End   *time.Duration
+	ID    int
+	Start *time.Duration
+	Tags  map[string]string
+}
+
+// ProbeFormat represents a probed format
+type ProbeFormat struct {
+	Bitrate    *int // bits/s
+	Duration   *time.Duration
+	Filename   string
+	LongName   string
+	Name       string
+	NbPrograms int
+	NbStreams  int
+	ProbeScore int
+	Size       *int // bytes
+	StartTime  *time.Duration
+	Tags       map[string]string
+}
+
+// ProbeStream represents a probed stream
+type ProbeStream struct {
+	AvgFrameRate       *Ratio
+	Bitrate            *int // bits/s
+	BitsPerSample      int
+	ChannelLayout      string
+	Channels           int
+	CodecLongName      string
+	CodecName          string
+	CodecTagString     string
+	CodecType          string
+	DisplayAspectRatio *Ratio
+	Disposition        ProbeDisposition
+	Duration           *time.Duration
+	FieldOrder         string
+	Height             int
+	Index              int
+	Level              int
+	NbFrames           *int
+	PixelFormat        string
+	Profile            string
+	RFrameRate         *Ratio
+	SampleAspectRatio  *Ratio
+	SampleFormat       string
+	SampleRate         *int
+	StartTime          *time.Duration
+	Tags               map[string]string
+	TimeBase           *Ratio
+	Width              int
+}
+
+// ProbeDisposition represents a probed stream disposition
+type ProbeDisposition struct {
+	AttachedPic     bool
+	CleanEffects    bool
+	Comment         bool
+	Default         bool
+	Dub             bool
+	Forced          bool
+	HearingImpaired bool
+	Karaoke         bool
+	Lyrics          bool
+	Original        bool
+	TimedThumbnails bool
+	VisualImpaired  bool
+}
+
+// Exec probes the input located at path
+// ffprobe -print_format json -show_format -show_streams -show_chapters input_url
+// Like with FFMpeg.Exec, failures are returned as *ExecError. Cancelling the context interrupts ffprobe, then kills
+// it after DefaultStopKillTimeout.
+func (p *Probe) Exec(ctx context.Context, path string) (r ProbeResults, err error) {
+	return p.exec(ctx, path, nil)
+}
+
+// exec probes the input located at path, adapt being applied to the cmd when not nil
+func (p *Probe) exec(ctx context.Context, path string, adapt func(cmd *exec.Cmd)) (r ProbeResults, err error) {
+	// Create cmd
+	// The context is not given to the cmd since it would kill ffprobe right away
+	var cmd = exec.Command(p.binaryPath, "-hide_banner", "-print_format", "json", "-show_format", "-show_streams", "-show_chapters", path)
+	cmd.Env = os.Environ()
+	if adapt != nil {
+		adapt(cmd)
+	}
+
+	// Results are written in stdout
+	var bufOut = &bytes.Buffer{}
+	cmd.Stdout = bufOut
+
+	// Errors are written in stderr
+	var stdErr io.ReadCloser
+	if stdErr, err = cmd.StderrPipe(); err != nil {
+		err = errors.Wrap(err, "astiffmpeg: creating stderr pipe failed")
+		return
+	}
+
+	// Start cmd
+	astilog.Debugf("Executing %s", shellJoin(cmd.Args))
+	if err = cmd.Start(); err != nil {
+		err = errors.Wrapf(err, "astiffmpeg: starting %s failed", shellJoin(cmd.Args))
+		return
+	}
+
+	// Stop ffprobe when the context is cancelled
+	// Unlike ffmpeg, ffprobe can't be asked to quit through its stdin
+	var exited = make(chan struct{})
+	var stopOutcome = make(chan string, 1)
+	go func() {
+		select {
+		case <-ctx.Done():
+			// The context may be cancelled while the process has already exited
+			select {
+			case <-exited:
+				stopOutcome <- ""
+			default:
+				stopOutcome <- interruptProcess(cmd.Process, exited, DefaultStopKillTimeout)
+			}
+		case <-exited:
+			stopOutcome <- ""
+		}
+	}()
+
+	// Read stderr
+	// Reads must be completed before waiting for the cmd
+	var rec = newStdErrRecorder()
+	if errRead := readRecords(stdErr, func(t time.Time, l []byte) { rec.add(l) }); errRead != nil {
+		astilog.Error(errors.Wrap(errRead, "astiffmpeg: reading stderr failed"))
+		io.Copy(ioutil.Discard, stdErr)
+	}
+
+	// Wait cmd
+	err = cmd.Wait()
+	close(exited)
+
+	// Process error
+	if o := <-stopOutcome; len(o) > 0 {
+		e := newExecError(cmd, err, rec)
+		e.Cause = ctx.Err()
+		e.StopOutcome = o
+		err = e
+		return
+	} else if err != nil {
+		err = newExecError(cmd, err, rec)
+		return
+	}
+
+	// Parse results
+	if r, err = parseProbeResults(bufOut.Bytes()); err != nil {
+		err = errors.Wrap(err, "astiffmpeg: parsing probe results failed")
+		return
+	}
+	return
+}
+
+type probeResultsJSON struct {
+	Chapters []probeChapterJSON `json:"chapters"`
+	Format   probeFormatJSON    `json:"format"`
+	Streams  []probeStreamJSON  `json:"streams"`
+}
+
+type probeChapterJSON struct {
+	EndTime   string            `json:"end_time"`
+	ID        int               `json:"id"`
+	StartTime string            `json:"start_time"`
+	Tags      map[string]string `json:"tags"`
+}
+
+type probeFormatJSON struct {
+	Bitrate        string            `json:"bit_rate"`
+	Duration       string            `json:"duration"`
+	Filename       string            `json:"filename"`
+	FormatLongName string            `json:"format_long_name"`
+	FormatName     string            `json:"format_name"`
+	NbPrograms     int               `json:"nb_programs"`
+	NbStreams      int               `json:"nb_streams"`
+	ProbeScore     int               `json:"probe_score"`
+	Size           string            `json:"size"`
+	StartTime      string            `json:"start_time"`
+	Tags           map[string]string `json:"tags"`
+}
+
+type probeStreamJSON struct {
+	AvgFrameRate       string            `json:"avg_frame_rate"`
+	Bitrate            string            `json:"bit_rate"`
+	BitsPerSample      int               `json:"bits_per_sample"`
+	ChannelLayout      string            `json:"channel_layout"`
+	Channels           int               `json:"channels"`
+	CodecLongName      string            `json:"codec_long_name"`
+	CodecName          string            `json:"codec_name"`
+	CodecTagString     string            `json:"codec_tag_string"`
+	CodecType          string            `json:"codec_type"`
+	DisplayAspectRatio string            `json:"display_aspect_ratio"`
+	Disposition        map[string]int    `json:"disposition"`
+	Duration           string            `json:"duration"`
+	FieldOrder         string            `json:"field_order"`
+	Height             int               `json:"height"`
+	Index              int               `json:"index"`
+	Level              int               `json:"level"`
+	NbFrames           string            `json:"nb_frames"`
+	PixFmt             string            `json:"pix_fmt"`
+	Profile            string            `json:"profile"`
+	RFrameRate         string            `json:"r_frame_rate"`
+	SampleAspectRatio  string            `json:"sample_aspect_ratio"`
+	SampleFmt          string            `json:"sample_fmt"`
+	SampleRate         string            `json:"sample_rate"`
+	StartTime          string            `json:"start_time"`
+	Tags               map[string]string `json:"tags"`
+	TimeBase           string            `json:"time_base"`
+	Width              int               `json:"width"`
+}
+
+func parseProbeResults(b []byte) (r ProbeResults, err error) {
+	// Unmarshal
+	var j probeResultsJSON
+	if err = json.Unmarshal(b, &j); err != nil {
+		err = errors.Wrap(err, "astiffmpeg: unmarshaling failed")
+		return
+	}
+
+	// Chapters
+	for _, c := range j.Chapters {
+		r.Chapters = append(r.Chapters, ProbeChapter{
+			End:   probeDuration(c.EndTime),
+			ID:    c.ID,
+			Start: probeDuration(c.StartTime),
+			Tags:  c.Tags,
+		})
+	}
+
+	// Format
+	r.Format = ProbeFormat{
+		Bitrate:    probeInt(j.Format.Bitrate),
+		Duration:   probeDuration(j.Format.Duration),
+		Filename:   j.Format.Filename,
+		LongName:   j.Format.FormatLongName,
+		Name:       j.Format.FormatName,
+		NbPrograms: j.Format.NbPrograms,
+		NbStreams:  j.Format.NbStreams,
+		ProbeScore: j.Format.ProbeScore,
+		Size:       probeInt(j.Format.Size),
+		StartTime:  probeDuration(j.Format.StartTime),
+		Tags:       j.Format.Tags,
+	}
+
+	// Streams
+	for _, s := range j.Streams {
+		r.Streams = append(r.Streams, ProbeStream{
+			AvgFrameRate:       probeRatio(s.AvgFrameRate, "/"),
+			Bitrate:            probeInt(s.Bitrate),
+			BitsPerSample:      s.BitsPerSample,
+			ChannelLayout:      s.ChannelLayout,
+			Channels:           s.Channels,
+			CodecLongName:      s.CodecLongName,
+			CodecName:          s.CodecName,
+			CodecTagString:     s.CodecTagString,
+			CodecType:          s.CodecType,
+			DisplayAspectRatio: probeRatio(s.DisplayAspectRatio, ":"),
+			Disposition: ProbeDisposition{
+				AttachedPic:     s.Disposition["attached_pic"] == 1,
+				CleanEffects:    s.Disposition["clean_effects"] == 1,
+				Comment:         s.Disposition["comment"] == 1,
+				Default:         s.Disposition["default"] == 1,
+				Dub:             s.Disposition["dub"] == 1,
+				Forced:          s.Disposition["forced"] == 1,
+				HearingImpaired: s.Disposition["hearing_impaired"] == 1,
+				Karaoke:         s.Disposition["karaoke"] == 1,
+				Lyrics:          s.Disposition["lyrics"] == 1,
+				Original:        s.Disposition["original"] == 1,
+				TimedThumbnails: s.Disposition["timed_thumbnails"] == 1,
+				VisualImpaired:  s.Disposition["visual_impaired"] == 1,
+			},
+			Duration:          probeDuration(s.Duration),
+			FieldOrder:        s.FieldOrder,
+			Height:            s.Height,
+			Index:             s.Index,
+			Level:             s.Level,
+			NbFrames:          probeInt(s.NbFrames),
+			PixelFormat:       s.PixFmt,
+			Profile:           s.Profile,
+			RFrameRate:        probeRatio(s.RFrameRate, "/"),
+			SampleAspectRatio: probeRatio(s.SampleAspectRatio, ":"),
+			SampleFormat:      s.SampleFmt,
+			SampleRate:        probeInt(s.SampleRate),
+			StartTime:         probeDuration(s.StartTime),
+			Tags:              s.Tags,
+			TimeBase:          probeRatio(s.TimeBase, "/"),
+			Width:             s.Width,
+		})
+	}
+	return
+}
+
+// probeDuration parses durations such as "10.010000". Invalid values such as "N/A" return nil.
+func probeDuration(i string) *time.Duration {
+	p, err := strconv.ParseFloat(i, 64)
+	if err != nil {
+		return nil
+	}
+	return astiptr.Duration(time.Duration(math.Round(p * float64(time.Second))))
+}
+
+// probeInt parses integers. Invalid values such as "N/A" return nil.
+func probeInt(i string) *int {
+	p, err := strconv.Atoi(i)
+	if err != nil {
+		return nil
+	}
+	return astiptr.Int(p)
+}
+
+// probeRatio parses ratios such as "30000/1001" or "16:9". Invalid values such as "N/A" return nil.
+func probeRatio(i, sep string) *Ratio {
+	ps := strings.Split(i, sep)
+	if len(ps) != 2 {
+		return nil
+	}
+	a, err := strconv.Atoi(ps[0])
+	if err != nil {
+		return nil
+	}
+	c, err := strconv.Atoi(ps[1])
+	if err != nil {
+		return nil
+	}
+	return &Ratio{Antecedent: a, Consequent: c}
+}
@@ -0,0 +1,142 @@
+package astiffmpeg
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/asticode/go-astitools/ptr"
+	"github.com/stretchr/testify/assert"
+)
+
+const testProbeOutput = `{
+    "streams": [
+        {
+            "index": 0,
+            "codec_name": "h264",
+            "codec_long_name": "H.264 / AVC / MPEG-4 AVC / MPEG-4 part 10",
+            "profile": "High",
+            "codec_type": "video",
+            "codec_tag_string": "avc1",
+            "width": 1920,
+            "height": 1080,
+            "sample_aspect_ratio": "1:1",
+            "display_aspect_ratio": "16:9",
+            "pix_fmt": "yuv420p",
+            "level": 40,
+            "field_order": "progressive",
+            "r_frame_rate": "30000/1001",
+            "avg_frame_rate": "30000/1001",
+            "time_base": "1/30000",
+            "start_time": "0.000000",
+            "duration": "10.010000",
+            "bit_rate": "4987456",
+            "nb_frames": "300",
+            "disposition": {"default": 1, "dub": 0, "forced": 0, "attached_pic": 0},
+            "tags": {"language": "und", "handler_name": "VideoHandler"}
+        },
+        {
+            "index": 1,
+            "codec_name": "aac",
+            "codec_type": "audio",
+            "sample_fmt": "fltp",
+            "sample_rate": "48000",
+            "channels": 2,
+            "channel_layout": "stereo",
+            "bits_per_sample": 0,
+            "r_frame_rate": "0/0",
+            "time_base": "1/48000",
+            "duration": "N/A",
+            "disposition": {"default": 0, "dub": 1}
+        }
+    ],
+    "chapters": [
+        {"id": 0, "time_base": "1/1000", "start": 0, "start_time": "0.000000", "end": 5000, "end_time": "5.000000", "tags": {"title": "Intro"}}
+    ],
+    "format": {
+        "filename": "input.mp4",
+        "nb_streams": 2,
+        "nb_programs": 0,
+        "format_name": "mov,mp4,m4a,3gp,3g2,mj2",
+        "format_long_name": "QuickTime / MOV",
+        "start_time": "0.000000",
+        "duration": "10.010000",
+        "size": "6328764",
+        "bit_rate": "5057953",
+        "probe_score": 100,
+        "tags": {"major_brand": "isom"}
+    }
+}`
+
+func TestParseProbeResults(t *testing.T) {
+	r, err := parseProbeResults([]byte(testProbeOutput))
+	assert.NoError(t, err)
+	assert.Equal(t, []ProbeChapter{{
+		End:   astiptr.Duration(5 * time.Second),
+		Start: astiptr.Duration(0),
+		Tags:  map[string]string{"title": "Intro"},
+	}}, r.Chapters)
+	assert.Equal(t, ProbeFormat{
+		Bitrate:    astiptr.Int(5057953),
+		Duration:   astiptr.Duration(10010 * time.Millisecond),
+		Filename:   "input.mp4",
+		LongName:   "QuickTime / MOV",
+		Name:       "mov,mp4,m4a,3gp,3g2,mj2",
+		NbStreams:  2,
+		ProbeScore: 100,
+		Size:       astiptr.Int(6328764),
+		StartTime:  astiptr.Duration(0),
+		Tags:       map[string]string{"major_brand": "isom"},
+	}, r.Format)
+	assert.Len(t, r.Streams, 2)
+	assert.Equal(t, ProbeStream{
+		AvgFrameRate:       &Ratio{Antecedent: 30000, Consequent: 1001},
+		Bitrate:            astiptr.Int(4987456),
+		CodecLongName:      "H.264 / AVC / MPEG-4 AVC / MPEG-4 part 10",
+		CodecName:          "h264",
+		CodecTagString:     "avc1",
+		CodecType:          ProbeCodecTypeVideo,
+		DisplayAspectRatio: &Ratio{Antecedent: 16, Consequent: 9},
+		Disposition:        ProbeDisposition{Default: true},
+		Duration:           astiptr.Duration(10010 * time.Millisecond),
+		FieldOrder:         "progressive",
+		Height:             1080,
+		Level:              40,
+		NbFrames:           astiptr.Int(300),
+		PixelFormat:        "yuv420p",
+		Profile:            "High",
+		RFrameRate:         &Ratio{Antecedent: 30000, Consequent: 1001},
+		SampleAspectRatio:  &Ratio{Antecedent: 1, Consequent: 1},
+		StartTime:          astiptr.Duration(0),
+		Tags:               map[string]string{"language": "und", "handler_name": "VideoHandler"},
+		TimeBase:           &Ratio{Antecedent: 1, Consequent: 30000},
+		Width:              1920,
+	}, r.Streams[0])
+	assert.Nil(t, r.Streams[1].Duration)
+	assert.Equal(t, astiptr.Int(48000), r.Streams[1].SampleRate)
+	assert.Equal(t, &Ratio{}, r.Streams[1].RFrameRate)
+	assert.True(t, r.Streams[1].Disposition.Dub)
+}
+
+func TestProbeExec(t *testing.T) {
+	p, cleanup := newTestBinary(t, `echo "input.mp4: Invalid data found when processing input" >&2
+exit 1
+`)
+	defer cleanup()
+	_, err := NewProbe(ProbeConfiguration{BinaryPath: p}).Exec(context.Background(), "input.mp4")
+	assert.IsType(t, &ExecError{}, err)
+	assert.Equal(t, ErrInvalidData, err.(*ExecError).Cause)
+
+	// Stop
+	p, cleanup = newTestBinary(t, `trap 'exit 255' INT
+while true; do sleep 0.01; done
+`)
+	defer cleanup()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = NewProbe(ProbeConfiguration{BinaryPath: p}).Exec(ctx, "input.mp4")
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.IsType(t, &ExecError{}, err)
+	assert.Equal(t, StopOutcomeInterrupted, err.(*ExecError).StopOutcome)
+}
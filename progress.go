@@ -0,0 +1,134 @@
+package astiffmpeg
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/asticode/go-astitools/ptr"
+)
+
+// progressFD is the file descriptor ffmpeg writes its -progress output to
+const progressFD = 3
+
+// Progress statuses
+const (
+	ProgressStatusContinue = "continue"
+	ProgressStatusEnd      = "end"
+)
+
+// Progress represents a block of ffmpeg's -progress output
+// https://ffmpeg.org/ffmpeg.html#Advanced-options
+type Progress struct {
+	Bitrate    *float64 // bits/s
+	DropFrames *int
+	DupFrames  *int
+	FPS        *float64
+	Frame      *int
+	Others     map[string]string // Keys that are not parsed, such as stream_0_0_q
+	OutTime    *time.Duration
+	Speed      *float64
+	Status     string
+	TotalSize  *int // bytes
+}
+
+// stdErrResults converts the block into results delivered by Job.Progress
+func (p Progress) stdErrResults() (r DefaultStdErrResults) {
+	r.Bitrate = p.Bitrate
+	if p.FPS != nil {
+		r.FPS = astiptr.Int(int(*p.FPS))
+	}
+	r.Frame = p.Frame
+	if v, ok := p.Others["stream_0_0_q"]; ok {
+		if q, err := strconv.ParseFloat(v, 64); err == nil {
+			r.Q = astiptr.Float(q)
+		}
+	}
+	r.Size = p.TotalSize
+	r.Speed = p.Speed
+	r.Time = p.OutTime
+	return
+}
+
+// ProgressChan returns a progress handler that sends progress blocks to c
+// Blocks are dropped when c is full so that a slow consumer never blocks ffmpeg
+func ProgressChan(c chan<- Progress) func(p Progress) {
+	return func(p Progress) {
+		select {
+		case c <- p:
+		default:
+		}
+	}
+}
+
+// progressParser parses ffmpeg's -progress output line by line. Each block ends with a "progress" key.
+type progressParser struct {
+	fn func(p Progress)
+	p  Progress
+}
+
+func newProgressParser(fn func(p Progress)) *progressParser {
+	return &progressParser{fn: fn}
+}
+
+func (pp *progressParser) processLine(l []byte) {
+	// Split on =
+	var ps = bytes.SplitN(l, []byte("="), 2)
+	if len(ps) < 2 {
+		return
+	}
+	var k, v = string(bytes.TrimSpace(ps[0])), string(bytes.TrimSpace(ps[1]))
+
+	// Parse key/value
+	switch k {
+	case "bitrate":
+		// There may be other suffix, but we only support this one for now
+		if p, err := strconv.ParseFloat(strings.TrimSuffix(v, "kbits/s"), 64); err == nil {
+			pp.p.Bitrate = astiptr.Float(p * 1000)
+		}
+	case "drop_frames":
+		if p, err := strconv.Atoi(v); err == nil {
+			pp.p.DropFrames = astiptr.Int(p)
+		}
+	case "dup_frames":
+		if p, err := strconv.Atoi(v); err == nil {
+			pp.p.DupFrames = astiptr.Int(p)
+		}
+	case "fps":
+		if p, err := strconv.ParseFloat(v, 64); err == nil {
+			pp.p.FPS = astiptr.Float(p)
+		}
+	case "frame":
+		if p, err := strconv.Atoi(v); err == nil {
+			pp.p.Frame = astiptr.Int(p)
+		}
+	case "out_time_ms", "out_time_us":
+		// Despite its name, out_time_ms is in microseconds as well
+		if pp.p.OutTime != nil && k == "out_time_ms" {
+			break
+		}
+		if p, err := strconv.ParseInt(v, 10, 64); err == nil {
+			pp.p.OutTime = astiptr.Duration(time.Duration(p) * time.Microsecond)
+		}
+	case "out_time":
+		// Redundant with out_time_us
+	case "progress":
+		pp.p.Status = v
+		pp.fn(pp.p)
+		pp.p = Progress{}
+	case "speed":
+		if p, err := strconv.ParseFloat(strings.TrimSuffix(v, "x"), 64); err == nil {
+			pp.p.Speed = astiptr.Float(p)
+		}
+	case "total_size":
+		if p, err := strconv.Atoi(v); err == nil {
+			pp.p.TotalSize = astiptr.Int(p)
+		}
+	default:
+		if pp.p.Others == nil {
+			pp.p.Others = make(map[string]string)
+		}
+		pp.p.Others[k] = v
+	}
+}
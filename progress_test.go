@@ -0,0 +1,52 @@
+package astiffmpeg
+
+import (
+	"testing"
+	"time"
+
+	"github.com/asticode/go-astitools/ptr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProgressParser(t *testing.T) {
+	var ps []Progress
+	pp := newProgressParser(func(p Progress) { ps = append(ps, p) })
+	for _, l := range []string{
+		"frame=120",
+		"fps=59.94",
+		"stream_0_0_q=28.0",
+		"bitrate=1234.5kbits/s",
+		"total_size=524336",
+		"out_time_us=4004000",
+		"out_time_ms=4004000",
+		"out_time=00:00:04.004000",
+		"dup_frames=1",
+		"drop_frames=2",
+		"speed=2.01x",
+		"progress=continue",
+		"frame=240",
+		"bitrate=N/A",
+		"speed=N/A",
+		"progress=end",
+	} {
+		pp.processLine([]byte(l))
+	}
+	assert.Equal(t, []Progress{
+		{
+			Bitrate:    astiptr.Float(1234.5 * 1000),
+			DropFrames: astiptr.Int(2),
+			DupFrames:  astiptr.Int(1),
+			FPS:        astiptr.Float(59.94),
+			Frame:      astiptr.Int(120),
+			Others:     map[string]string{"stream_0_0_q": "28.0"},
+			OutTime:    astiptr.Duration(4004 * time.Millisecond),
+			Speed:      astiptr.Float(2.01),
+			Status:     ProgressStatusContinue,
+			TotalSize:  astiptr.Int(524336),
+		},
+		{
+			Frame:  astiptr.Int(240),
+			Status: ProgressStatusEnd,
+		},
+	}, ps)
+}
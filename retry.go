@@ -0,0 +1,146 @@
+package astiffmpeg
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/asticode/go-astilog"
+	"github.com/pkg/errors"
+)
+
+// DefaultRetryBackoff is the default delay before the first retry
+const DefaultRetryBackoff = time.Second
+
+// retryPatterns are stderr messages of transient failures
+var retryPatterns = []string{
+	"Connection refused",
+	"Connection reset by peer",
+	"Connection timed out",
+	"I/O error",
+	"Input/output error",
+	"Network is unreachable",
+	"Server returned 5",
+	"Temporary failure in name resolution",
+}
+
+// RetryPolicy represents a policy deciding whether and when a failed job is started again
+// Stopped jobs and jobs reading from an io.Reader or writing to an io.Writer are never retried
+type RetryPolicy struct {
+	// Delay before the first retry. Defaults to DefaultRetryBackoff.
+	Backoff time.Duration
+	// Decides whether a failure is retryable. Defaults to DefaultRetryClassifier.
+	Classifier func(e *ExecError) bool
+	// Partial outputs are removed between attempts unless KeepPartialOutputs is true. Only local regular files that
+	// didn't exist before the first attempt are removed.
+	KeepPartialOutputs bool
+	// Max number of attempts, including the first one
+	MaxAttempts int
+	// Max delay between attempts. 0 means no limit.
+	MaxBackoff time.Duration
+	// Factor the delay is multiplied by after each retry. Defaults to 2.
+	Multiplier float64
+}
+
+// DefaultRetryClassifier considers network failures and I/O errors found in the stderr tail as retryable
+func DefaultRetryClassifier(e *ExecError) bool {
+	for _, l := range e.StdErrTail {
+		for _, p := range retryPatterns {
+			if strings.Contains(l, p) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (p *RetryPolicy) retryable(c Command, err error, attempts int) bool {
+	// No more attempts
+	if p == nil || attempts >= p.MaxAttempts {
+		return false
+	}
+
+	// Only failures of the process are retryable
+	e, ok := err.(*ExecError)
+	if !ok || len(e.StopOutcome) > 0 {
+		return false
+	}
+
+	// Readers and writers can't be replayed
+	for _, i := range c.Inputs {
+		if i.Reader != nil {
+			return false
+		}
+	}
+	for _, o := range c.Outputs {
+		if o.Writer != nil {
+			return false
+		}
+	}
+
+	// Classify
+	if p.Classifier != nil {
+		return p.Classifier(e)
+	}
+	return DefaultRetryClassifier(e)
+}
+
+// backoff returns the delay before the next attempt
+func (p *RetryPolicy) backoff(attempts int) (d time.Duration) {
+	b := p.Backoff
+	if b <= 0 {
+		b = DefaultRetryBackoff
+	}
+	m := p.Multiplier
+	if m <= 0 {
+		m = 2
+	}
+	f := float64(b) * math.Pow(m, float64(attempts-1))
+	if p.MaxBackoff > 0 && f > float64(p.MaxBackoff) {
+		return p.MaxBackoff
+	}
+	return time.Duration(f)
+}
+
+// removableOutputs returns the local files the command's outputs will create, relative paths being resolved against
+// dir
+// It must be called before the first attempt so that files existing beforehand are never removed.
+func (c Command) removableOutputs(dir string) (ps []string) {
+	for _, o := range c.Outputs {
+		// Only local files can be removed
+		path := strings.TrimPrefix(o.Path, "file:")
+		if o.Writer != nil || path == "" || path == "-" || strings.Contains(path, "://") ||
+			strings.HasPrefix(path, "pipe:") || strings.Contains(path, "%") {
+			continue
+		}
+
+		// Resolve
+		if len(dir) > 0 && !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+
+		// Only files that don't exist yet are created by the command
+		if _, err := os.Lstat(path); os.IsNotExist(err) {
+			ps = append(ps, path)
+		}
+	}
+	return
+}
+
+// removeOutputs removes the regular files created by a failed attempt among the ones returned by removableOutputs
+func removeOutputs(ps []string) {
+	for _, p := range ps {
+		// Devices, symlinks and other non regular files are never removed
+		fi, err := os.Lstat(p)
+		if err != nil || !fi.Mode().IsRegular() {
+			continue
+		}
+
+		// Remove
+		if err = os.Remove(p); err != nil && !os.IsNotExist(err) {
+			astilog.Error(errors.Wrapf(err, "astiffmpeg: removing output %s failed", p))
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package astiffmpeg
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultRetryClassifier(t *testing.T) {
+	for _, v := range []struct {
+		l string
+		r bool
+	}{
+		{l: "tcp://localhost:1234: Connection refused", r: true},
+		{l: "http://localhost/input.mp4: Server returned 5XX Server Error reply", r: true},
+		{l: "[tls @ 0x7f] Connection reset by peer", r: true},
+		{l: "output.mp4: I/O error", r: true},
+		{l: "input.mp4: Invalid data found when processing input"},
+		{l: "http://localhost/input.mp4: Server returned 404 Not Found"},
+	} {
+		assert.Equal(t, v.r, DefaultRetryClassifier(&ExecError{StdErrTail: []string{"frame=1", v.l}}), v.l)
+	}
+}
+
+func TestRetryPolicyRetryable(t *testing.T) {
+	e := &ExecError{StdErrTail: []string{"Connection refused"}}
+	var p *RetryPolicy
+	assert.False(t, p.retryable(Command{}, e, 1))
+	p = &RetryPolicy{MaxAttempts: 2}
+	assert.True(t, p.retryable(Command{}, e, 1))
+	assert.False(t, p.retryable(Command{}, e, 2))
+	assert.False(t, p.retryable(Command{}, &ExecError{StdErrTail: e.StdErrTail, StopOutcome: StopOutcomeGraceful}, 1))
+	assert.False(t, p.retryable(Command{}, context.Canceled, 1))
+	assert.False(t, p.retryable(Command{Inputs: []Input{{Reader: strings.NewReader("")}}}, e, 1))
+	p.Classifier = func(e *ExecError) bool { return e.ExitCode == 3 }
+	assert.False(t, p.retryable(Command{}, e, 1))
+	assert.True(t, p.retryable(Command{}, &ExecError{ExitCode: 3}, 1))
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := &RetryPolicy{}
+	assert.Equal(t, time.Second, p.backoff(1))
+	assert.Equal(t, 4*time.Second, p.backoff(3))
+	p = &RetryPolicy{Backoff: 100 * time.Millisecond, MaxBackoff: time.Second, Multiplier: 3}
+	assert.Equal(t, 300*time.Millisecond, p.backoff(2))
+	assert.Equal(t, time.Second, p.backoff(4))
+}
+
+func TestCommandRemoveOutputs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "astiffmpeg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	p1, p2, p3, p4 := filepath.Join(dir, "1.mp4"), filepath.Join(dir, "%03d.jpg"), filepath.Join(dir, "2.mp4"), filepath.Join(dir, "existing.mp4")
+	if err = ioutil.WriteFile(p4, []byte("existing"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := Command{Outputs: []Output{
+		{Path: "file:" + p1},
+		{Path: p2},
+		{Path: "rtmp://localhost/live"},
+		{Path: filepath.Join(dir, "missing.mp4")},
+		{Path: "2.mp4"},
+		{Path: p4},
+		{Path: os.DevNull},
+	}}
+	ps := c.removableOutputs(dir)
+	assert.Equal(t, []string{p1, filepath.Join(dir, "missing.mp4"), p3}, ps)
+
+	// Attempt
+	for _, p := range []string{p1, p2, p3, p4} {
+		if err = ioutil.WriteFile(p, []byte("partial"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	removeOutputs(append(ps, os.DevNull))
+	_, err = os.Stat(p1)
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(p3)
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(p2)
+	assert.NoError(t, err)
+	_, err = os.Stat(p4)
+	assert.NoError(t, err)
+	_, err = os.Lstat(os.DevNull)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,132 @@
+package astiffmpeg
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// shellSafeChars are the chars that don't need to be quoted in a POSIX shell
+const shellSafeChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789@%+=:,./-_"
+
+// shellQuote quotes a word for a POSIX shell
+func shellQuote(s string) string {
+	if len(s) == 0 {
+		return "''"
+	}
+	if strings.Trim(s, shellSafeChars) == "" {
+		return s
+	}
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// shellJoin quotes and joins words for a POSIX shell
+func shellJoin(ws []string) string {
+	var qs = make([]string, len(ws))
+	for idx, w := range ws {
+		qs[idx] = shellQuote(w)
+	}
+	return strings.Join(qs, " ")
+}
+
+// shellEnv quotes an environment variable assignment for a POSIX shell
+func shellEnv(e string) string {
+	ps := strings.SplitN(e, "=", 2)
+	if len(ps) < 2 {
+		return shellQuote(e)
+	}
+	return ps[0] + "=" + shellQuote(ps[1])
+}
+
+// String returns the command as a line that can be pasted in a POSIX shell, including the environment variables it
+// sets. The binary is assumed to be the latest "ffmpeg" and invalid commands return the error message.
+func (c Command) String() string {
+	cmd := exec.Command("ffmpeg")
+	if err := c.adaptCmd(cmd, nil); err != nil {
+		return errors.Wrap(err, "astiffmpeg: adapting cmd failed").Error()
+	}
+	var ws []string
+	for _, e := range cmd.Env {
+		ws = append(ws, shellEnv(e))
+	}
+	return strings.Join(append(ws, shellJoin(cmd.Args)), " ")
+}
+
+// Script returns a standalone bash script running the command, so that it can be reproduced by hand
+// Inputs readers and outputs writers can't be exported and must be wired to the script's file descriptors by hand.
+// Progress is written to stdout.
+func (f *FFMpeg) Script(ctx context.Context, c Command) (s string, err error) {
+	// Apply defaults
+	c = f.command(c)
+
+	// Get version
+	var v *Version
+	if v, err = f.cmdVersion(ctx, c); err != nil {
+		return
+	}
+	return f.script(c, v)
+}
+
+func (f *FFMpeg) script(c Command, v *Version) (s string, err error) {
+	// Adapt cmd
+	cmd := exec.Command(f.binaryPath)
+	f.adaptCmd(cmd)
+	if err = c.adaptCmd(cmd, v); err != nil {
+		err = errors.Wrap(err, "astiffmpeg: adapting cmd failed")
+		return
+	}
+
+	// Header
+	buf := &bytes.Buffer{}
+	buf.WriteString("#!/usr/bin/env bash\nset -euo pipefail\n")
+
+	// Pipes
+	inputPipes, outputPipes := c.pipes()
+	for _, ps := range []struct {
+		m map[int]*pipe
+		n string
+	}{
+		{m: inputPipes, n: "input"},
+		{m: outputPipes, n: "output"},
+	} {
+		var idxs []int
+		for idx := range ps.m {
+			idxs = append(idxs, idx)
+		}
+		sort.Ints(idxs)
+		for _, idx := range idxs {
+			buf.WriteString("# " + ps.n + " #" + strconv.Itoa(idx) + " must be wired to " + ps.m[idx].url() + "\n")
+		}
+	}
+
+	// Working dir
+	if len(cmd.Dir) > 0 {
+		buf.WriteString("cd " + shellQuote(cmd.Dir) + "\n")
+	}
+
+	// Env
+	for _, e := range cmd.Env {
+		buf.WriteString("export " + shellEnv(e) + "\n")
+	}
+
+	// Cmd
+	buf.WriteString("exec " + shellJoin(cmd.Args))
+	if c.Global.Progress {
+		buf.WriteString(" " + strconv.Itoa(progressFD) + ">&1")
+	}
+	buf.WriteString("\n")
+	s = buf.String()
+	return
+}
+
+// Script returns a standalone bash script running the job's command, see FFMpeg.Script
+func (j *Job) Script() string {
+	// The command has already been adapted successfully when the job was started
+	s, _ := j.f.script(j.c, j.version)
+	return s
+}
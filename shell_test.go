@@ -0,0 +1,62 @@
+package astiffmpeg
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/asticode/go-astitools/ptr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShellQuote(t *testing.T) {
+	for _, v := range []struct {
+		i, o string
+	}{
+		{i: "", o: "''"},
+		{i: "-hide_banner", o: "-hide_banner"},
+		{i: "/tmp/input.mp4", o: "/tmp/input.mp4"},
+		{i: "my input.mp4", o: "'my input.mp4'"},
+		{i: "[0:v]scale=1280:720;[1:v]null", o: "'[0:v]scale=1280:720;[1:v]null'"},
+		{i: "drawtext=text='it''s'", o: `'drawtext=text='\''it'\'''\''s'\'''`},
+		{i: "$HOME", o: "'$HOME'"},
+	} {
+		assert.Equal(t, v.o, shellQuote(v.i), v.i)
+	}
+}
+
+func TestCommandString(t *testing.T) {
+	c := Command{
+		Global: GlobalOptions{Log: &LogOptions{Color: astiptr.Bool(true)}},
+		Inputs: []Input{{Path: "my input.mp4"}},
+		Outputs: []Output{{
+			Options: &OutputOptions{Encoding: &EncodingOptions{Customize: map[string]interface{}{"b": "x", "a": 1}}},
+			Path:    "out.mp4",
+		}},
+	}
+	assert.Equal(t, "AV_LOG_FORCE_COLOR=1 ffmpeg -hide_banner -i 'my input.mp4' -a 1 -b x -y out.mp4", c.String())
+}
+
+func TestFFMpegScript(t *testing.T) {
+	p, cleanup := newTestBinary(t, "")
+	defer cleanup()
+	f := newTestFFMpeg(t, Configuration{BinaryPath: p})
+	s, err := f.Script(context.Background(), Command{
+		Global:  GlobalOptions{Log: &LogOptions{Color: astiptr.Bool(false)}, Progress: true},
+		Inputs:  []Input{{Reader: strings.NewReader("")}},
+		Outputs: []Output{{Path: "it's.mp4"}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, `#!/usr/bin/env bash
+set -euo pipefail
+# input #0 must be wired to pipe:0
+export AV_LOG_FORCE_NOCOLOR=1
+exec `+shellQuote(p)+` -hide_banner -progress pipe:3 -i pipe:0 -y 'it'\''s.mp4' 3>&1
+`, s)
+	// Watchdog
+	f.SetWatchdog(WatchdogOptions{StallTimeout: time.Second})
+	s, err = f.Script(context.Background(), Command{Outputs: []Output{{Path: "output.mp4"}}})
+	assert.NoError(t, err)
+	assert.Contains(t, s, "exec "+shellQuote(p)+" -hide_banner -progress pipe:3 -y output.mp4 3>&1\n")
+}
@@ -0,0 +1,132 @@
+package astiffmpeg
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Stderr limits
+const (
+	stdErrMaxLineSize = 64 * 1024
+	stdErrTailSize    = 50
+)
+
+// scanRecords splits data into records terminated by either "\n" or "\r" since ffmpeg uses "\r" to refresh its
+// stats line. Records longer than stdErrMaxLineSize are split so that the reader never stops draining the pipe.
+func scanRecords(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	if len(data) >= stdErrMaxLineSize {
+		return stdErrMaxLineSize, data[:stdErrMaxLineSize], nil
+	}
+	return 0, nil, nil
+}
+
+// readRecords reads r until EOF and executes fn for each non-empty record
+// The record is only valid until fn returns
+func readRecords(r io.Reader, fn func(t time.Time, l []byte)) error {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 4096), stdErrMaxLineSize+1)
+	s.Split(scanRecords)
+	for s.Scan() {
+		if b := s.Bytes(); len(b) > 0 {
+			fn(time.Now(), b)
+		}
+	}
+	return s.Err()
+}
+
+// stdErrTail keeps the last stderr lines in a bounded ring
+type stdErrTail struct {
+	lines []string
+	m     *sync.Mutex
+	next  int
+	size  int
+}
+
+func newStdErrTail(size int) *stdErrTail {
+	return &stdErrTail{
+		lines: make([]string, 0, size),
+		m:     &sync.Mutex{},
+		size:  size,
+	}
+}
+
+func (t *stdErrTail) add(l []byte) {
+	t.m.Lock()
+	defer t.m.Unlock()
+	if len(t.lines) < t.size {
+		t.lines = append(t.lines, string(l))
+		return
+	}
+	t.lines[t.next] = string(l)
+	t.next = (t.next + 1) % t.size
+}
+
+func (t *stdErrTail) reset() {
+	t.m.Lock()
+	defer t.m.Unlock()
+	t.lines = t.lines[:0]
+	t.next = 0
+}
+
+func (t *stdErrTail) slice() (o []string) {
+	t.m.Lock()
+	defer t.m.Unlock()
+	o = make([]string, 0, len(t.lines))
+	o = append(o, t.lines[t.next:]...)
+	o = append(o, t.lines[:t.next]...)
+	return
+}
+
+func (t *stdErrTail) string() string {
+	return strings.Join(t.slice(), "\n")
+}
+
+// stdErrRecorder keeps track of the stderr lines needed to build an ExecError
+// Error lines followed by several stats lines are dropped since ffmpeg kept on processing after them. The last stats
+// line may be the final report which is printed after errors such as trailer write failures.
+type stdErrRecorder struct {
+	errorLines *stdErrTail
+	statsLines int // Number of stats lines since the last error line
+	tail       *stdErrTail
+}
+
+func newStdErrRecorder() *stdErrRecorder {
+	return &stdErrRecorder{
+		errorLines: newStdErrTail(stdErrErrorLinesSize),
+		tail:       newStdErrTail(stdErrTailSize),
+	}
+}
+
+func (r *stdErrRecorder) add(l []byte) {
+	r.tail.add(l)
+	if isStatsLine(l) {
+		r.statsLines++
+	} else if isErrorLine(l) {
+		if r.statsLines > 1 {
+			r.errorLines.reset()
+		}
+		r.errorLines.add(l)
+		r.statsLines = 0
+	}
+}
+
+// errors returns the error lines that were not followed by several stats lines
+func (r *stdErrRecorder) errors() []string {
+	if r.statsLines > 1 {
+		return []string{}
+	}
+	return r.errorLines.slice()
+}
@@ -0,0 +1,39 @@
+package astiffmpeg
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadRecords(t *testing.T) {
+	var ls []string
+	err := readRecords(strings.NewReader("line 1\nframe=1 time=00:00:00.04\rframe=2 time=00:00:00.08\r\nline 2"), func(t time.Time, l []byte) {
+		ls = append(ls, string(l))
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"line 1", "frame=1 time=00:00:00.04", "frame=2 time=00:00:00.08", "line 2"}, ls)
+
+	// Long lines are split instead of stopping the reader
+	ls = []string{}
+	err = readRecords(bytes.NewReader(bytes.Repeat([]byte("a"), stdErrMaxLineSize+10)), func(t time.Time, l []byte) {
+		ls = append(ls, string(l))
+	})
+	assert.NoError(t, err)
+	assert.Len(t, ls, 2)
+	assert.Len(t, ls[1], 10)
+}
+
+func TestStdErrTail(t *testing.T) {
+	tl := newStdErrTail(3)
+	tl.add([]byte("1"))
+	tl.add([]byte("2"))
+	assert.Equal(t, "1\n2", tl.string())
+	tl.add([]byte("3"))
+	tl.add([]byte("4"))
+	tl.add([]byte("5"))
+	assert.Equal(t, []string{"3", "4", "5"}, tl.slice())
+}
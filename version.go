@@ -0,0 +1,153 @@
+package astiffmpeg
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Version regexps
+var (
+	versionLibraryRegexp = regexp.MustCompile(`^(lib\w+)\s+(\d+)\.\s*(\d+)\.\s*(\d+)`)
+	versionNumberRegexp  = regexp.MustCompile(`^n?(\d+)\.(\d+)(?:\.(\d+))?`)
+)
+
+// versionLibavutilOffset is the difference between libavutil's major version and ffmpeg's one, e.g. libavutil 56 ships
+// with ffmpeg 4
+const versionLibavutilOffset = 52
+
+// Version represents the version of an ffmpeg binary, as printed by "ffmpeg -version"
+type Version struct {
+	Configuration []string                  // Build configuration flags such as "--enable-libx264"
+	Libraries     map[string]LibraryVersion // Indexed by name such as "libavcodec"
+	Major         int
+	Minor         int
+	Patch         int
+	Raw           string // Such as "4.4.2-0ubuntu0.22.04.1" or "N-109876-g1234abcd"
+}
+
+// LibraryVersion represents the version of an ffmpeg library
+type LibraryVersion struct {
+	Major, Minor, Micro int
+}
+
+// String implements the fmt.Stringer interface
+func (v Version) String() string {
+	return v.Raw
+}
+
+// AtLeast returns whether the version is at least major.minor
+// Development builds have no release number: their major version is deduced from libavutil and they are considered
+// more recent than any release with the same major version.
+func (v Version) AtLeast(major, minor int) bool {
+	// Release
+	if v.Major > 0 {
+		return v.Major > major || (v.Major == major && v.Minor >= minor)
+	}
+
+	// Development build
+	if l, ok := v.Libraries["libavutil"]; ok {
+		return l.Major-versionLibavutilOffset >= major
+	}
+	return true
+}
+
+// HasConfiguration returns whether the binary was built with the flag, such as "--enable-libx264" or "enable-libx264"
+func (v Version) HasConfiguration(flag string) bool {
+	flag = "--" + strings.TrimPrefix(flag, "--")
+	for _, c := range v.Configuration {
+		if c == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// requireVersion returns an error if the version is known and older than major.minor
+func requireVersion(v *Version, major, minor int, option string) error {
+	if v == nil || v.AtLeast(major, minor) {
+		return nil
+	}
+	return errors.Errorf("astiffmpeg: %s requires ffmpeg >= %d.%d, found %s", option, major, minor, v.Raw)
+}
+
+// Version returns the version of the ffmpeg binary
+// "ffmpeg -version" is only run once, its results are cached afterwards
+func (f *FFMpeg) Version(ctx context.Context) (v Version, err error) {
+	// Lock
+	f.versionM.Lock()
+	defer f.versionM.Unlock()
+
+	// Cached
+	if f.version != nil {
+		return *f.version, nil
+	}
+
+	// Create cmd
+	var cmd = exec.CommandContext(ctx, f.binaryPath, "-version")
+	cmd.Env = os.Environ()
+	f.adaptCmd(cmd)
+
+	// Run cmd
+	var b []byte
+	if b, err = cmd.Output(); err != nil {
+		err = errors.Wrapf(err, "astiffmpeg: running %s failed", shellJoin(cmd.Args))
+		return
+	}
+
+	// Parse
+	if v, err = parseVersion(b); err != nil {
+		err = errors.Wrap(err, "astiffmpeg: parsing version failed")
+		return
+	}
+
+	// Cache
+	f.version = &v
+	return
+}
+
+func parseVersion(b []byte) (v Version, err error) {
+	v.Libraries = make(map[string]LibraryVersion)
+	for idx, l := range bytes.Split(b, []byte("\n")) {
+		s := strings.TrimSpace(string(l))
+
+		// Version
+		if idx == 0 {
+			if !strings.HasPrefix(s, "ffmpeg version ") {
+				err = errors.Errorf("astiffmpeg: invalid version line %s", s)
+				return
+			}
+			v.Raw = strings.Fields(strings.TrimPrefix(s, "ffmpeg version "))[0]
+			if ms := versionNumberRegexp.FindStringSubmatch(v.Raw); ms != nil {
+				v.Major, _ = strconv.Atoi(ms[1])
+				v.Minor, _ = strconv.Atoi(ms[2])
+				if len(ms[3]) > 0 {
+					v.Patch, _ = strconv.Atoi(ms[3])
+				}
+			}
+			continue
+		}
+
+		// Configuration
+		if strings.HasPrefix(s, "configuration:") {
+			v.Configuration = strings.Fields(strings.TrimPrefix(s, "configuration:"))
+			continue
+		}
+
+		// Library
+		if ms := versionLibraryRegexp.FindStringSubmatch(s); ms != nil {
+			var lv LibraryVersion
+			lv.Major, _ = strconv.Atoi(ms[2])
+			lv.Minor, _ = strconv.Atoi(ms[3])
+			lv.Micro, _ = strconv.Atoi(ms[4])
+			v.Libraries[ms[1]] = lv
+		}
+	}
+	return
+}
@@ -0,0 +1,112 @@
+package astiffmpeg
+
+import (
+	"context"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/asticode/go-astitools/ptr"
+	"github.com/stretchr/testify/assert"
+)
+
+const testVersion = `ffmpeg version 4.4.2-0ubuntu0.22.04.1 Copyright (c) 2000-2021 the FFmpeg developers
+built with gcc 11 (Ubuntu 11.2.0-19ubuntu1)
+configuration: --prefix=/usr --enable-gpl --enable-libx264 --enable-shared
+libavutil      56. 70.100 / 56. 70.100
+libavcodec     58.134.100 / 58.134.100
+libavformat    58. 76.100 / 58. 76.100
+`
+
+func TestParseVersion(t *testing.T) {
+	v, err := parseVersion([]byte(testVersion))
+	assert.NoError(t, err)
+	assert.Equal(t, "4.4.2-0ubuntu0.22.04.1", v.Raw)
+	assert.Equal(t, []int{4, 4, 2}, []int{v.Major, v.Minor, v.Patch})
+	assert.Equal(t, []string{"--prefix=/usr", "--enable-gpl", "--enable-libx264", "--enable-shared"}, v.Configuration)
+	assert.Equal(t, LibraryVersion{Major: 58, Minor: 134, Micro: 100}, v.Libraries["libavcodec"])
+	assert.True(t, v.HasConfiguration("enable-libx264"))
+	assert.True(t, v.HasConfiguration("--enable-gpl"))
+	assert.False(t, v.HasConfiguration("--enable-nonfree"))
+	assert.True(t, v.AtLeast(4, 4))
+	assert.True(t, v.AtLeast(3, 9))
+	assert.False(t, v.AtLeast(5, 1))
+
+	// Development build
+	v, err = parseVersion([]byte("ffmpeg version N-109876-g1234abcd Copyright (c) 2000-2023 the FFmpeg developers\nlibavutil      58.  2.100 / 58.  2.100\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, v.Major)
+	assert.True(t, v.AtLeast(6, 1))
+	assert.False(t, v.AtLeast(7, 0))
+
+	// Invalid
+	_, err = parseVersion([]byte("ffprobe version 4.4"))
+	assert.Error(t, err)
+}
+
+func TestCommandVersion(t *testing.T) {
+	c := Command{
+		Global: GlobalOptions{StatsPeriod: Duration{Duration: 500 * time.Millisecond}},
+		Outputs: []Output{{
+			Options: &OutputOptions{Encoding: &EncodingOptions{FPSMode: FPSModePassthrough}},
+			Path:    "output.mp4",
+		}},
+	}
+	assert.True(t, c.versionGated())
+	assert.False(t, Command{}.versionGated())
+
+	// Latest
+	cmd := exec.Command("ffmpeg")
+	assert.NoError(t, c.adaptCmd(cmd, nil))
+	assert.Equal(t, []string{"ffmpeg", "-hide_banner", "-stats_period", "0.5", "-fps_mode", "passthrough", "-y", "output.mp4"}, cmd.Args)
+
+	// Older
+	cmd = exec.Command("ffmpeg")
+	assert.NoError(t, c.adaptCmd(cmd, &Version{Major: 4, Minor: 4, Raw: "4.4"}))
+	assert.Equal(t, []string{"ffmpeg", "-hide_banner", "-stats_period", "0.5", "-vsync", "passthrough", "-y", "output.mp4"}, cmd.Args)
+
+	// Unsupported
+	err := c.adaptCmd(exec.Command("ffmpeg"), &Version{Major: 4, Minor: 3, Raw: "4.3"})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "-stats_period requires ffmpeg >= 4.4, found 4.3")
+	err = Command{Outputs: []Output{{Options: &OutputOptions{Encoding: &EncodingOptions{HlsSegmentType: HlsSegmentTypeFMP4}}}}}.adaptCmd(exec.Command("ffmpeg"), &Version{Major: 3, Minor: 3, Raw: "3.3"})
+	assert.Error(t, err)
+}
+
+func TestFFMpegVersion(t *testing.T) {
+	dir, cleanup := newTestBinaries(t, map[string]string{"ffmpeg": `if [ "$1" = "-version" ]; then
+	echo "-version" >> "$(dirname "$0")/calls"
+	printf 'ffmpeg version 5.0.1\nlibavutil      57. 17.100 / 57. 17.100\n'
+	exit 0
+fi
+echo "$@" >&2
+`})
+	defer cleanup()
+	p := filepath.Join(dir, "ffmpeg")
+	f := newTestFFMpeg(t, Configuration{BinaryPath: p})
+
+	// Version is detected when checking the binary
+	cmd, err := f.BuildCmd(context.Background(), Command{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{p, "-hide_banner"}, cmd.Args)
+
+	// Version is cached
+	var args string
+	f.SetStdErrParser(testStdErrParser(func(l []byte) { args = string(l) }))
+	for i := 0; i < 2; i++ {
+		err = f.Exec(context.Background(), Command{Outputs: []Output{{
+			Options: &OutputOptions{Encoding: &EncodingOptions{FPSMode: FPSModeCFR, GOP: astiptr.Int(50)}},
+			Path:    "output.mp4",
+		}}})
+		assert.NoError(t, err)
+		assert.Equal(t, "-hide_banner -vsync cfr -g 50 -y output.mp4", args)
+	}
+	v, err := f.Version(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "5.0.1", v.String())
+	assert.FileExists(t, filepath.Join(filepath.Dir(p), "calls"))
+	b, _ := ioutil.ReadFile(filepath.Join(filepath.Dir(p), "calls"))
+	assert.Equal(t, "-version\n", string(b))
+}
@@ -0,0 +1,118 @@
+package astiffmpeg
+
+import (
+	"time"
+
+	"github.com/asticode/go-astilog"
+	"github.com/pkg/errors"
+)
+
+// ErrStalled is the cause of the error returned when a job has been stopped by the watchdog
+var ErrStalled = errors.New("astiffmpeg: job stalled")
+
+// watchdogMinPeriod is the minimum period at which the watchdog checks jobs
+const watchdogMinPeriod = 10 * time.Millisecond
+
+// WatchdogOptions represents watchdog options
+// Stalled jobs are stopped gracefully and their error's cause is ErrStalled
+type WatchdogOptions struct {
+	// Job is stopped if its speed stays below MinSpeed for MinSpeedTimeout
+	MinSpeed        float64
+	MinSpeedTimeout time.Duration
+	// Job is stopped if neither its frame nor its time have advanced for StallTimeout
+	StallTimeout time.Duration
+}
+
+func (o WatchdogOptions) enabled() bool {
+	return o.StallTimeout > 0 || (o.MinSpeed > 0 && o.MinSpeedTimeout > 0)
+}
+
+func (o WatchdogOptions) period() (d time.Duration) {
+	d = o.StallTimeout
+	if o.MinSpeed > 0 && o.MinSpeedTimeout > 0 && (d <= 0 || o.MinSpeedTimeout < d) {
+		d = o.MinSpeedTimeout
+	}
+	if d /= 4; d < watchdogMinPeriod {
+		d = watchdogMinPeriod
+	}
+	return
+}
+
+// jobWatchdog keeps track of a job's advancement
+type jobWatchdog struct {
+	frame       int
+	lastAdvance time.Time
+	o           WatchdogOptions
+	slowSince   time.Time
+	t           time.Duration
+}
+
+func newJobWatchdog(o WatchdogOptions, startedAt time.Time) *jobWatchdog {
+	return &jobWatchdog{
+		lastAdvance: startedAt,
+		o:           o,
+	}
+}
+
+// observe must be called with the job's lock held
+func (w *jobWatchdog) observe(n time.Time, frame *int, t *time.Duration, speed *float64) {
+	// Advancement
+	if frame != nil && *frame > w.frame {
+		w.frame = *frame
+		w.lastAdvance = n
+	}
+	if t != nil && *t > w.t {
+		w.t = *t
+		w.lastAdvance = n
+	}
+
+	// Speed
+	if speed != nil {
+		if *speed >= w.o.MinSpeed {
+			w.slowSince = time.Time{}
+		} else if w.slowSince.IsZero() {
+			w.slowSince = n
+		}
+	}
+}
+
+// stalled must be called with the job's lock held
+func (w *jobWatchdog) stalled(n time.Time) bool {
+	if w.o.StallTimeout > 0 && n.Sub(w.lastAdvance) > w.o.StallTimeout {
+		return true
+	}
+	if w.o.MinSpeed > 0 && w.o.MinSpeedTimeout > 0 && !w.slowSince.IsZero() && n.Sub(w.slowSince) > w.o.MinSpeedTimeout {
+		return true
+	}
+	return false
+}
+
+func (j *Job) observe(a *jobAttempt, frame *int, t *time.Duration, speed *float64) {
+	if a.watchdog == nil {
+		return
+	}
+	j.m.Lock()
+	defer j.m.Unlock()
+	a.watchdog.observe(time.Now(), frame, t, speed)
+}
+
+// runWatchdog stops the job if the process stalls
+func (j *Job) runWatchdog(a *jobAttempt) {
+	t := time.NewTicker(a.watchdog.o.period())
+	defer t.Stop()
+	for {
+		select {
+		case <-a.exited:
+			return
+		case n := <-t.C:
+			j.m.Lock()
+			stalled := a.watchdog.stalled(n)
+			j.m.Unlock()
+			if stalled {
+				astilog.Debugf("astiffmpeg: pid %d stalled", a.cmd.Process.Pid)
+				j.stopWithCause(ErrStalled)
+				return
+			}
+		}
+	}
+}